@@ -1,10 +1,118 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Popcore/verisart/pkg/config"
+	"github.com/Popcore/verisart/pkg/logging"
+	"github.com/Popcore/verisart/pkg/notify"
 	"github.com/Popcore/verisart/pkg/server"
+	"github.com/Popcore/verisart/pkg/signing"
+	"github.com/Popcore/verisart/pkg/store"
 )
 
 func main() {
-	s := server.New(":9091")
-	s.Start()
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Unable to load configuration: %s", err.Error())
+	}
+
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(level)
+	logging.Infof("Configuration: %s", cfg)
+
+	var key *signing.Key
+	if cfg.SigningKey != "" {
+		key, err = signing.LoadOrCreateKey(cfg.SigningKey)
+	} else {
+		logging.Warnf("No key file set, certificates are signed with a temporary key")
+		key, err = signing.GenerateKey()
+	}
+	if err != nil {
+		log.Fatalf("Unable to load signing key: %s", err.Error())
+	}
+
+	var notifier notify.Notifier = notify.Log{}
+	if cfg.Mail.Enabled() {
+		notifier = notify.NewSMTP(cfg.Mail.SMTPAddr, cfg.Mail.From, cfg.Mail.Username, cfg.Mail.Password)
+	} else {
+		logging.Warnf("No mail server set, messages sent to users are logged with their tokens redacted: email changes cannot be verified")
+	}
+
+	storeOpts := []store.Option{
+		store.WithSigner(key),
+		store.WithAdmins(cfg.Admins...),
+		store.WithNotifier(notifier),
+		store.WithTransferTTL(time.Duration(cfg.Expiry.TransferTTL)),
+		store.WithInvitationTTL(time.Duration(cfg.Expiry.InvitationTTL)),
+	}
+
+	var s store.Storer
+	switch cfg.Store.Backend {
+	case config.FileBackend:
+		s, err = store.NewFileStore(cfg.Store.Path, storeOpts...)
+		if err != nil {
+			log.Fatalf("Unable to open data file: %s", err.Error())
+		}
+	default:
+		s = store.NewMemStore(storeOpts...)
+	}
+
+	opts := []server.Option{
+		server.WithAllowedOrigins(cfg.CORS.AllowedOrigins),
+		server.WithTimeouts(time.Duration(cfg.Limits.ReadTimeout), time.Duration(cfg.Limits.WriteTimeout)),
+		server.WithMaxPayloadBytes(cfg.Limits.MaxBodyBytes),
+		server.WithSweepInterval(time.Duration(cfg.Expiry.SweepInterval)),
+	}
+	if cfg.TLS.Enabled() {
+		opts = append(opts, server.WithTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile))
+	}
+
+	srv := server.New(cfg.Addr, s, key, opts...)
+	if closer, ok := s.(io.Closer); ok {
+		srv.OnShutdown(func(ctx context.Context) error {
+			return closer.Close()
+		})
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			log.Fatalf("Unable to run server: %s", err.Error())
+		}
+		return
+	case sig := <-signals:
+		logging.Infof("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Limits.ShutdownTimeout))
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatalf("Unable to shut down server: %s", err.Error())
+	}
+
+	if err := <-errs; err != nil {
+		log.Fatalf("Unable to run server: %s", err.Error())
+	}
+
+	logging.Infof("Server stopped")
 }
@@ -1,6 +1,7 @@
 package certificate
 
 import (
+	"context"
 	"time"
 )
 
@@ -14,22 +15,51 @@ type Certificate struct {
 	Year      int          `json:"year"`
 	Note      string       `json:"note,omitempty"`
 	Transfer  *Transaction `json:"transfer"`
+
+	// ArtistID is the ID of the user who created the artwork.
+	ArtistID string `json:"artistId,omitempty"`
+
+	// Issuer records who issued the certificate. It is set by the store.
+	Issuer *Issuer `json:"issuer,omitempty"`
+
+	// Signature is set when the certificate is signed by the service.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// Issuer is the user who issued a certificate, with the role they had
+// at the time. Fields are listed in alphabetical order of their JSON
+// names since issuers are part of the signed payload of certificates.
+type Issuer struct {
+	Role   string `json:"role"`
+	UserID string `json:"userId"`
 }
 
 type CertManager interface {
-	// CreateCert adds a new Certificate to the store. It returns the generated
-	// certificate or an error if anything goes wrong.
-	CreateCert(c Certificate) (*Certificate, error)
+	// CreateCert adds a new Certificate to the store on behalf of the user
+	// identified by userID, who issues it. Users issue the certificates
+	// they own, and those of the organizations that allowed them to edit
+	// their certificates. It returns the generated certificate or an error
+	// if anything goes wrong.
+	CreateCert(ctx context.Context, userID string, c Certificate) (*Certificate, error)
+
+	// UpdateCert applies a patch to an existing Certificate on behalf of the
+	// user identified by userID, who must own it, be allowed to edit the
+	// certificates of the organization owning it or be allowed to moderate
+	// certificates. It returns the updated certificate or an error if
+	// anything goes wrong.
+	UpdateCert(ctx context.Context, userID, id string, p Patch) (*Certificate, error)
 
-	// UpdateCert modifies an existing Certificate. It returns the updated certificate
-	// or an error if anything goes wrong.
-	UpdateCert(id string, c Certificate) (*Certificate, error)
+	// DeleteCert removes a Certificate from the store on behalf of the user
+	// identified by userID, who must own it, be allowed to edit the
+	// certificates of the organization owning it or be allowed to moderate
+	// certificates. It returns an error if the operation could not be
+	// completed.
+	DeleteCert(ctx context.Context, userID, id string) error
 
-	// DeleteCert removes a Certificate from the store. It returns an error if
-	// the operation could not be completed.
-	DeleteCert(id string) error
+	// GetCert returns the certificate identified by id.
+	GetCert(ctx context.Context, id string) (*Certificate, error)
 
-	// GetCerts returns the certificates belonging to the user identified by
-	// the ownerID.
-	GetCerts(ownerID string) ([]Certificate, error)
+	// GetCerts returns the certificates belonging to the user or the
+	// organization identified by the ownerID.
+	GetCerts(ctx context.Context, ownerID string) ([]Certificate, error)
 }
@@ -0,0 +1,111 @@
+package certificate
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+// Patch describes a partial update of a Certificate following the JSON
+// Merge Patch semantics defined in RFC 7396: fields missing from the patch
+// are left unchanged while fields set to null are removed.
+// A nil field in the Patch means the field was not part of the request.
+type Patch struct {
+	Title *string
+	Year  *int
+
+	// Note points to an empty string when the patch sets the note to null.
+	Note *string
+}
+
+// readOnlyFields maps the fields that cannot be updated with a patch to
+// the message explaining why.
+var readOnlyFields = map[string]string{
+	"id":        "certificate IDs cannot be modified",
+	"createdAt": "the certificate creation time cannot be modified",
+	"ownerId":   "ownership can only be changed with a transfer",
+	"transfer":  "ownership can only be changed with a transfer",
+	"signature": "certificates are signed by the service",
+}
+
+// UnmarshalJSON decodes a JSON merge patch, recording which fields are
+// present in it. Patches modifying read only or unknown fields, or
+// removing required ones, are rejected with a validation.Errors.
+func (p *Patch) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	// fields are checked in a stable order so that errors are
+	// always reported in the same order
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	v := validation.Validator{}
+
+	for _, name := range names {
+		value := fields[name]
+
+		if msg, ok := readOnlyFields[name]; ok {
+			v.Check(false, name, msg)
+			continue
+		}
+
+		isNull := string(value) == "null"
+
+		switch name {
+		case "title":
+			if isNull {
+				v.Check(false, name, "the certificate title cannot be removed")
+				continue
+			}
+			p.Title = new(string)
+			if err := json.Unmarshal(value, p.Title); err != nil {
+				v.Check(false, name, "must be a string")
+			}
+		case "year":
+			if isNull {
+				v.Check(false, name, "the certificate year cannot be removed")
+				continue
+			}
+			p.Year = new(int)
+			if err := json.Unmarshal(value, p.Year); err != nil {
+				v.Check(false, name, "must be a number")
+			}
+		case "note":
+			p.Note = new(string)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(value, p.Note); err != nil {
+				v.Check(false, name, "must be a string")
+			}
+		default:
+			v.Check(false, name, "unknown field")
+		}
+	}
+
+	return v.Err()
+}
+
+// Apply returns a copy of c updated with the fields set in the patch.
+func (p Patch) Apply(c Certificate) Certificate {
+	if p.Title != nil {
+		c.Title = *p.Title
+	}
+
+	if p.Year != nil {
+		c.Year = *p.Year
+	}
+
+	if p.Note != nil {
+		c.Note = *p.Note
+	}
+
+	return c
+}
@@ -0,0 +1,122 @@
+package certificate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+func TestPatchApply(t *testing.T) {
+	original := Certificate{
+		ID:      "the-id",
+		Title:   "the-title",
+		OwnerID: "owner@email.com",
+		Year:    2018,
+		Note:    "some-notes",
+	}
+
+	tests := []struct {
+		patch    string
+		expected Certificate
+	}{
+		{
+			`{}`,
+			original,
+		},
+		{
+			`{"title": "the-new-title"}`,
+			Certificate{ID: "the-id", Title: "the-new-title", OwnerID: "owner@email.com", Year: 2018, Note: "some-notes"},
+		},
+		{
+			`{"year": 1998, "note": "new-notes"}`,
+			Certificate{ID: "the-id", Title: "the-title", OwnerID: "owner@email.com", Year: 1998, Note: "new-notes"},
+		},
+		{
+			`{"note": null}`,
+			Certificate{ID: "the-id", Title: "the-title", OwnerID: "owner@email.com", Year: 2018},
+		},
+	}
+
+	for _, test := range tests {
+		p := Patch{}
+		err := json.Unmarshal([]byte(test.patch), &p)
+		assert.Nil(t, err)
+
+		assert.Equal(t, test.expected, p.Apply(original), test.patch)
+	}
+}
+
+func TestPatchUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		patch string
+		field string
+		msg   string
+	}{
+		{`{"ownerId": "new-owner"}`, "ownerId", "ownership can only be changed with a transfer"},
+		{`{"transfer": {"email": "user@email.com", "status": "accepted"}}`, "transfer", "ownership can only be changed with a transfer"},
+		{`{"id": "new-id"}`, "id", "certificate IDs cannot be modified"},
+		{`{"createdAt": "2018-11-21T12:00:00Z"}`, "createdAt", "the certificate creation time cannot be modified"},
+		{`{"title": null}`, "title", "the certificate title cannot be removed"},
+		{`{"year": null}`, "year", "the certificate year cannot be removed"},
+	}
+
+	for _, test := range tests {
+		p := Patch{}
+		err := json.Unmarshal([]byte(test.patch), &p)
+
+		assert.Equal(t, validation.Errors{{Field: test.field, Msg: test.msg}}, err, test.patch)
+	}
+
+	// patches that are not objects are not valid JSON merge patches
+	p := Patch{}
+	err := json.Unmarshal([]byte(`["title"]`), &p)
+	assert.NotNil(t, err)
+
+	_, ok := err.(validation.Errors)
+	assert.False(t, ok)
+}
+
+func TestPatchUnmarshalMultipleErrors(t *testing.T) {
+	p := Patch{}
+	err := json.Unmarshal([]byte(`{"year": "1998", "id": "new-id", "color": "red"}`), &p)
+
+	assert.Equal(t, validation.Errors{
+		{Field: "color", Msg: "unknown field"},
+		{Field: "id", Msg: "certificate IDs cannot be modified"},
+		{Field: "year", Msg: "must be a number"},
+	}, err)
+}
+
+func TestPatchValidate(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	title, year, note := "", 0, strings.Repeat("a", MaxNoteLength+1)
+
+	err := Patch{Title: &title, Year: &year, Note: &note}.Validate(now)
+	assert.Equal(t, validation.Errors{
+		{Field: "title", Msg: "is required"},
+		{Field: "year", Msg: "must be between 1 and 2018"},
+		{Field: "note", Msg: "must be at most 2000 characters long"},
+	}, err)
+
+	// fields missing from the patch are not validated
+	assert.Nil(t, Patch{}.Validate(now))
+}
+
+func TestCertificateValidate(t *testing.T) {
+	now := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	assert.Nil(t, Certificate{Title: "the-title", Year: 2018}.Validate(now))
+
+	err := Certificate{Title: strings.Repeat("a", MaxTitleLength+1), Year: 2019}.Validate(now)
+	assert.Equal(t, validation.Errors{
+		{Field: "title", Msg: "must be at most 200 characters long"},
+		{Field: "year", Msg: "must be between 1 and 2018"},
+	}, err)
+
+	// the year can be the year of now once it comes
+	assert.Nil(t, Certificate{Title: "the-title", Year: 2019}.Validate(now.AddDate(1, 0, 0)))
+}
@@ -0,0 +1,63 @@
+package certificate
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Signature is the signature of a certificate issued by the service. It
+// covers the payload returned by Certificate.SignedPayload.
+type Signature struct {
+	// KeyID identifies the key used to produce the signature.
+	KeyID string `json:"keyId"`
+
+	// Algorithm is the name of the signature algorithm, e.g. Ed25519.
+	Algorithm string `json:"algorithm"`
+
+	// Value is the base64 encoded signature.
+	Value string `json:"value"`
+}
+
+// Signer is the interface implemented by the keys used to sign
+// certificates.
+type Signer interface {
+	// Sign returns the signature of payload.
+	Sign(payload []byte) (Signature, error)
+}
+
+// signedCertificate lists the certificate fields covered by its
+// signature. Fields are listed in alphabetical order of their JSON names
+// and encoding/json always encodes struct fields in order, so the same
+// certificate always produces the same payload.
+//
+// The artist and issuer are left out when empty, so that the payloads of
+// the certificates issued before they were recorded do not change.
+type signedCertificate struct {
+	ArtistID  string  `json:"artistId,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	ID        string  `json:"id"`
+	Issuer    *Issuer `json:"issuer,omitempty"`
+	Note      string  `json:"note"`
+	OwnerID   string  `json:"ownerId"`
+	Title     string  `json:"title"`
+	Year      int     `json:"year"`
+}
+
+// SignedPayload returns the canonical representation of the certificate
+// that is signed by the service: a compact JSON object holding the ID,
+// title, year, note, artist, issuer, owner and creation time of the
+// certificate, with keys sorted alphabetically and times formatted as
+// RFC 3339 in UTC.
+// Transfers and the signature itself are not part of the payload.
+func (c Certificate) SignedPayload() ([]byte, error) {
+	return json.Marshal(signedCertificate{
+		ArtistID:  c.ArtistID,
+		CreatedAt: c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ID:        c.ID,
+		Issuer:    c.Issuer,
+		Note:      c.Note,
+		OwnerID:   c.OwnerID,
+		Title:     c.Title,
+		Year:      c.Year,
+	})
+}
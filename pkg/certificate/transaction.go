@@ -1,26 +1,75 @@
 package certificate
 
+import (
+	"context"
+	"time"
+)
+
 // Transaction represents a certificate transaction
 // from one uer to another.
+//
+// From is the ID of the certificate owner who created the transaction
+// while To is the email address of its recipient. To is empty when the
+// recipient is an organization, identified by RecipientID.
 type Transaction struct {
-	To     string         `json:"email"`
-	Status transferStatus `json:"status"`
+	ID         string         `json:"id"`
+	From       string         `json:"from"`
+	To         string         `json:"email"`
+	Status     TransferStatus `json:"status"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	ResolvedAt *time.Time     `json:"resolvedAt,omitempty"`
+
+	// RecipientID is the ID of the user or organization receiving the
+	// certificate. It is empty until the invitation of transactions sent
+	// to recipients who were not users is claimed.
+	RecipientID string `json:"recipientId,omitempty"`
+
+	// ExpiresAt is the time the transaction expires if it is still
+	// pending. Transactions without an expiry stay pending until resolved.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Invitation is set when the recipient was not a user when the
+	// transaction was created.
+	Invitation *Invitation `json:"invitation,omitempty"`
+
+	// ClaimToken is the token the recipient of an invitation can redeem
+	// to claim the transaction. It is only returned when the transaction
+	// is created and is never stored.
+	ClaimToken string `json:"claimToken,omitempty"`
+}
+
+// Invitation describes a transaction sent to an email address that did
+// not belong to any user. The transaction can be accepted or rejected
+// only once the invitation is claimed, either by registering with the
+// invited email address or by redeeming the claim token.
+type Invitation struct {
+	ExpiresAt time.Time  `json:"expiresAt"`
+	ClaimedAt *time.Time `json:"claimedAt,omitempty"`
 }
 
-type transferStatus string
+// TransferStatus describes the state of a transaction.
+type TransferStatus string
 
 const (
 	// Pending is a status that can be applied to a transaction
 	// waiting for approval.
-	Pending transferStatus = "pending"
+	Pending TransferStatus = "pending"
 
 	// Accepted is a status that can be applied to a transaction
 	// that has been agreed.
-	Accepted transferStatus = "accepted"
+	Accepted TransferStatus = "accepted"
 
 	// Rejected is a status that can be applied to a transaction
-	// that has been declined. Currently unused.
-	Rejected transferStatus = "rejected"
+	// that has been declined by its recipient.
+	Rejected TransferStatus = "rejected"
+
+	// Cancelled is a status that can be applied to a transaction
+	// that has been withdrawn by the certificate owner.
+	Cancelled TransferStatus = "cancelled"
+
+	// Expired is a status that can be applied to a transaction that was
+	// not resolved, or whose invitation was not claimed, in time.
+	Expired TransferStatus = "expired"
 )
 
 // Transferer is the interface tht defines operations on certificate
@@ -28,10 +77,45 @@ const (
 type Transferer interface {
 
 	// CreateTx returns a new peding transaction for a certificate
-	// idnetified by its id.
-	CreateTx(certID string, trx Transaction) (*Transaction, error)
+	// idnetified by its id. Only the certificate owner, identified
+	// by userID, can create transactions. Transactions are sent to the
+	// email address To or, when To is empty, to the organization
+	// identified by RecipientID.
+	// When the recipient is not a user the transaction is an invitation
+	// and the returned transaction includes its claim token.
+	CreateTx(ctx context.Context, userID, certID string, trx Transaction) (*Transaction, error)
 
-	// AcceptTx finalizes a certificate transaction to a new user.
+	// AcceptTx finalizes a certificate transaction to a new user or
+	// organization. userID must identify the transaction recipient.
 	// If successiful it returns the updated certificate.
-	AcceptTx(certID string) (*Certificate, error)
+	AcceptTx(ctx context.Context, userID, certID string) (*Certificate, error)
+
+	// RejectTx declines the pending transaction of a certificate on
+	// behalf of its recipient, identified by userID. Ownership of the
+	// certificate is unchanged.
+	// If successful it returns the updated certificate.
+	RejectTx(ctx context.Context, userID, certID string) (*Certificate, error)
+
+	// CancelTx withdraws the pending transaction of a certificate on
+	// behalf of its owner, identified by userID. Ownership of the
+	// certificate is unchanged.
+	// If successful it returns the updated certificate.
+	CancelTx(ctx context.Context, userID, certID string) (*Certificate, error)
+
+	// ClaimInvitation redeems the claim token of a transaction sent to a
+	// recipient who was not a user. The user identified by userID becomes
+	// the recipient of the transaction and can then accept or reject it.
+	// Claim tokens can be redeemed only once.
+	// If successful it returns the claimed transaction.
+	ClaimInvitation(ctx context.Context, userID, token string) (*Transaction, error)
+
+	// ExpireTxs marks the pending transactions that should have been
+	// resolved before now as expired. It returns the number of expired
+	// transactions.
+	ExpireTxs(ctx context.Context, now time.Time) (int, error)
+
+	// GetTxs returns the transactions of a certificate in chronological
+	// order, oldest first. Only limit transactions starting at offset are
+	// returned, together with the total number of transactions.
+	GetTxs(ctx context.Context, certID string, offset, limit int) ([]Transaction, int, error)
 }
@@ -0,0 +1,53 @@
+package certificate
+
+import (
+	"time"
+
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+const (
+	// MaxTitleLength is the maximum length of a certificate title.
+	MaxTitleLength = 200
+
+	// MaxNoteLength is the maximum length of a certificate note.
+	MaxNoteLength = 2000
+
+	// MinYear is the earliest year a certificate can refer to.
+	MinYear = 1
+)
+
+// Validate checks that the fields of a certificate that can be set by
+// users are valid. Years after the year of now are refused.
+func (c Certificate) Validate(now time.Time) error {
+	v := validation.Validator{}
+	validateFields(&v, now, &c.Title, &c.Year, &c.Note)
+
+	return v.Err()
+}
+
+// Validate checks that the fields set in the patch are valid. Years after
+// the year of now are refused.
+func (p Patch) Validate(now time.Time) error {
+	v := validation.Validator{}
+	validateFields(&v, now, p.Title, p.Year, p.Note)
+
+	return v.Err()
+}
+
+// validateFields checks the fields of a certificate that can be set by
+// users at the time now. nil fields are not checked.
+func validateFields(v *validation.Validator, now time.Time, title *string, year *int, note *string) {
+	if title != nil {
+		v.Required("title", *title)
+		v.MaxLength("title", *title, MaxTitleLength)
+	}
+
+	if year != nil {
+		v.Range("year", *year, MinYear, now.Year())
+	}
+
+	if note != nil {
+		v.MaxLength("note", *note, MaxNoteLength)
+	}
+}
@@ -0,0 +1,57 @@
+// Package clock abstracts the current time so that time dependent
+// behaviour, such as expiring transfers, can be tested deterministically.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the interface that provides the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is a Clock that returns the system time in UTC.
+type Real struct{}
+
+// Now returns the current system time in UTC.
+func (Real) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Fake is a Clock whose time only changes when set or advanced. It is
+// safe for concurrent use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time the clock is set to.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Set sets the clock to now.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = now
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
@@ -0,0 +1,299 @@
+// Package config holds the settings of the application. Settings are
+// read, from the lowest to the highest precedence, from their defaults,
+// an optional YAML or JSON configuration file, environment variables and
+// command-line flags.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Popcore/verisart/pkg/logging"
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+const (
+	// MemoryBackend keeps data in memory only.
+	MemoryBackend = "memory"
+
+	// FileBackend persists data in a JSON file.
+	FileBackend = "file"
+)
+
+// redacted replaces the value of secret settings when the configuration
+// is printed.
+const redacted = "<redacted>"
+
+// Config holds the settings of the application.
+type Config struct {
+	// Addr is the address the server listens on.
+	Addr string `json:"addr"`
+
+	Store Store `json:"store"`
+
+	// SigningKey is the path of the file holding the key used to sign
+	// certificates. With the file backend it defaults to a file next to
+	// the data file, so that certificates stay verifiable across restarts.
+	// Otherwise, when empty, a new key is generated at every start.
+	SigningKey string `json:"signingKey"`
+
+	CORS   CORS   `json:"cors"`
+	TLS    TLS    `json:"tls"`
+	Limits Limits `json:"limits"`
+	Mail   Mail   `json:"mail"`
+	Expiry Expiry `json:"expiry"`
+
+	// LogLevel is the minimum level of the messages that are logged:
+	// debug, info, warn or error.
+	LogLevel string `json:"logLevel"`
+
+	// Admins lists the email addresses of the users who are made admins
+	// once they verify their address, so that they can assign roles to
+	// other users. Admin addresses are verified by email, so they require
+	// a mail server.
+	Admins []string `json:"admins,omitempty"`
+}
+
+// Store configures where data is kept.
+type Store struct {
+	// Backend is either memory or file. When not set it is file if Path
+	// is set and memory otherwise.
+	Backend string `json:"backend"`
+
+	// Path is the data file of the file backend.
+	Path string `json:"path"`
+}
+
+// CORS configures the cross-origin requests the server allows.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to send requests, or "*"
+	// to allow any origin.
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+// TLS configures the certificate the server uses to serve https. The
+// server serves plain http when both files are empty.
+type TLS struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// Enabled returns true if the server serves https.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Mail configures the mail server delivering the messages sent to users,
+// such as the verification tokens of email changes. Messages are written
+// to the log, with their tokens redacted, when no server is set.
+type Mail struct {
+	// SMTPAddr is the host and port of the mail server.
+	SMTPAddr string `json:"smtpAddr"`
+
+	// From is the address messages are sent from.
+	From string `json:"from"`
+
+	// Username and Password authenticate with the mail server, if set.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Enabled returns true if messages are delivered by a mail server.
+func (m Mail) Enabled() bool {
+	return m.SMTPAddr != ""
+}
+
+// Limits bounds the resources used by requests.
+type Limits struct {
+	// MaxBodyBytes is the maximum size of request payloads.
+	MaxBodyBytes int64 `json:"maxBodyBytes"`
+
+	// ReadTimeout and WriteTimeout bound the time spent reading a request
+	// and writing its response.
+	ReadTimeout  Duration `json:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout"`
+
+	// ShutdownTimeout is how long the server waits for active requests to
+	// complete when shutting down.
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+// Expiry configures how long transactions stay pending. Its defaults
+// are those of the store and the server.
+type Expiry struct {
+	// TransferTTL is the time transactions created without an expiry stay
+	// pending. When 0 such transactions never expire.
+	TransferTTL Duration `json:"transferTTL"`
+
+	// InvitationTTL is the time recipients who are not users have to
+	// claim a transaction.
+	InvitationTTL Duration `json:"invitationTTL"`
+
+	// SweepInterval is how often the server looks for overdue transfers.
+	SweepInterval Duration `json:"sweepInterval"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as "10s".
+type Duration time.Duration
+
+// MarshalJSON writes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string such as "1m30s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings such as \"10s\"")
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// Default returns the configuration used when no setting is changed.
+func Default() Config {
+	return Config{
+		Addr: ":9091",
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+		},
+		Limits: Limits{
+			MaxBodyBytes:    1 << 20,
+			ReadTimeout:     Duration(30 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		Expiry: Expiry{
+			TransferTTL:   Duration(30 * 24 * time.Hour),
+			InvitationTTL: Duration(7 * 24 * time.Hour),
+			SweepInterval: Duration(time.Minute),
+		},
+		LogLevel: "info",
+	}
+}
+
+// Validate checks that the settings are consistent and that the files
+// they refer to exist.
+func (c Config) Validate() error {
+	v := validation.Validator{}
+
+	v.Required("addr", c.Addr)
+	if c.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Addr)
+		v.Check(err == nil, "addr", "must be a host and port, such as :9091")
+	}
+
+	switch c.Store.Backend {
+	case MemoryBackend:
+		v.Check(c.Store.Path == "", "store.path", "can only be set with the file backend")
+	case FileBackend:
+		v.Required("store.path", c.Store.Path)
+	default:
+		v.Check(false, "store.backend", "must be 'memory' or 'file'")
+	}
+
+	v.Check(len(c.CORS.AllowedOrigins) > 0, "cors.allowedOrigins", "is required")
+	for _, origin := range c.CORS.AllowedOrigins {
+		v.Check(validOrigin(origin), "cors.allowedOrigins", fmt.Sprintf("%q is not '*' or an http(s) origin", origin))
+	}
+
+	if c.TLS.Enabled() {
+		checkFile(&v, "tls.certFile", c.TLS.CertFile)
+		checkFile(&v, "tls.keyFile", c.TLS.KeyFile)
+	}
+
+	v.Check(c.Limits.MaxBodyBytes > 0, "limits.maxBodyBytes", "must be positive")
+	v.Check(c.Limits.ReadTimeout > 0, "limits.readTimeout", "must be positive")
+	v.Check(c.Limits.WriteTimeout > 0, "limits.writeTimeout", "must be positive")
+	v.Check(c.Limits.ShutdownTimeout > 0, "limits.shutdownTimeout", "must be positive")
+
+	v.Check(c.Expiry.TransferTTL >= 0, "expiry.transferTTL", "cannot be negative")
+	v.Check(c.Expiry.InvitationTTL > 0, "expiry.invitationTTL", "must be positive")
+	v.Check(c.Expiry.SweepInterval > 0, "expiry.sweepInterval", "must be positive")
+
+	_, err := logging.ParseLevel(c.LogLevel)
+	v.Check(err == nil, "logLevel", "must be 'debug', 'info', 'warn' or 'error'")
+
+	for _, email := range c.Admins {
+		v.Email("admins", email)
+	}
+	v.Check(len(c.Admins) == 0 || c.Mail.Enabled(), "admins", "require a mail server to verify their addresses")
+
+	if c.Mail.Enabled() {
+		_, _, err := net.SplitHostPort(c.Mail.SMTPAddr)
+		v.Check(err == nil, "mail.smtpAddr", "must be a host and port, such as localhost:25")
+		v.Required("mail.from", c.Mail.From)
+		if c.Mail.From != "" {
+			v.Email("mail.from", c.Mail.From)
+		}
+	} else {
+		v.Check(c.Mail.From == "" && c.Mail.Username == "" && c.Mail.Password == "", "mail.smtpAddr", "is required to deliver mail")
+	}
+	v.Check(c.Mail.Password == "" || c.Mail.Username != "", "mail.username", "is required with a password")
+
+	return v.Err()
+}
+
+// checkFile records an error for field unless path is the path of an
+// existing file.
+func checkFile(v *validation.Validator, field, path string) {
+	v.Required(field, path)
+	if path != "" {
+		_, err := os.Stat(path)
+		v.Check(err == nil, field, "must be an existing file")
+	}
+}
+
+// validOrigin returns true if origin is "*" or a scheme, host and
+// optional port, such as https://example.com.
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+}
+
+// Redacted returns a copy of c whose secrets are replaced, so that it
+// can be logged. The paths of private key files and the mail server
+// password are considered secrets.
+func (c Config) Redacted() Config {
+	if c.SigningKey != "" {
+		c.SigningKey = redacted
+	}
+	if c.TLS.KeyFile != "" {
+		c.TLS.KeyFile = redacted
+	}
+	if c.Mail.Password != "" {
+		c.Mail.Password = redacted
+	}
+	c.CORS.AllowedOrigins = append([]string{}, c.CORS.AllowedOrigins...)
+
+	return c
+}
+
+// String returns the JSON encoding of the redacted configuration.
+func (c Config) String() string {
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("<invalid configuration: %s>", err.Error())
+	}
+
+	return string(data)
+}
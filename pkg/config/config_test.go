@@ -0,0 +1,230 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a getenv function reading from vars.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+// writeFile writes content to a file called name in a new temporary
+// directory and returns its path together with a function removing the
+// directory.
+func writeFile(t *testing.T, name, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "verisart-config")
+	assert.Nil(t, err)
+
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := Load(nil, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+
+	expected := Default()
+	expected.Store.Backend = MemoryBackend
+	assert.Equal(t, expected, c)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path, cleanup := writeFile(t, "config.json", `{
+		"addr": ":8000",
+		"logLevel": "debug",
+		"cors": {"allowedOrigins": ["https://file.example.com"]},
+		"limits": {"readTimeout": "5s", "maxBodyBytes": 1024}
+	}`)
+	defer cleanup()
+
+	c, err := Load(
+		[]string{"-config", path, "-addr", ":7000"},
+		env(map[string]string{
+			"VERISART_ADDR":         ":9000",
+			"VERISART_LOG_LEVEL":    "warn",
+			"VERISART_CORS_ORIGINS": "https://a.example.com, https://b.example.com",
+		}),
+		ioutil.Discard,
+	)
+	assert.Nil(t, err)
+
+	// flags win over environment variables, which win over the file
+	assert.Equal(t, ":7000", c.Addr)
+	assert.Equal(t, "warn", c.LogLevel)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, c.CORS.AllowedOrigins)
+
+	// the file wins over the defaults, and settings missing from it keep
+	// their default
+	assert.Equal(t, Duration(5*time.Second), c.Limits.ReadTimeout)
+	assert.Equal(t, int64(1024), c.Limits.MaxBodyBytes)
+	assert.Equal(t, Default().Limits.WriteTimeout, c.Limits.WriteTimeout)
+
+	// the file can also be set with an environment variable
+	c, err = Load(nil, env(map[string]string{"VERISART_CONFIG": path}), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, ":8000", c.Addr)
+}
+
+func TestLoadYAML(t *testing.T) {
+	path, cleanup := writeFile(t, "config.yml", `
+addr: ":8000"
+store:
+  path: ./verisart.json
+cors:
+  allowedOrigins:
+    - https://gallery.example.com
+limits:
+  readTimeout: 5s
+  maxBodyBytes: 1024
+expiry:
+  transferTTL: 48h
+`)
+	defer cleanup()
+
+	c, err := Load([]string{"-config", path}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+
+	assert.Equal(t, ":8000", c.Addr)
+	assert.Equal(t, Store{Backend: FileBackend, Path: "./verisart.json"}, c.Store)
+	assert.Equal(t, []string{"https://gallery.example.com"}, c.CORS.AllowedOrigins)
+	assert.Equal(t, Duration(5*time.Second), c.Limits.ReadTimeout)
+	assert.Equal(t, int64(1024), c.Limits.MaxBodyBytes)
+	assert.Equal(t, Duration(48*time.Hour), c.Expiry.TransferTTL)
+	assert.Equal(t, Default().Expiry.InvitationTTL, c.Expiry.InvitationTTL)
+}
+
+func TestLoadExpiry(t *testing.T) {
+	c, err := Load(
+		[]string{"-transfer-ttl", "72h", "-sweep-interval", "30s"},
+		env(map[string]string{"VERISART_INVITATION_TTL": "24h"}),
+		ioutil.Discard,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, Expiry{
+		TransferTTL:   Duration(72 * time.Hour),
+		InvitationTTL: Duration(24 * time.Hour),
+		SweepInterval: Duration(30 * time.Second),
+	}, c.Expiry)
+
+	// transfers can be configured to never expire
+	c, err = Load([]string{"-transfer-ttl", "0s"}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, Duration(0), c.Expiry.TransferTTL)
+}
+
+func TestLoadStoreBackend(t *testing.T) {
+	c, err := Load([]string{"-data", "data.json"}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, Store{Backend: FileBackend, Path: "data.json"}, c.Store)
+	// the file backend keeps its signing key next to the data file
+	assert.Equal(t, "data-key.pem", c.SigningKey)
+
+	c, err = Load([]string{"-data", "data.json", "-key", "key.pem"}, env(nil), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, "key.pem", c.SigningKey)
+
+	_, err = Load([]string{"-store", "memory", "-data", "data.json"}, env(nil), ioutil.Discard)
+	assert.EqualError(t, err, "invalid configuration: store.path: can only be set with the file backend")
+
+	_, err = Load([]string{"-store", "file"}, env(nil), ioutil.Discard)
+	assert.EqualError(t, err, "invalid configuration: store.path: is required")
+}
+
+func TestLoadAdmins(t *testing.T) {
+	c, err := Load(
+		[]string{"-admins", "ann@email.com, joe@email.com", "-smtp-addr", "localhost:25", "-mail-from", "noreply@verisart.com"},
+		env(nil),
+		ioutil.Discard,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ann@email.com", "joe@email.com"}, c.Admins)
+}
+
+func TestLoadMail(t *testing.T) {
+	c, err := Load(
+		[]string{"-smtp-addr", "mail.example.com:587", "-mail-from", "noreply@verisart.com"},
+		env(map[string]string{"VERISART_SMTP_USERNAME": "verisart", "VERISART_SMTP_PASSWORD": "s3cr3t"}),
+		ioutil.Discard,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, Mail{SMTPAddr: "mail.example.com:587", From: "noreply@verisart.com", Username: "verisart", Password: "s3cr3t"}, c.Mail)
+	assert.True(t, c.Mail.Enabled())
+}
+
+func TestLoadErrors(t *testing.T) {
+	yamlPath, cleanup := writeFile(t, "config.yaml", "addr: [:8000")
+	defer cleanup()
+
+	unknownYAMLPath, cleanup := writeFile(t, "config.yaml", "port: 8000")
+	defer cleanup()
+
+	unknownPath, cleanup := writeFile(t, "config.json", `{"port": 8000}`)
+	defer cleanup()
+
+	tests := []struct {
+		args []string
+		env  map[string]string
+		err  string
+	}{
+		{[]string{"-config", yamlPath}, nil, "could not parse configuration file"},
+		{[]string{"-config", unknownYAMLPath}, nil, `unknown field "port"`},
+		{[]string{"-config", unknownPath}, nil, `unknown field "port"`},
+		{[]string{"-read-timeout", "soon"}, nil, `invalid -read-timeout flag: "soon" is not a duration`},
+		{nil, map[string]string{"VERISART_MAX_BODY_BYTES": "1MB"}, `invalid VERISART_MAX_BODY_BYTES: "1MB" is not an integer`},
+		{[]string{"-addr", "localhost"}, nil, "addr: must be a host and port, such as :9091"},
+		{[]string{"-cors-origins", "example.com"}, nil, `cors.allowedOrigins: "example.com" is not '*' or an http(s) origin`},
+		{[]string{"-tls-cert", "cert.pem"}, nil, "tls.certFile: must be an existing file; tls.keyFile: is required"},
+		{[]string{"-log-level", "verbose"}, nil, "logLevel: must be 'debug', 'info', 'warn' or 'error'"},
+		{[]string{"-shutdown-timeout", "0s"}, nil, "limits.shutdownTimeout: must be positive"},
+		{[]string{"-transfer-ttl", "-1h", "-invitation-ttl", "-1h", "-sweep-interval", "0s"}, nil,
+			"expiry.transferTTL: cannot be negative; expiry.invitationTTL: must be positive; expiry.sweepInterval: must be positive"},
+		{nil, map[string]string{"VERISART_ADMINS": "admin@email.com, admin"}, "admins: must be a valid email address"},
+		{[]string{"-admins", "admin@email.com"}, nil, "admins: require a mail server to verify their addresses"},
+		{[]string{"-smtp-addr", "localhost"}, nil, "mail.smtpAddr: must be a host and port, such as localhost:25; mail.from: is required"},
+		{[]string{"-mail-from", "noreply@verisart.com"}, nil, "mail.smtpAddr: is required to deliver mail"},
+		{[]string{"-smtp-addr", "localhost:25", "-mail-from", "noreply@verisart.com", "-smtp-password", "s3cr3t"}, nil, "mail.username: is required with a password"},
+		{[]string{"extra"}, nil, "unexpected arguments: extra"},
+	}
+
+	for _, test := range tests {
+		_, err := Load(test.args, env(test.env), ioutil.Discard)
+		if assert.NotNil(t, err, test.err) {
+			assert.True(t, strings.Contains(err.Error(), test.err), err.Error())
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	c := Default()
+	c.SigningKey = "/secrets/key.pem"
+	c.TLS = TLS{CertFile: "/certs/cert.pem", KeyFile: "/secrets/tls-key.pem"}
+	c.Mail = Mail{SMTPAddr: "localhost:25", From: "noreply@verisart.com", Username: "verisart", Password: "s3cr3t"}
+
+	assert.JSONEq(t, `{
+		"addr": ":9091",
+		"store": {"backend": "", "path": ""},
+		"signingKey": "<redacted>",
+		"cors": {"allowedOrigins": ["*"]},
+		"tls": {"certFile": "/certs/cert.pem", "keyFile": "<redacted>"},
+		"limits": {"maxBodyBytes": 1048576, "readTimeout": "30s", "writeTimeout": "30s", "shutdownTimeout": "10s"},
+		"expiry": {"transferTTL": "720h0m0s", "invitationTTL": "168h0m0s", "sweepInterval": "1m0s"},
+		"mail": {"smtpAddr": "localhost:25", "from": "noreply@verisart.com", "username": "verisart", "password": "<redacted>"},
+		"logLevel": "info"
+	}`, c.String())
+
+	// redacting does not change the configuration
+	assert.Equal(t, "/secrets/key.pem", c.SigningKey)
+	assert.Equal(t, "s3cr3t", c.Mail.Password)
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix prefixes the names of the environment variables read by Load.
+const EnvPrefix = "VERISART_"
+
+// setting describes a configuration value that can be set with a
+// command-line flag and an environment variable.
+type setting struct {
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+// env returns the name of the environment variable of the setting, such
+// as VERISART_CORS_ORIGINS for the cors-origins flag.
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(s.flag, "-", "_", -1))
+}
+
+var settings = []setting{
+	{"addr", "address the server listens on", func(c *Config, v string) error {
+		c.Addr = v
+		return nil
+	}},
+	{"store", "store backend: memory or file. Defaults to file when a data file is set", func(c *Config, v string) error {
+		c.Store.Backend = v
+		return nil
+	}},
+	{"data", "path of the file used to persist data by the file backend", func(c *Config, v string) error {
+		c.Store.Path = v
+		return nil
+	}},
+	{"key", "path of the file holding the key used to sign certificates. The key is created if the file does not exist. Defaults to a file next to the data file with the file backend, otherwise to a new key generated at every start", func(c *Config, v string) error {
+		c.SigningKey = v
+		return nil
+	}},
+	{"cors-origins", "comma separated list of the origins allowed to send cross-origin requests, or * for any origin", func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"tls-cert", "path of the TLS certificate file. The server serves https when set", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "path of the TLS private key file", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"log-level", "minimum level of logged messages: debug, info, warn or error", func(c *Config, v string) error {
+		c.LogLevel = v
+		return nil
+	}},
+	{"admins", "comma separated list of the email addresses of the users who are made admins once verified", func(c *Config, v string) error {
+		c.Admins = splitList(v)
+		return nil
+	}},
+	{"smtp-addr", "host and port of the mail server delivering the messages sent to users. If empty messages are logged with their tokens redacted", func(c *Config, v string) error {
+		c.Mail.SMTPAddr = v
+		return nil
+	}},
+	{"mail-from", "address the messages sent to users are sent from", func(c *Config, v string) error {
+		c.Mail.From = v
+		return nil
+	}},
+	{"smtp-username", "username authenticating with the mail server", func(c *Config, v string) error {
+		c.Mail.Username = v
+		return nil
+	}},
+	{"smtp-password", "password authenticating with the mail server", func(c *Config, v string) error {
+		c.Mail.Password = v
+		return nil
+	}},
+	{"max-body-bytes", "maximum size of request payloads in bytes", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		c.Limits.MaxBodyBytes = n
+		return nil
+	}},
+	{"read-timeout", "maximum time spent reading a request, such as 30s", durationSetter(func(c *Config) *Duration { return &c.Limits.ReadTimeout })},
+	{"write-timeout", "maximum time spent writing a response, such as 30s", durationSetter(func(c *Config) *Duration { return &c.Limits.WriteTimeout })},
+	{"shutdown-timeout", "maximum time waited for active requests when shutting down, such as 10s", durationSetter(func(c *Config) *Duration { return &c.Limits.ShutdownTimeout })},
+	{"transfer-ttl", "time transactions created without an expiry stay pending, such as 720h. If 0 they never expire", durationSetter(func(c *Config) *Duration { return &c.Expiry.TransferTTL })},
+	{"invitation-ttl", "time recipients who are not users have to claim a transaction, such as 168h", durationSetter(func(c *Config) *Duration { return &c.Expiry.InvitationTTL })},
+	{"sweep-interval", "how often overdue transfers are looked for, such as 1m", durationSetter(func(c *Config) *Duration { return &c.Expiry.SweepInterval })},
+}
+
+func durationSetter(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", v)
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+// splitList splits a comma separated list, ignoring blank items.
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Load returns the configuration set by the command-line arguments args,
+// excluding the program name, and the environment variables returned by
+// getenv. The path of the configuration file is set with the -config
+// flag or the VERISART_CONFIG environment variable.
+//
+// Flags take precedence over environment variables, which take
+// precedence over the configuration file, which takes precedence over
+// the defaults. The returned configuration is validated.
+func Load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	fs := flag.NewFlagSet("verisart", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configFile := fs.String("config", "", "path of the YAML or JSON configuration file. Environment variable "+EnvPrefix+"CONFIG")
+	values := make([]*string, len(settings))
+	for i, s := range settings {
+		values[i] = fs.String(s.flag, "", s.usage+". Environment variable "+s.env())
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	c := Default()
+
+	path := getenv(EnvPrefix + "CONFIG")
+	if setFlags["config"] {
+		path = *configFile
+	}
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if v := getenv(s.env()); v != "" {
+			if err := s.set(&c, v); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %s", s.env(), err.Error())
+			}
+		}
+	}
+
+	for i, s := range settings {
+		if setFlags[s.flag] {
+			if err := s.set(&c, *values[i]); err != nil {
+				return Config{}, fmt.Errorf("invalid -%s flag: %s", s.flag, err.Error())
+			}
+		}
+	}
+
+	if c.Store.Backend == "" {
+		c.Store.Backend = MemoryBackend
+		if c.Store.Path != "" {
+			c.Store.Backend = FileBackend
+		}
+	}
+
+	// certificates persisted by the file backend must be verifiable with
+	// the same key once the application restarts
+	if c.Store.Backend == FileBackend && c.SigningKey == "" && c.Store.Path != "" {
+		c.SigningKey = DefaultKeyPath(c.Store.Path)
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %s", err.Error())
+	}
+
+	return c, nil
+}
+
+// DefaultKeyPath returns the path of the signing key used with the data
+// file at dataPath when no key file is set, such as data/verisart-key.pem
+// for data/verisart.json.
+func DefaultKeyPath(dataPath string) string {
+	return strings.TrimSuffix(dataPath, filepath.Ext(dataPath)) + "-key.pem"
+}
+
+// readFile sets the settings found in the configuration file at path,
+// which is read as YAML when its extension is .yaml or .yml and as JSON
+// otherwise. Settings missing from the file are unchanged.
+func (c *Config) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read configuration file: %s", err.Error())
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return fmt.Errorf("could not parse configuration file %s: %s", path, err.Error())
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("could not parse configuration file %s: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that YAML files are
+// decoded, and checked for unknown settings, like JSON files are.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+
+	value, err := jsonValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// jsonValue converts a value decoded from YAML, whose mappings can have
+// keys of any type, to a value that can be encoded to JSON.
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("setting names must be strings, found %v", key)
+			}
+			value, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = value
+		}
+		return m, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
+)
+
+// Authenticate returns a middleware that resolves the user sending a
+// request from the bearer token found in its Authorization header. The
+// user is added to the request context, where handlers can retrieve it
+// with users.FromContext.
+// Requests without an Authorization header are passed on unchanged, while
+// requests carrying an invalid token are rejected.
+func Authenticate(s store.Storer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := strings.TrimPrefix(header, "Bearer ")
+			if token == header || token == "" {
+				writeError(w, newHTTPError(http.StatusUnauthorized, "the Authorization header must contain a bearer token"))
+				return
+			}
+
+			u, err := s.Authenticate(r.Context(), token)
+			if err != nil {
+				writeError(w, newHTTPError(http.StatusUnauthorized, "invalid API token"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(users.NewContext(r.Context(), u)))
+		})
+	}
+}
+
+// authenticatedUser returns the user that sent the request, or an error
+// if the request was not authenticated.
+func authenticatedUser(r *http.Request) (*users.User, *HTTPError) {
+	u, ok := users.FromContext(r.Context())
+	if !ok {
+		return nil, newHTTPError(http.StatusUnauthorized, "authentication required. Please provide a bearer token in the Authorization header")
+	}
+
+	return u, nil
+}
+
+// requirePermission returns a 403 HTTPError with message msg unless the
+// role of u grants one of perms.
+func requirePermission(u *users.User, msg string, perms ...users.Permission) *HTTPError {
+	for _, p := range perms {
+		if u.Can(p) {
+			return nil
+		}
+	}
+
+	return newHTTPError(http.StatusForbidden, msg)
+}
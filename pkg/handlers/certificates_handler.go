@@ -2,41 +2,93 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"goji.io/pat"
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/organizations"
 	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
 )
 
+// collectorsForbidden is the error message returned when collectors try
+// to edit certificates.
+const collectorsForbidden = "collectors can only receive and transfer certificates"
+
+// newCertRequest is the payload of requests creating certificates.
+type newCertRequest struct {
+	Title    string `json:"title"`
+	Year     int    `json:"year"`
+	Note     string `json:"note"`
+	ArtistID string `json:"artistId"`
+
+	// OrganizationID is the ID of the organization owning the
+	// certificate. Certificates are owned by the user creating them
+	// when it is empty.
+	OrganizationID string `json:"organizationId"`
+}
+
+// certificate returns the certificate described by the request.
+func (req newCertRequest) certificate() cert.Certificate {
+	return cert.Certificate{
+		Title:    req.Title,
+		Year:     req.Year,
+		Note:     req.Note,
+		ArtistID: req.ArtistID,
+	}
+}
+
+// Validate checks the fields of the new certificate at the time now.
+func (req newCertRequest) Validate(now time.Time) error {
+	return req.certificate().Validate(now)
+}
+
 // PostCertHandler accepts requests dealing with the creation of
-// new certificates
+// new certificates. Artists issue certificates for their own works while
+// galleries must set the ID of one of the artists they represent.
+// Certificates can be issued on behalf of an organization by its members
+// allowed to edit its certificates.
 func PostCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
 
-	// parse payload
-	decoder := json.NewDecoder(r.Body)
-	newCert := cert.Certificate{}
-
-	err := decoder.Decode(&newCert)
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	if httpErr := requirePermission(user, "only artists and galleries can issue certificates", users.IssueCertificates); httpErr != nil {
+		return httpErr
 	}
 
-	// get user from header.
-	// Here we simply read it from the Authorization header.
-	userID := r.Header.Get("X-User-Email")
+	// parse payload
+	req := newCertRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
 
-	if userID == "" {
-		return newHTTPError(http.StatusUnprocessableEntity, "user must be set in the X-User-Email header")
+	// certificates are owned by the user creating them, unless they are
+	// issued on behalf of an organization
+	newCert := req.certificate()
+	newCert.OwnerID = user.ID
+	if req.OrganizationID != "" {
+		newCert.OwnerID = req.OrganizationID
 	}
 
-	newCert.OwnerID = userID
+	if newCert.ArtistID == "" && user.Role == users.Artist {
+		newCert.ArtistID = user.ID
+	}
+	if newCert.ArtistID == "" {
+		return newHTTPError(http.StatusUnprocessableEntity, "galleries must set the ID of the artist of the certificate")
+	}
+	if !user.CanIssueFor(newCert.ArtistID) {
+		return newHTTPError(http.StatusForbidden, "artists can only issue certificates for their own works and galleries for the artists they represent")
+	}
 
 	// update storer
-	savedCert, err := s.CreateCert(newCert)
+	savedCert, err := s.CreateCert(r.Context(), user.ID, newCert)
 	if err != nil {
-		return newHTTPError(http.StatusBadRequest, err.Error())
+		return storeError(err)
 	}
 
 	// return new cert
@@ -56,26 +108,64 @@ func PostCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HT
 	return nil
 }
 
+// GetCertHandler accepts requests dealing with the retrieval of
+// a single certificate. Certificates owned by an organization are only
+// shown to the members allowed to view them.
+func GetCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	certID := pat.Param(r, "id")
+
+	c, err := s.GetCert(r.Context(), certID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	if httpErr := requireViewPermission(s, r, c.OwnerID); httpErr != nil {
+		return httpErr
+	}
+
+	resp, err := json.Marshal(c)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
 // PatchCertHandler accepts requests dealing with the updating of
 // exisitng certificates
 func PatchCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
 	w.Header().Set("Content-Type", "application/json")
 
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
 	certID := pat.Param(r, "id")
 
-	// parse payload
-	decoder := json.NewDecoder(r.Body)
-	toUpdate := cert.Certificate{}
+	if httpErr := requireEditPermission(s, r, user, certID); httpErr != nil {
+		return httpErr
+	}
 
-	err := decoder.Decode(&toUpdate)
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	// parse payload. The payload is a JSON merge patch, only the
+	// fields it contains are updated.
+	patch := cert.Patch{}
+	if httpErr := decodeJSON(w, r, &patch); httpErr != nil {
+		return httpErr
 	}
 
 	// update storer
-	updatedCert, err := s.UpdateCert(certID, toUpdate)
+	updatedCert, err := s.UpdateCert(r.Context(), user.ID, certID, patch)
 	if err != nil {
-		return newHTTPError(http.StatusUnprocessableEntity, err.Error())
+		return storeError(err)
 	}
 
 	// return new cert
@@ -100,15 +190,75 @@ func PatchCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *H
 func DeleteCertHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
 	w.Header().Set("Content-Type", "application/json")
 
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
 	certID := pat.Param(r, "id")
 
+	if httpErr := requireEditPermission(s, r, user, certID); httpErr != nil {
+		return httpErr
+	}
+
 	// update storer
-	err := s.DeleteCert(certID)
+	err := s.DeleteCert(r.Context(), user.ID, certID)
 	if err != nil {
-		return newHTTPError(http.StatusNotFound, err.Error())
+		return storeError(err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 
 	return nil
 }
+
+// requireEditPermission returns a 403 HTTPError unless the role of u
+// allows editing certificates or the certificate identified by certID is
+// owned by an organization. Whether u owns the certificate, or was
+// allowed to edit it by the organization owning it, is checked by the
+// store.
+func requireEditPermission(s store.Storer, r *http.Request, u *users.User, certID string) *HTTPError {
+	if u.Can(users.EditCertificates) || u.Can(users.ModerateCertificates) {
+		return nil
+	}
+
+	c, err := s.GetCert(r.Context(), certID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	_, err = s.GetOrganization(r.Context(), c.OwnerID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newHTTPError(http.StatusForbidden, collectorsForbidden)
+	}
+	if err != nil {
+		return storeError(err)
+	}
+
+	return nil
+}
+
+// requireViewPermission returns an HTTPError unless the request can read
+// the certificates owned by ownerID. The certificates of users are public,
+// while those of an organization are only shown to the authenticated
+// members it allowed to view them.
+func requireViewPermission(s store.Storer, r *http.Request, ownerID string) *HTTPError {
+	o, err := s.GetOrganization(r.Context(), ownerID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return storeError(err)
+	}
+
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !o.Can(user.ID, organizations.View) {
+		return newHTTPError(http.StatusForbidden, "only the members allowed to view the certificates of an organization can see them")
+	}
+
+	return nil
+}
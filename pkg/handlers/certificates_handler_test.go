@@ -6,20 +6,30 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	goji "goji.io"
 	"goji.io/pat"
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/ids"
+	mocks "github.com/Popcore/verisart/pkg/mocks"
 	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
 )
 
 func TestPostCertHandlerOK(t *testing.T) {
-	memStore := store.NewMemStore()
-	memStore.NewUser("user@email.com", "joe blog")
+	now, _ := time.Parse(time.RFC3339, "2018-11-21T12:00:00Z")
+	memStore := store.NewMemStore(
+		store.WithClock(clock.NewFake(now)),
+		store.WithIDGenerator(&ids.Sequence{}),
+	)
+	_, token := newTestArtist(t, memStore, "user@email.com")
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
 
 	input := `{
@@ -29,21 +39,36 @@ func TestPostCertHandlerOK(t *testing.T) {
 	}`
 
 	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(input))
-	req.Header.Set("X-User-Email", "user@email.com")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
+	// the first ID of the sequence identifies the user
+	expected := `{
+	  "id": "00000000-0000-0000-0000-000000000002",
+	  "title": "my-thing",
+	  "createdAt": "2018-11-21T12:00:00Z",
+	  "ownerId": "00000000-0000-0000-0000-000000000001",
+	  "year": 1998,
+	  "note": "some notes",
+	  "transfer": null,
+	  "artistId": "00000000-0000-0000-0000-000000000001",
+	  "issuer": {"role": "artist", "userId": "00000000-0000-0000-0000-000000000001"}
+	}`
+
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
 }
 
 func TestPostCertHandlerInvalidJSON(t *testing.T) {
 	memStore := store.NewMemStore()
-	memStore.NewUser("user@email.com", "joe blog")
+	_, token := newTestArtist(t, memStore, "user@email.com")
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
 
 	input := `{
@@ -52,12 +77,13 @@ func TestPostCertHandlerInvalidJSON(t *testing.T) {
 	}`
 
 	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(input))
-	req.Header.Set("X-User-Email", "user@email.com")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
 	expected := `{
 	  "error": "invalid json payload",
+	  "code": "bad_request",
 	  "httpStatus": 400
 	}`
 
@@ -70,8 +96,10 @@ func TestPostCertHandlerInvalidJSON(t *testing.T) {
 
 func TestPostCertHandlerInvalidCert(t *testing.T) {
 	memStore := store.NewMemStore()
+	_, token := newTestArtist(t, memStore, "user@email.com")
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
 
 	input := `{
@@ -82,20 +110,21 @@ func TestPostCertHandlerInvalidCert(t *testing.T) {
 	}`
 
 	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(input))
-	req.Header.Set("X-User-Email", "abc")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
 }
 
 func TestPostCertHandlerErrorNoUser(t *testing.T) {
 	memStore := store.NewMemStore()
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
 
 	input := `{
@@ -105,8 +134,9 @@ func TestPostCertHandlerErrorNoUser(t *testing.T) {
 	}`
 
 	expected := `{
-	  "error": "user must be set in the X-User-Email header",
-	  "httpStatus": 422
+	  "error": "authentication required. Please provide a bearer token in the Authorization header",
+	  "code": "unauthorized",
+	  "httpStatus": 401
 	}
 	`
 
@@ -116,23 +146,23 @@ func TestPostCertHandlerErrorNoUser(t *testing.T) {
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
 	assert.JSONEq(t, expected, recorder.Body.String())
 }
 
 func TestPatchCertHandlerOK(t *testing.T) {
 	memStore := store.NewMemStore()
-	_, err := memStore.NewUser("user@email.com", "joe blog")
-	assert.Nil(t, err)
+	user, token := newTestArtist(t, memStore, "user@email.com")
 
-	toUpdate, err := memStore.CreateCert(cert.Certificate{
-		OwnerID: "user@email.com",
+	toUpdate, err := memStore.CreateCert(ctx, user.ID, cert.Certificate{
+		OwnerID: user.ID,
 		Title:   "my cert",
 		Year:    2018,
 	})
 	assert.Nil(t, err)
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
 
 	input := `{
@@ -142,7 +172,7 @@ func TestPatchCertHandlerOK(t *testing.T) {
 	}`
 
 	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/%s", toUpdate.ID), strings.NewReader(input))
-	req.Header.Set("X-User-Email", "user@email.com")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
@@ -154,22 +184,23 @@ func TestPatchCertHandlerOK(t *testing.T) {
 
 func TestPatchCertHandlerInvalidJSON(t *testing.T) {
 	memStore := store.NewMemStore()
-	memStore.NewUser("user@email.com", "joe blog")
+	user, token := newTestArtist(t, memStore, "user@email.com")
 
-	toUpdate, err := memStore.CreateCert(cert.Certificate{
-		OwnerID: "user@email.com",
+	toUpdate, err := memStore.CreateCert(ctx, user.ID, cert.Certificate{
+		OwnerID: user.ID,
 		Title:   "my cert",
 		Year:    2018,
 	})
 	assert.Nil(t, err)
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
 
 	input := `this-is-not-valid-json`
 
 	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/%s", toUpdate.ID), strings.NewReader(input))
-	req.Header.Set("X-User-Email", "abc")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
@@ -181,8 +212,10 @@ func TestPatchCertHandlerInvalidJSON(t *testing.T) {
 
 func TestPatchCertHandlerInvalidCertID(t *testing.T) {
 	memStore := store.NewMemStore()
+	_, token := newTestArtist(t, memStore, "user@email.com")
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
 
 	input := `{
@@ -192,37 +225,356 @@ func TestPatchCertHandlerInvalidCertID(t *testing.T) {
 	}`
 
 	req, err := http.NewRequest("PATCH", "/certificates/i-dont-exists", strings.NewReader(input))
-	req.Header.Set("X-User-Email", "abc")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	assert.Nil(t, err)
 
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
 }
 
 func TestDeleteCertHandlerOK(t *testing.T) {
 	memStore := store.NewMemStore()
-	memStore.NewUser("user@email.com", "joe blog")
+	user, token := newTestArtist(t, memStore, "user@email.com")
 
-	toDelete, err := memStore.CreateCert(cert.Certificate{
-		OwnerID: "user@email.com",
+	toDelete, err := memStore.CreateCert(ctx, user.ID, cert.Certificate{
+		OwnerID: user.ID,
 		Title:   "my cert",
 		Year:    2018,
 	})
 	assert.Nil(t, err)
 
 	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
 	mux.Handle(pat.Delete("/certificates/:id"), Handler{S: memStore, H: DeleteCertHandler})
 
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("/certificates/%s", toDelete.ID), nil)
-	req.Header.Set("X-User-Email", "abc")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestPostCertHandlerErrorInvalidToken(t *testing.T) {
+	memStore := store.NewMemStore()
+	user, _ := newTestArtist(t, memStore, "user@email.com")
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
+
+	input := `{
+		"title": "my-thing",
+		"year": 1998
+	}`
+
+	expected := `{
+	  "error": "invalid API token",
+	  "code": "unauthorized",
+	  "httpStatus": 401
+	}`
+
+	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(input))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer not-a-valid-token")
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+
+	// the header must use the bearer scheme
+	req, err = http.NewRequest("POST", "/certificates", strings.NewReader(input))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "not-a-bearer-token")
+
+	recorder = httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	certs, err := memStore.GetCerts(ctx, user.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 0)
+}
+
+func TestPatchAndDeleteCertHandlerErrorNotOwner(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner, _ := newTestArtist(t, memStore, "owner@email.com")
+	_, token := newTestArtist(t, memStore, "someone-else@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner.ID, cert.Certificate{
+		OwnerID: owner.ID,
+		Title:   "my cert",
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
+	mux.Handle(pat.Delete("/certificates/:id"), Handler{S: memStore, H: DeleteCertHandler})
+
+	input := `{
+		"title": "my new thing",
+		"year": 2018
+	}`
+
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/%s", created.ID), strings.NewReader(input))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	expected := `{
+		"httpStatus": 403,
+		"code": "forbidden",
+		"error": "only the certificate owner can update a certificate"
+	}`
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("/certificates/%s", created.ID), nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	recorder = httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// the certificate is unchanged
+	certs, err := memStore.GetCerts(ctx, owner.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, "my cert", certs[0].Title)
+}
+
+func TestGetCertHandlerOK(t *testing.T) {
+	createdAt, _ := time.Parse(time.RFC3339, "2018-11-21T12:00:00Z")
+
+	mux := goji.NewMux()
+	memStore := mocks.MockStore{
+		Cert: cert.Certificate{
+			ID:        "123abc",
+			Title:     "the-cert-title",
+			OwnerID:   "the-user-id",
+			CreatedAt: createdAt,
+			Year:      2001,
+			Note:      "some notes",
+		},
+	}
+	mux.Handle(pat.Get("/certificates/:id"), Handler{S: memStore, H: GetCertHandler})
+
+	expected := `{
+		"id": "123abc",
+		"title": "the-cert-title",
+		"ownerId": "the-user-id",
+		"year" : 2001,
+		"note": "some notes",
+		"createdAt": "2018-11-21T12:00:00Z",
+		"transfer": null
+	}`
+
+	req, err := http.NewRequest("GET", "/certificates/123abc", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
+
+func TestGetCertHandlerErrorNotFound(t *testing.T) {
+	memStore := store.NewMemStore()
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id"), Handler{S: memStore, H: GetCertHandler})
+
+	expected := `{
+		"httpStatus": 404,
+		"code": "not_found",
+		"error": "certificate not found. Please use a valid ID"
+	}`
+
+	req, err := http.NewRequest("GET", "/certificates/i-dont-exist", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
+
+func TestPatchCertHandlerMergePatch(t *testing.T) {
+	memStore := store.NewMemStore()
+	user, token := newTestArtist(t, memStore, "user@email.com")
+
+	toUpdate, err := memStore.CreateCert(ctx, user.ID, cert.Certificate{
+		OwnerID: user.ID,
+		Title:   "my cert",
+		Year:    2018,
+		Note:    "some notes",
+	})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
+
+	url := fmt.Sprintf("/certificates/%s", toUpdate.ID)
+
+	tests := []struct {
+		input    string
+		expected int
+		title    string
+		year     int
+		note     string
+	}{
+		// only the title changes
+		{`{"title": "my new title"}`, http.StatusOK, "my new title", 2018, "some notes"},
+		// null removes the note
+		{`{"note": null, "year": 1998}`, http.StatusOK, "my new title", 1998, ""},
+		// read only fields cannot be patched
+		{`{"ownerId": "someone-else@email.com"}`, http.StatusUnprocessableEntity, "my new title", 1998, ""},
+		{`{"title": null}`, http.StatusUnprocessableEntity, "my new title", 1998, ""},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("PATCH", url, strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.expected, recorder.Code, test.input)
+
+		got, err := memStore.GetCert(ctx, toUpdate.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, test.title, got.Title)
+		assert.Equal(t, test.year, got.Year)
+		assert.Equal(t, test.note, got.Note)
+		assert.Equal(t, user.ID, got.OwnerID)
+	}
+}
+
+func TestPostCertHandlerRoles(t *testing.T) {
+	memStore := store.NewMemStore(store.WithIDGenerator(&ids.Sequence{}))
+	artist, artistToken := newTestArtist(t, memStore, "artist@email.com")
+	other, _ := newTestArtist(t, memStore, "other@email.com")
+	gallery, galleryToken := newTestUser(t, memStore, "gallery@email.com")
+	_, collectorToken := newTestUser(t, memStore, "collector@email.com")
+
+	_, err := memStore.AssignRole(ctx, gallery.ID, users.RoleAssignment{Role: users.Gallery, Represents: []string{artist.ID}})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
+
+	tests := []struct {
+		name     string
+		token    string
+		input    string
+		code     int
+		expected string
+	}{
+		{"collector", collectorToken, `{"title": "my-thing", "year": 1998}`, http.StatusForbidden,
+			`{"httpStatus": 403, "code": "forbidden", "error": "only artists and galleries can issue certificates"}`},
+		{"artist for another artist", artistToken, `{"title": "my-thing", "year": 1998, "artistId": "` + other.ID + `"}`, http.StatusForbidden,
+			`{"httpStatus": 403, "code": "forbidden", "error": "artists can only issue certificates for their own works and galleries for the artists they represent"}`},
+		{"gallery without artist", galleryToken, `{"title": "my-thing", "year": 1998}`, http.StatusUnprocessableEntity,
+			`{"httpStatus": 422, "code": "validation_failed", "error": "galleries must set the ID of the artist of the certificate"}`},
+		{"gallery for an artist it does not represent", galleryToken, `{"title": "my-thing", "year": 1998, "artistId": "` + other.ID + `"}`, http.StatusForbidden,
+			`{"httpStatus": 403, "code": "forbidden", "error": "artists can only issue certificates for their own works and galleries for the artists they represent"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/certificates", strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.name)
+		assert.JSONEq(t, test.expected, recorder.Body.String(), test.name)
+	}
+
+	// galleries issue certificates on behalf of the artists they
+	// represent and own them
+	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(`{"title": "my-thing", "year": 1998, "artistId": "`+artist.ID+`"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+galleryToken)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	certs, err := memStore.GetCerts(ctx, gallery.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, artist.ID, certs[0].ArtistID)
+		assert.Equal(t, &cert.Issuer{Role: "gallery", UserID: gallery.ID}, certs[0].Issuer)
+	}
+}
 
+func TestPatchAndDeleteCertHandlerRoles(t *testing.T) {
+	memStore := store.NewMemStore()
+	artist, _ := newTestArtist(t, memStore, "artist@email.com")
+	collector, collectorToken := newTestUser(t, memStore, "collector@email.com")
+	_, adminToken := newTestAdmin(t, memStore, "admin@email.com")
+
+	owned, err := memStore.CreateCert(ctx, collector.ID, cert.Certificate{OwnerID: collector.ID, ArtistID: artist.ID, Title: "my cert", Year: 2018})
 	assert.Nil(t, err)
 
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: memStore, H: PatchCertHandler})
+	mux.Handle(pat.Delete("/certificates/:id"), Handler{S: memStore, H: DeleteCertHandler})
+
+	// collectors cannot edit the certificates they own
+	for _, method := range []string{"PATCH", "DELETE"} {
+		req, err := http.NewRequest(method, "/certificates/"+owned.ID, strings.NewReader(`{"title": "my new thing"}`))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+collectorToken)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusForbidden, recorder.Code, method)
+		assert.JSONEq(t, `{"httpStatus": 403, "code": "forbidden", "error": "collectors can only receive and transfer certificates"}`, recorder.Body.String(), method)
+	}
+
+	// admins moderate certificates they do not own
+	req, err := http.NewRequest("PATCH", "/certificates/"+owned.ID, strings.NewReader(`{"title": "a moderated title"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
 	recorder := httptest.NewRecorder()
 
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	req, err = http.NewRequest("DELETE", "/certificates/"+owned.ID, nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	recorder = httptest.NewRecorder()
+
 	mux.ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusNoContent, recorder.Code)
 }
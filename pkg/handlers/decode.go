@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+// maxPayloadBytes is the maximum size of request payloads, unless a
+// different limit is set with LimitPayload.
+const maxPayloadBytes = 1 << 20
+
+// payloadLimitKey is the context key of the maximum size of request
+// payloads.
+type payloadLimitKey struct{}
+
+// LimitPayload returns a middleware that sets the maximum size of the
+// request payloads decoded by handlers to n bytes.
+func LimitPayload(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), payloadLimitKey{}, n)))
+		})
+	}
+}
+
+// payloadLimit returns the maximum size of the payload of r.
+func payloadLimit(r *http.Request) int64 {
+	if n, ok := r.Context().Value(payloadLimitKey{}).(int64); ok {
+		return n
+	}
+
+	return maxPayloadBytes
+}
+
+// clockKey is the context key of the clock handlers read the current
+// time from.
+type clockKey struct{}
+
+// UseClock returns a middleware that makes handlers read the current
+// time from c, which should be the clock of the store, when they
+// validate request payloads.
+func UseClock(c clock.Clock) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clockKey{}, c)))
+		})
+	}
+}
+
+// requestTime returns the current time according to the clock of r.
+func requestTime(r *http.Request) time.Time {
+	if c, ok := r.Context().Value(clockKey{}).(clock.Clock); ok {
+		return c.Now()
+	}
+
+	return clock.Real{}.Now()
+}
+
+// validator is implemented by request payloads that can check their
+// own fields.
+type validator interface {
+	Validate() error
+}
+
+// timedValidator is implemented by request payloads whose checks depend
+// on the current time, such as expiries that must be in the future.
+type timedValidator interface {
+	Validate(now time.Time) error
+}
+
+// decodeJSON decodes the JSON payload of a request into v. Payloads
+// containing fields v does not define, or followed by extra data, are
+// rejected. If v implements validator or timedValidator the decoded
+// payload is validated, the latter at the time returned by requestTime.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) *HTTPError {
+	r.Body = http.MaxBytesReader(w, r.Body, payloadLimit(r))
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return newHTTPError(http.StatusBadRequest, "the request payload must contain a single JSON object")
+	}
+
+	var err error
+	switch val := v.(type) {
+	case validator:
+		err = val.Validate()
+	case timedValidator:
+		err = val.Validate(requestTime(r))
+	}
+	if err != nil {
+		return validationError(err)
+	}
+
+	return nil
+}
+
+// decodeError returns the HTTPError describing an error returned while
+// decoding a request payload.
+func decodeError(err error) *HTTPError {
+	var (
+		typeErr *json.UnmarshalTypeError
+		sizeErr *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &sizeErr):
+		return newHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("the request payload cannot be larger than %d bytes", sizeErr.Limit))
+	case errors.As(err, &typeErr):
+		return validationError(validation.Errors{{
+			Field: typeErr.Field,
+			Msg:   fmt.Sprintf("must be a %s", jsonType(typeErr.Type)),
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// the decoder does not export a type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return validationError(validation.Errors{{Field: field, Msg: "unknown field"}})
+	default:
+		var fieldErrs validation.Errors
+		if errors.As(err, &fieldErrs) {
+			return validationError(fieldErrs)
+		}
+		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	}
+}
+
+// validationError returns the HTTPError describing the errors found
+// validating a request payload.
+func validationError(err error) *HTTPError {
+	httpErr := newHTTPError(http.StatusUnprocessableEntity, "the request payload is not valid")
+
+	if fieldErrs, ok := err.(validation.Errors); ok {
+		httpErr.Fields = fieldErrs
+	} else {
+		httpErr.Msg = err.Error()
+	}
+
+	return httpErr
+}
+
+// jsonType returns the name of the JSON type values of t are decoded from.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
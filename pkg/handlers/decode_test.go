@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		code    int
+		fields  validation.Errors
+	}{
+		{`{"title": "my-thing", "year": 1998}`, 0, nil},
+		{`{"title": "my-thing", "year": 19"}`, http.StatusBadRequest, nil},
+		{`{"title": "my-thing", "year": 1998} {}`, http.StatusBadRequest, nil},
+		{`{"title": "my-thing", "year": 1998, "color": "red"}`, http.StatusUnprocessableEntity,
+			validation.Errors{{Field: "color", Msg: "unknown field"}}},
+		{`{"title": "my-thing", "year": "1998"}`, http.StatusUnprocessableEntity,
+			validation.Errors{{Field: "year", Msg: "must be a number"}}},
+		{`{"title": "", "year": 1998}`, http.StatusUnprocessableEntity,
+			validation.Errors{{Field: "title", Msg: "is required"}}},
+		{`{"title": "` + strings.Repeat("a", maxPayloadBytes) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/certificates", strings.NewReader(test.payload))
+		w := httptest.NewRecorder()
+
+		httpErr := decodeJSON(w, r, &newCertRequest{})
+		if test.code == 0 {
+			assert.Nil(t, httpErr)
+			continue
+		}
+
+		if assert.NotNil(t, httpErr, test.payload) {
+			assert.Equal(t, test.code, httpErr.Code)
+			assert.Equal(t, test.fields, httpErr.Fields)
+		}
+	}
+}
+
+func TestDecodeJSONClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2018, time.November, 20, 12, 0, 0, 0, time.UTC))
+
+	// decode runs decodeJSON behind the UseClock middleware
+	decode := func(payload string, v interface{}) *HTTPError {
+		var httpErr *HTTPError
+		h := UseClock(fake)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpErr = decodeJSON(w, r, v)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(payload)))
+		return httpErr
+	}
+
+	transfer := `{"email": "user@email.com", "expiresAt": "2018-11-21T12:00:00Z"}`
+	cert := `{"title": "my-thing", "year": 2019}`
+
+	assert.Nil(t, decode(transfer, &newTransferRequest{}))
+	if httpErr := decode(cert, &newCertRequest{}); assert.NotNil(t, httpErr) {
+		assert.Equal(t, validation.Errors{{Field: "year", Msg: "must be between 1 and 2018"}}, httpErr.Fields)
+	}
+
+	// payloads are validated at the time of the clock, not of the system
+	fake.Set(time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	assert.Nil(t, decode(cert, &newCertRequest{}))
+	if httpErr := decode(transfer, &newTransferRequest{}); assert.NotNil(t, httpErr) {
+		assert.Equal(t, validation.Errors{{Field: "expiresAt", Msg: "must be in the future"}}, httpErr.Fields)
+	}
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/validation"
 )
 
 type handler func(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError
@@ -18,11 +21,32 @@ type Handler struct {
 }
 
 // HTTPError is the error type returned by handlers when requests cannot
-// be successfully completed. It contains the error HTTP status code and
-// an error message.
+// be successfully completed. It contains the error HTTP status code, a
+// machine readable error code and an error message.
 type HTTPError struct {
-	Code int    `json:"httpStatus"`
-	Msg  string `json:"error"`
+	Code    int    `json:"httpStatus"`
+	ErrCode string `json:"code"`
+	Msg     string `json:"error"`
+
+	// Fields lists the invalid fields of the request payload, if any.
+	Fields validation.Errors `json:"fields,omitempty"`
+
+	// err is the error returned by the store, if any. When set the HTTP
+	// status is derived from it.
+	err error
+}
+
+// errorCodes maps HTTP statuses to the error codes returned to clients.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
 }
 
 func newHTTPError(code int, msg string) *HTTPError {
@@ -32,17 +56,81 @@ func newHTTPError(code int, msg string) *HTTPError {
 	}
 }
 
+// storeError returns the HTTPError describing an error returned by
+// the store.
+func storeError(err error) *HTTPError {
+	msg := err.Error()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		msg = "the request was aborted before it completed"
+	}
+
+	return &HTTPError{
+		Msg: msg,
+		err: err,
+	}
+}
+
+// errorStatus returns the HTTP status matching the kind of a store
+// error. Errors of unknown kind are reported as internal errors.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err := h.H(h.S, w, r)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(err.Code)
+		writeError(w, err)
+	}
+}
 
-		errResp, innerErr := json.Marshal(err)
-		if innerErr != nil {
-			http.Error(w, innerErr.Error(), http.StatusInternalServerError)
-		}
+// writeError sends err to the client as a JSON object.
+func writeError(w http.ResponseWriter, err *HTTPError) {
+	if err.err != nil {
+		err.Code = errorStatus(err.err)
+	}
+
+	if err.ErrCode == "" {
+		err.ErrCode = errorCodes[err.Code]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Code)
+
+	errResp, innerErr := json.Marshal(err)
+	if innerErr != nil {
+		http.Error(w, innerErr.Error(), http.StatusInternalServerError)
+	}
+
+	w.Write(errResp)
+}
 
-		w.Write(errResp)
+// writeJSON sends v to the client as a JSON object with a 200 status.
+func writeJSON(w http.ResponseWriter, v interface{}) *HTTPError {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
 }
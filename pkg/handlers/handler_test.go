@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	goji "goji.io"
+	"goji.io/pat"
+
+	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
+)
+
+// ctx is the context of the store operations of the tests.
+var ctx = context.Background()
+
+// newTestUser adds a user to s and returns it together with the API
+// token that authenticates it.
+func newTestUser(t *testing.T, s store.Storer, email string) (*users.User, string) {
+	u, err := s.NewUser(ctx, email, "test-user")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	token, err := s.IssueToken(ctx, u.ID)
+	assert.Nil(t, err)
+
+	return u, token
+}
+
+// newTestArtist adds a user with the given email address and the artist
+// role to s. It returns the user and its API token.
+func newTestArtist(t *testing.T, s store.Storer, email string) (*users.User, string) {
+	u, token := newTestUser(t, s, email)
+
+	artist, err := s.AssignRole(ctx, u.ID, users.RoleAssignment{Role: users.Artist})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return artist, token
+}
+
+// newTestAdmin adds a user with the given email address and the admin
+// role to s. It returns the user and its API token.
+func newTestAdmin(t *testing.T, s store.Storer, email string) (*users.User, string) {
+	u, token := newTestUser(t, s, email)
+
+	admin, err := s.AssignRole(ctx, u.ID, users.RoleAssignment{Role: users.Admin})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return admin, token
+}
+
+// withUser returns a copy of req sent by the artist identified by email.
+// It is used with mock stores, where tokens cannot be resolved.
+func withUser(req *http.Request, email string) *http.Request {
+	return req.WithContext(users.NewContext(req.Context(), &users.User{
+		ID:    "the-user-id",
+		Email: email,
+		Name:  "test-user",
+		Role:  users.Artist,
+	}))
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{&store.Error{Kind: store.ErrNotFound}, http.StatusNotFound},
+		{&store.Error{Kind: store.ErrConflict}, http.StatusConflict},
+		{&store.Error{Kind: store.ErrForbidden}, http.StatusForbidden},
+		{&store.Error{Kind: store.ErrValidation}, http.StatusUnprocessableEntity},
+		{context.Canceled, http.StatusServiceUnavailable},
+		{fmt.Errorf("slow store: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{errors.New("unexpected"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, errorStatus(test.err))
+	}
+}
+
+func TestHandlerAbortedRequest(t *testing.T) {
+	memStore := store.NewMemStore()
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id"), Handler{S: memStore, H: GetCertHandler})
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequest("GET", "/certificates/the-id", nil)
+	assert.Nil(t, err)
+	req = req.WithContext(cancelled)
+
+	expected := `{
+		"httpStatus": 503,
+		"code": "unavailable",
+		"error": "the request was aborted before it completed"
+	}`
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
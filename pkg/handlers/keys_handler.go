@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+
+	"github.com/Popcore/verisart/pkg/signing"
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+// keyResponse describes the public key used to verify the signatures of
+// certificates.
+type keyResponse struct {
+	ID        string `json:"keyId"`
+	Algorithm string `json:"algorithm"`
+
+	// PublicKey is the base64 encoded raw public key.
+	PublicKey string `json:"publicKey"`
+
+	// PEM is the PEM encoded PKIX public key.
+	PEM string `json:"pem"`
+}
+
+// PublicKeyHandler returns a handler exposing the public key matching the
+// key k used to sign certificates, so that signatures can be checked
+// without contacting the service.
+func PublicKeyHandler(k *signing.Key) handler {
+	return func(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+		der, err := x509.MarshalPKIXPublicKey(k.PublicKey())
+		if err != nil {
+			return newHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		resp, err := json.Marshal(keyResponse{
+			ID:        k.ID(),
+			Algorithm: signing.Algorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(k.PublicKey()),
+			PEM:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		})
+		if err != nil {
+			return newHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		_, err = w.Write(resp)
+		if err != nil {
+			return newHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	goji "goji.io"
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+func TestPublicKeyHandler(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	memStore := store.NewMemStore(store.WithSigner(key))
+	_, token := newTestArtist(t, memStore, "user@email.com")
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates"), Handler{S: memStore, H: PostCertHandler})
+	mux.Handle(pat.Get("/signing-key"), Handler{S: memStore, H: PublicKeyHandler(key)})
+
+	// create a signed certificate
+	req, err := http.NewRequest("POST", "/certificates", strings.NewReader(`{"title": "my-thing", "year": 1998}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	created := cert.Certificate{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	// retrieve the public key without authenticating
+	req, err = http.NewRequest("GET", "/signing-key", nil)
+	assert.Nil(t, err)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := keyResponse{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, key.ID(), resp.ID)
+	assert.Equal(t, "Ed25519", resp.Algorithm)
+	assert.Contains(t, resp.PEM, "-----BEGIN PUBLIC KEY-----")
+
+	// the key returned by the endpoint verifies the certificate signature
+	pub, err := base64.StdEncoding.DecodeString(resp.PublicKey)
+	assert.Nil(t, err)
+
+	payload, err := created.SignedPayload()
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, created.Signature) {
+		assert.Nil(t, signing.Verify(ed25519.PublicKey(pub), payload, *created.Signature))
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goji.io/pat"
+
+	"github.com/Popcore/verisart/pkg/ledger"
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+// ledgerResponse is the payload returned when retrieving the ledger of a
+// certificate. It includes the outcome of the verification of the chain.
+type ledgerResponse struct {
+	Entries []ledger.Entry `json:"entries"`
+	Valid   bool           `json:"valid"`
+
+	// Error describes where the chain is broken, if it is not valid.
+	Error string `json:"error,omitempty"`
+}
+
+// GetLedgerHandler accepts requests dealing with the retrieval of the
+// ledger recording the history of a certificate. The ledger of deleted
+// certificates can still be retrieved. The ledger of certificates last
+// owned by an organization is only shown to the members allowed to view
+// them.
+func GetLedgerHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	certID := pat.Param(r, "id")
+
+	entries, err := s.GetLedger(r.Context(), certID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	if httpErr := requireViewPermission(s, r, lastOwner(entries)); httpErr != nil {
+		return httpErr
+	}
+
+	ledgerResp := ledgerResponse{
+		Entries: entries,
+		Valid:   true,
+	}
+	if err := ledger.Verify(entries); err != nil {
+		ledgerResp.Valid = false
+		ledgerResp.Error = err.Error()
+	}
+
+	resp, err := json.Marshal(ledgerResp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+// lastOwner returns the ID of the owner of the certificate recorded by
+// the most recent entry of its ledger holding the state of the
+// certificate, which is still known once the certificate is deleted.
+func lastOwner(entries []ledger.Entry) string {
+	for i := len(entries) - 1; i >= 0; i-- {
+		state := struct {
+			OwnerID string `json:"ownerId"`
+		}{}
+		if err := json.Unmarshal(entries[i].Data, &state); err == nil && state.OwnerID != "" {
+			return state.OwnerID
+		}
+	}
+
+	return ""
+}
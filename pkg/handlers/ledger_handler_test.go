@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	goji "goji.io"
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	mocks "github.com/Popcore/verisart/pkg/mocks"
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+func TestGetLedgerHandlerOK(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner1, _ := newTestUser(t, memStore, "owner1@email.com")
+	owner2, _ := newTestUser(t, memStore, "owner2@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	_, err = memStore.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+	_, err = memStore.AcceptTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, memStore.DeleteCert(ctx, owner2.ID, created.ID))
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id/ledger"), Handler{S: memStore, H: GetLedgerHandler})
+
+	req, err := http.NewRequest("GET", "/certificates/"+created.ID+"/ledger", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := ledgerResponse{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.True(t, resp.Valid)
+	assert.Empty(t, resp.Error)
+
+	types := []ledger.EventType{}
+	for _, e := range resp.Entries {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []ledger.EventType{ledger.Created, ledger.TransferCreated, ledger.TransferAccepted, ledger.Deleted}, types)
+}
+
+func TestGetLedgerHandlerBrokenChain(t *testing.T) {
+	chain, err := ledger.Append(nil, "the-id", ledger.Created, ledger.Actor{ID: "owner1@email.com"}, time.Now(), nil)
+	assert.Nil(t, err)
+	chain, err = ledger.Append(chain, "the-id", ledger.Deleted, ledger.Actor{ID: "owner1@email.com"}, time.Now(), nil)
+	assert.Nil(t, err)
+	chain[0].Actor = "someone@email.com"
+
+	mockStore := mocks.MockStore{Ledger: chain}
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id/ledger"), Handler{S: mockStore, H: GetLedgerHandler})
+
+	req, err := http.NewRequest("GET", "/certificates/the-id/ledger", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	resp := ledgerResponse{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.False(t, resp.Valid)
+	assert.Equal(t, "the ledger is broken at entry 0: the entry does not match its hash", resp.Error)
+}
+
+func TestGetLedgerHandlerErrorNotFound(t *testing.T) {
+	memStore := store.NewMemStore()
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id/ledger"), Handler{S: memStore, H: GetLedgerHandler})
+
+	req, err := http.NewRequest("GET", "/certificates/i-dont-exist/ledger", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
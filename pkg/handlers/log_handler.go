@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"goji.io/pat"
+
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+// queryInt reads the non-negative integer query parameter name of a
+// request. It returns def when the parameter is missing.
+func queryInt(r *http.Request, name string, def int) (int, *HTTPError) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, newHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive integer", name))
+	}
+
+	return n, nil
+}
+
+// GetTreeHeadHandler accepts requests dealing with the retrieval of the
+// current signed tree head of the transparency log.
+func GetTreeHeadHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	head, err := s.GetTreeHead(r.Context())
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, head)
+}
+
+// InclusionProofHandler accepts requests dealing with the retrieval of
+// the proof that an entry of the ledger of a certificate is part of the
+// transparency log. The seq query parameter selects the ledger entry,
+// the creation of the certificate by default, while treeSize selects the
+// version of the log, the current one by default. The proofs of the
+// entries of certificates last owned by an organization, which hold the
+// certificate, are only shown to the members allowed to view them.
+func InclusionProofHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	certID := pat.Param(r, "id")
+
+	seq, httpErr := queryInt(r, "seq", 0)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	treeSize, httpErr := queryInt(r, "treeSize", 0)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	entries, err := s.GetLedger(r.Context(), certID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	if httpErr := requireViewPermission(s, r, lastOwner(entries)); httpErr != nil {
+		return httpErr
+	}
+
+	proof, err := s.GetInclusionProof(r.Context(), certID, seq, treeSize)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, proof)
+}
+
+// ConsistencyProofHandler accepts requests dealing with the retrieval of
+// the proof that the version of the transparency log of size first is a
+// prefix of the version of size second.
+func ConsistencyProofHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	query := r.URL.Query()
+	if query.Get("first") == "" || query.Get("second") == "" {
+		return newHTTPError(http.StatusBadRequest, "first and second tree sizes must be set")
+	}
+
+	first, httpErr := queryInt(r, "first", 0)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	second, httpErr := queryInt(r, "second", 0)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	proof, err := s.GetConsistencyProof(r.Context(), first, second)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, proof)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	goji "goji.io"
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	store "github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/transparency"
+)
+
+// newLogMux returns a mux serving the transparency log endpoints backed
+// by s.
+func newLogMux(s store.Storer) *goji.Mux {
+	mux := goji.NewMux()
+	mux.Use(Authenticate(s))
+	mux.Handle(pat.Get("/log/tree-head"), Handler{S: s, H: GetTreeHeadHandler})
+	mux.Handle(pat.Get("/log/consistency-proof"), Handler{S: s, H: ConsistencyProofHandler})
+	mux.Handle(pat.Get("/certificates/:id/inclusion-proof"), Handler{S: s, H: InclusionProofHandler})
+
+	return mux
+}
+
+func TestLogHandlers(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner1, _ := newTestUser(t, memStore, "owner1@email.com")
+
+	first, err := memStore.CreateCert(ctx, owner1.ID, cert.Certificate{Title: "the-title", OwnerID: owner1.ID, Year: 2018})
+	assert.Nil(t, err)
+	_, err = memStore.CreateCert(ctx, owner1.ID, cert.Certificate{Title: "another-title", OwnerID: owner1.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	mux := newLogMux(memStore)
+
+	req, err := http.NewRequest("GET", "/log/tree-head", nil)
+	assert.Nil(t, err)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	head := transparency.TreeHead{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &head))
+	assert.Equal(t, 2, head.TreeSize)
+
+	req, err = http.NewRequest("GET", "/certificates/"+first.ID+"/inclusion-proof", nil)
+	assert.Nil(t, err)
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	inclusion := transparency.InclusionProof{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &inclusion))
+	assert.Equal(t, 0, inclusion.LeafIndex)
+	assert.Equal(t, head.RootHash, inclusion.RootHash)
+	assert.Equal(t, first.ID, inclusion.Entry.CertID)
+
+	req, err = http.NewRequest("GET", "/log/consistency-proof?first=1&second=2", nil)
+	assert.Nil(t, err)
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	consistency := transparency.ConsistencyProof{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &consistency))
+	assert.Equal(t, head.RootHash, consistency.SecondRootHash)
+}
+
+func TestLogHandlersErrors(t *testing.T) {
+	mux := newLogMux(store.NewMemStore())
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/log/consistency-proof", http.StatusBadRequest},
+		{"/log/consistency-proof?first=a&second=2", http.StatusBadRequest},
+		{"/log/consistency-proof?first=1&second=2", http.StatusUnprocessableEntity},
+		{"/certificates/i-dont-exist/inclusion-proof", http.StatusNotFound},
+		{"/certificates/i-dont-exist/inclusion-proof?seq=-1", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		assert.Nil(t, err)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.url)
+	}
+}
+
+func TestInclusionProofHandlerOrganization(t *testing.T) {
+	memStore := store.NewMemStore()
+	manager, managerToken := newTestArtist(t, memStore, "manager@email.com")
+	_, strangerToken := newTestUser(t, memStore, "stranger@email.com")
+
+	o, err := memStore.CreateOrganization(ctx, manager.ID, "the gallery")
+	assert.Nil(t, err)
+
+	created, err := memStore.CreateCert(ctx, manager.ID, cert.Certificate{Title: "the-title", OwnerID: o.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	mux := newLogMux(memStore)
+	path := "/certificates/" + created.ID + "/inclusion-proof"
+
+	// the entries of the certificates of an organization hold the
+	// certificate, so they are only proven to the members allowed to view
+	// them, even once the certificate is deleted
+	recorder := serve(t, mux, "GET", path, "", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serve(t, mux, "GET", path, "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "GET", path, "", managerToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Nil(t, memStore.DeleteCert(ctx, manager.ID, created.ID))
+
+	recorder = serve(t, mux, "GET", path+"?seq=1", "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "GET", path+"?seq=1", "", managerToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goji.io/pat"
+
+	"github.com/Popcore/verisart/pkg/organizations"
+	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
+)
+
+// newOrgRequest is the payload of requests creating organizations.
+type newOrgRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate checks the name of the new organization.
+func (req newOrgRequest) Validate() error {
+	return organizations.Organization{Name: req.Name}.Validate()
+}
+
+// PostOrgHandler deals with requests creating organizations. The user
+// creating an organization becomes its first member, with every
+// permission.
+func PostOrgHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	req := newOrgRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	created, err := s.CreateOrganization(r.Context(), user.ID, req.Name)
+	if err != nil {
+		return storeError(err)
+	}
+
+	resp, err := json.Marshal(created)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+// ListOrgsHandler deals with requests listing the organizations the
+// authenticated user is a member of.
+func ListOrgsHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	list, err := s.ListOrganizations(r.Context(), user.ID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, list)
+}
+
+// viewableOrg returns the organization identified by orgID, or a 403
+// HTTPError unless u is a member allowed to view it.
+func viewableOrg(s store.Storer, r *http.Request, u *users.User, orgID string) (*organizations.Organization, *HTTPError) {
+	o, err := s.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	if !o.Can(u.ID, organizations.View) {
+		return nil, newHTTPError(http.StatusForbidden, "only the members allowed to view an organization can see it")
+	}
+
+	return o, nil
+}
+
+// GetOrgHandler deals with requests retrieving the organization
+// identified in the URL, together with its members.
+func GetOrgHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	o, httpErr := viewableOrg(s, r, user, pat.Param(r, "orgId"))
+	if httpErr != nil {
+		return httpErr
+	}
+
+	return writeJSON(w, o)
+}
+
+// ListOrgCertsHandler deals with requests listing the certificates owned
+// by the organization identified in the URL.
+func ListOrgCertsHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	return listOrgCerts(s, w, r, pat.Param(r, "orgId"))
+}
+
+// listOrgCerts writes the certificates owned by the organization
+// identified by orgID, provided the authenticated user is a member allowed
+// to view them.
+func listOrgCerts(s store.Storer, w http.ResponseWriter, r *http.Request, orgID string) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	o, httpErr := viewableOrg(s, r, user, orgID)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	certs, err := s.GetCerts(r.Context(), o.ID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, certs)
+}
+
+// memberRequest is the payload of requests setting the permissions of
+// the members of an organization.
+type memberRequest struct {
+	Permissions []organizations.Permission `json:"permissions"`
+}
+
+// Validate checks the permissions granted to the member.
+func (req memberRequest) Validate() error {
+	return organizations.Member{Permissions: req.Permissions}.Validate()
+}
+
+// SetMemberHandler deals with requests adding the user identified, by ID
+// or email address, in the URL to an organization or changing the
+// permissions of the member. Only the members allowed to manage an
+// organization can change its members.
+func SetMemberHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	req := memberRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	member, err := s.GetUser(r.Context(), pat.Param(r, "userId"))
+	if err != nil {
+		return storeError(err)
+	}
+
+	updated, err := s.SetMember(r.Context(), user.ID, pat.Param(r, "orgId"), organizations.Member{
+		UserID:      member.ID,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, updated)
+}
+
+// RemoveMemberHandler deals with requests removing the user identified,
+// by ID or email address, in the URL from an organization. Members can
+// leave an organization, while only the members allowed to manage it can
+// remove other members.
+func RemoveMemberHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	member, err := s.GetUser(r.Context(), pat.Param(r, "userId"))
+	if err != nil {
+		return storeError(err)
+	}
+
+	if _, err := s.RemoveMember(r.Context(), user.ID, pat.Param(r, "orgId"), member.ID); err != nil {
+		return storeError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
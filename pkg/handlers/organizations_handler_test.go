@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"goji.io"
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/mocks"
+	"github.com/Popcore/verisart/pkg/organizations"
+	store "github.com/Popcore/verisart/pkg/store"
+)
+
+// newOrgMux returns a mux serving the organization and certificate
+// endpoints from s.
+func newOrgMux(s store.Storer) *goji.Mux {
+	mux := goji.NewMux()
+	mux.Use(Authenticate(s))
+	mux.Handle(pat.Post("/organizations"), Handler{S: s, H: PostOrgHandler})
+	mux.Handle(pat.Get("/organizations"), Handler{S: s, H: ListOrgsHandler})
+	mux.Handle(pat.Get("/organizations/:orgId"), Handler{S: s, H: GetOrgHandler})
+	mux.Handle(pat.Get("/organizations/:orgId/certificates"), Handler{S: s, H: ListOrgCertsHandler})
+	mux.Handle(pat.Get("/users/:userId/certificates"), Handler{S: s, H: ListUserCertsHandler})
+	mux.Handle(pat.Put("/organizations/:orgId/members/:userId"), Handler{S: s, H: SetMemberHandler})
+	mux.Handle(pat.Delete("/organizations/:orgId/members/:userId"), Handler{S: s, H: RemoveMemberHandler})
+	mux.Handle(pat.Post("/certificates"), Handler{S: s, H: PostCertHandler})
+	mux.Handle(pat.Get("/certificates/:id"), Handler{S: s, H: GetCertHandler})
+	mux.Handle(pat.Get("/certificates/:id/transfers"), Handler{S: s, H: ListTransfersHandler})
+	mux.Handle(pat.Get("/certificates/:id/ledger"), Handler{S: s, H: GetLedgerHandler})
+	mux.Handle(pat.Patch("/certificates/:id"), Handler{S: s, H: PatchCertHandler})
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: s, H: PostTransferHandler})
+
+	return mux
+}
+
+// serve sends a request with the given method, path, body and bearer
+// token to mux and returns the recorded response.
+func serve(t *testing.T, mux http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestOrganizationHandlers(t *testing.T) {
+	memStore := store.NewMemStore()
+	artist, artistToken := newTestArtist(t, memStore, "artist@email.com")
+	manager, managerToken := newTestArtist(t, memStore, "manager@email.com")
+	_, staffToken := newTestUser(t, memStore, "staff@email.com")
+	_, strangerToken := newTestUser(t, memStore, "stranger@email.com")
+
+	mux := newOrgMux(memStore)
+
+	recorder := serve(t, mux, "POST", "/organizations", `{"name": "the gallery"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serve(t, mux, "POST", "/organizations", `{"name": ""}`, managerToken)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = serve(t, mux, "POST", "/organizations", `{"name": "the gallery"}`, managerToken)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	o := organizations.Organization{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &o))
+	assert.Equal(t, "the gallery", o.Name)
+	assert.Len(t, o.Members, 1)
+
+	// staff are added by email address with their permissions
+	recorder = serve(t, mux, "PUT", "/organizations/"+o.ID+"/members/staff@email.com", `{"permissions": ["view", "drink"]}`, managerToken)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = serve(t, mux, "PUT", "/organizations/"+o.ID+"/members/staff@email.com", `{"permissions": ["view", "edit"]}`, strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "PUT", "/organizations/"+o.ID+"/members/staff@email.com", `{"permissions": ["view", "edit"]}`, managerToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// only members allowed to view an organization see it
+	recorder = serve(t, mux, "GET", "/organizations/"+o.ID, "", staffToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serve(t, mux, "GET", "/organizations/"+o.ID, "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "GET", "/organizations/i-dont-exist", "", staffToken)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(t, mux, "GET", "/organizations", "", staffToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	list := []organizations.Organization{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+
+	// certificates issued on behalf of the organization belong to it
+	recorder = serve(t, mux, "POST", "/certificates", `{"title": "my thing", "year": 2018, "organizationId": "`+o.ID+`"}`, managerToken)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	created := cert.Certificate{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.Equal(t, o.ID, created.OwnerID)
+
+	recorder = serve(t, mux, "GET", "/organizations/"+o.ID+"/certificates", "", staffToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	certs := []cert.Certificate{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &certs))
+	assert.Len(t, certs, 1)
+
+	recorder = serve(t, mux, "GET", "/organizations/"+o.ID+"/certificates", "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// the certificates of owners are listed whether they are users or
+	// organizations
+	recorder = serve(t, mux, "GET", "/users/"+o.ID+"/certificates", "", staffToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	certs = []cert.Certificate{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &certs))
+	assert.Len(t, certs, 1)
+
+	recorder = serve(t, mux, "GET", "/users/"+o.ID+"/certificates", "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "GET", "/users/"+o.ID+"/certificates", "", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// the certificates of the organization, their transfers and their
+	// ledger are only shown to the members allowed to view them
+	for _, path := range []string{"/certificates/" + created.ID, "/certificates/" + created.ID + "/transfers", "/certificates/" + created.ID + "/ledger"} {
+		recorder = serve(t, mux, "GET", path, "", staffToken)
+		assert.Equal(t, http.StatusOK, recorder.Code, path)
+
+		recorder = serve(t, mux, "GET", path, "", strangerToken)
+		assert.Equal(t, http.StatusForbidden, recorder.Code, path)
+
+		recorder = serve(t, mux, "GET", path, "", "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, path)
+	}
+
+	// staff edit the certificates of the organization whatever their role
+	recorder = serve(t, mux, "PATCH", "/certificates/"+created.ID, `{"title": "a new title"}`, staffToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serve(t, mux, "PATCH", "/certificates/"+created.ID, `{"title": "a new title"}`, strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// but cannot transfer them without the transfer permission
+	recorder = serve(t, mux, "POST", "/certificates/"+created.ID+"/transfers", `{"email": "stranger@email.com"}`, staffToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	owned, err := memStore.CreateCert(ctx, artist.ID, cert.Certificate{Title: "my thing", Year: 2018, OwnerID: artist.ID, ArtistID: artist.ID})
+	assert.Nil(t, err)
+
+	// while the certificates of users are public
+	recorder = serve(t, mux, "GET", "/certificates/"+owned.ID, "", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// the ledger of deleted certificates stays private
+	deleted, err := memStore.CreateCert(ctx, manager.ID, cert.Certificate{Title: "my thing", Year: 2018, OwnerID: o.ID, ArtistID: manager.ID})
+	assert.Nil(t, err)
+	assert.Nil(t, memStore.DeleteCert(ctx, manager.ID, deleted.ID))
+
+	recorder = serve(t, mux, "GET", "/certificates/"+deleted.ID+"/ledger", "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, mux, "GET", "/certificates/"+deleted.ID+"/ledger", "", managerToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serve(t, mux, "DELETE", "/organizations/"+o.ID+"/members/staff@email.com", "", managerToken)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// organizations can receive certificates
+	recorder = serve(t, mux, "POST", "/certificates/"+owned.ID+"/transfers", `{"organizationId": "`+o.ID+`"}`, artistToken)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	tx := cert.Transaction{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &tx))
+	assert.Equal(t, o.ID, tx.RecipientID)
+}
+
+func TestPostTransferHandlerRecipient(t *testing.T) {
+	mux := goji.NewMux()
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: mocks.MockStore{}, H: PostTransferHandler})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{"field": "email", "error": "is required"}`},
+		{`{"email": "user@email.com", "organizationId": "org-id"}`, `{"field": "organizationId", "error": "cannot be set together with email"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/certificates/mock-id/transfers", strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req = withUser(req, "owner@email.com")
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code, test.input)
+
+		body := struct {
+			Fields []json.RawMessage `json:"fields"`
+		}{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		if assert.Len(t, body.Fields, 1, test.input) {
+			assert.JSONEq(t, test.expected, string(body.Fields[0]), test.input)
+		}
+	}
+}
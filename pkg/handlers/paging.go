@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultPageSize is the number of items returned by list endpoints
+	// when the request does not specify a limit.
+	defaultPageSize = 50
+
+	// maxPageSize is the maximum number of items list endpoints return.
+	maxPageSize = 100
+)
+
+// page describes the portion of a list returned by list endpoints.
+type page struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+// parsePage reads the offset and limit query parameters of a request.
+func parsePage(r *http.Request) (page, *HTTPError) {
+	p := page{
+		Offset: 0,
+		Limit:  defaultPageSize,
+	}
+
+	query := r.URL.Query()
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, newHTTPError(http.StatusBadRequest, "offset must be a positive integer")
+		}
+		p.Offset = offset
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return p, newHTTPError(http.StatusBadRequest, "limit must be an integer between 1 and 100")
+		}
+		p.Limit = limit
+	}
+
+	return p, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,15 +16,21 @@ import (
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
 	mocks "github.com/Popcore/verisart/pkg/mocks"
+	store "github.com/Popcore/verisart/pkg/store"
 )
 
 func TestPostTransferHandlerOK(t *testing.T) {
 	mux := goji.NewMux()
+	createdAt, _ := time.Parse(time.RFC3339, "2018-11-21T12:00:00Z")
+
 	memStore := mocks.MockStore{
 		Err: nil,
 		Tx: cert.Transaction{
-			To:     "user@email.com",
-			Status: "pending",
+			ID:        "tx-id",
+			From:      "owner@email.com",
+			To:        "user@email.com",
+			Status:    "pending",
+			CreatedAt: createdAt,
 		},
 	}
 	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
@@ -34,12 +41,16 @@ func TestPostTransferHandlerOK(t *testing.T) {
 	}`
 
 	expected := `{
+		"id": "tx-id",
+		"from": "owner@email.com",
 		"email": "user@email.com",
-		"status": "pending"
+		"status": "pending",
+		"createdAt": "2018-11-21T12:00:00Z"
 	}`
 
 	req, err := http.NewRequest("POST", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
@@ -62,11 +73,13 @@ func TestPostTransferHandlerErrorInvalidJSON(t *testing.T) {
 
 	expected := `{
 		"httpStatus": 400,
+		"code": "bad_request",
 		"error": "invalid json payload"
 	}`
 
 	req, err := http.NewRequest("POST", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
@@ -75,10 +88,41 @@ func TestPostTransferHandlerErrorInvalidJSON(t *testing.T) {
 	assert.JSONEq(t, expected, recorder.Body.String())
 }
 
+func TestPostTransferHandlerErrorPastExpiry(t *testing.T) {
+	mux := goji.NewMux()
+	memStore := mocks.MockStore{
+		Err: nil,
+		Tx:  cert.Transaction{},
+	}
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
+
+	input := `{
+		"email": "user@email.com",
+		"expiresAt": "2018-11-21T12:00:00Z"
+	}`
+
+	expected := `{
+		"httpStatus": 422,
+		"code": "validation_failed",
+		"error": "the request payload is not valid",
+		"fields": [{"field": "expiresAt", "error": "must be in the future"}]
+	}`
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
+	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
+
 func TestPostTransferHandlerStoreError(t *testing.T) {
 	mux := goji.NewMux()
 	memStore := mocks.MockStore{
-		Err: errors.New("some error"),
+		Err: &store.Error{Kind: store.ErrConflict, Msg: "some error"},
 		Tx:  cert.Transaction{},
 	}
 	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
@@ -89,17 +133,19 @@ func TestPostTransferHandlerStoreError(t *testing.T) {
 	}`
 
 	expected := `{
-		"httpStatus": 422,
+		"httpStatus": 409,
+		"code": "conflict",
 		"error": "some error"
 	}`
 
 	req, err := http.NewRequest("POST", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
 	assert.JSONEq(t, expected, recorder.Body.String())
 }
 
@@ -139,6 +185,7 @@ func TestPatchTransferHandlerOK(t *testing.T) {
 
 	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
@@ -165,11 +212,14 @@ func TestPatchTransferHandlerErrorInvalidStatus(t *testing.T) {
 
 	expected := `{
 		"httpStatus": 422,
-		"error": "transaction status can only be set to 'accepted' for now"
+		"code": "validation_failed",
+		"error": "the request payload is not valid",
+		"fields": [{"field": "status", "error": "can only be set to 'accepted', 'rejected' or 'cancelled'"}]
 	}`
 
 	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
@@ -181,7 +231,7 @@ func TestPatchTransferHandlerErrorInvalidStatus(t *testing.T) {
 func TestPatchTransferHandlerErrorInvalidJSON(t *testing.T) {
 	mux := goji.NewMux()
 	memStore := mocks.MockStore{
-		Err: errors.New("some error"),
+		Err: &store.Error{Kind: store.ErrNotFound, Msg: "some error"},
 		Tx:  cert.Transaction{},
 	}
 	mux.Handle(pat.Patch("/certificates/:id/transfers"), Handler{S: memStore, H: PatchTransferHandler})
@@ -192,16 +242,358 @@ func TestPatchTransferHandlerErrorInvalidJSON(t *testing.T) {
 	}`
 
 	expected := `{
-		"httpStatus": 422,
+		"httpStatus": 404,
+		"code": "not_found",
 		"error": "some error"
 	}`
 
 	req, err := http.NewRequest("PATCH", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
 	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
 
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
+
+func TestPostTransferHandlerUnexpectedStoreError(t *testing.T) {
+	mux := goji.NewMux()
+	memStore := mocks.MockStore{
+		Err: errors.New("some error"),
+		Tx:  cert.Transaction{},
+	}
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
+
+	input := `{
+		"email": "user@email.com",
+		"status": "pending"
+	}`
+
+	expected := `{
+		"httpStatus": 500,
+		"code": "internal_error",
+		"error": "some error"
+	}`
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/certificates/mock-id/transfers"), strings.NewReader(input))
+	assert.Nil(t, err)
+	req = withUser(req, "owner@email.com")
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
 	assert.JSONEq(t, expected, recorder.Body.String())
 }
+
+func TestPatchTransferHandlerRejectAndCancel(t *testing.T) {
+	createdAt, _ := time.Parse(time.RFC3339, "2018-11-21T12:00:00Z")
+	resolvedAt, _ := time.Parse(time.RFC3339, "2018-11-22T12:00:00Z")
+
+	for _, status := range []cert.TransferStatus{cert.Rejected, cert.Cancelled} {
+		mux := goji.NewMux()
+		memStore := mocks.MockStore{
+			Err: nil,
+			Cert: cert.Certificate{
+				ID:      "123abc",
+				Title:   "the-cert-title",
+				OwnerID: "owner@email.com",
+				Year:    2001,
+				Transfer: &cert.Transaction{
+					ID:         "tx-id",
+					From:       "owner@email.com",
+					To:         "user@email.com",
+					Status:     status,
+					CreatedAt:  createdAt,
+					ResolvedAt: &resolvedAt,
+				},
+			},
+		}
+		mux.Handle(pat.Patch("/certificates/:id/transfers"), Handler{S: memStore, H: PatchTransferHandler})
+
+		input := fmt.Sprintf(`{
+			"email": "user@email.com",
+			"status": "%s"
+		}`, status)
+
+		expected := fmt.Sprintf(`{
+			"id": "123abc",
+			"title": "the-cert-title",
+			"ownerId": "owner@email.com",
+			"year" : 2001,
+			"createdAt": "0001-01-01T00:00:00Z",
+			"transfer": {
+				"id": "tx-id",
+				"from": "owner@email.com",
+				"email": "user@email.com",
+				"status": "%s",
+				"createdAt": "2018-11-21T12:00:00Z",
+				"resolvedAt": "2018-11-22T12:00:00Z"
+			}
+		}`, status)
+
+		req, err := http.NewRequest("PATCH", "/certificates/123abc/transfers", strings.NewReader(input))
+		assert.Nil(t, err)
+		req = withUser(req, "owner@email.com")
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, expected, recorder.Body.String())
+	}
+}
+
+func TestPatchTransferHandlerErrorUnauthenticated(t *testing.T) {
+	mux := goji.NewMux()
+	memStore := mocks.MockStore{}
+	mux.Handle(pat.Patch("/certificates/:id/transfers"), Handler{S: memStore, H: PatchTransferHandler})
+
+	input := `{
+		"email": "user@email.com",
+		"status": "accepted"
+	}`
+
+	req, err := http.NewRequest("PATCH", "/certificates/mock-id/transfers", strings.NewReader(input))
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestTransferHandlersErrorForbidden(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner, ownerToken := newTestUser(t, memStore, "owner@email.com")
+	recipient, recipientToken := newTestUser(t, memStore, "recipient@email.com")
+	_, otherToken := newTestUser(t, memStore, "someone-else@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner.ID, cert.Certificate{
+		OwnerID: owner.ID,
+		Title:   "my cert",
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
+	mux.Handle(pat.Patch("/certificates/:id/transfers"), Handler{S: memStore, H: PatchTransferHandler})
+
+	url := fmt.Sprintf("/certificates/%s/transfers", created.ID)
+
+	tests := []struct {
+		method   string
+		token    string
+		input    string
+		expected int
+	}{
+		// only the owner can create a transfer
+		{"POST", otherToken, `{"email": "recipient@email.com"}`, http.StatusForbidden},
+		{"POST", recipientToken, `{"email": "recipient@email.com"}`, http.StatusForbidden},
+		{"POST", ownerToken, `{"email": "recipient@email.com"}`, http.StatusCreated},
+		// only the recipient can accept or reject it
+		{"PATCH", otherToken, `{"status": "accepted"}`, http.StatusForbidden},
+		{"PATCH", ownerToken, `{"status": "accepted"}`, http.StatusForbidden},
+		{"PATCH", ownerToken, `{"status": "rejected"}`, http.StatusForbidden},
+		// only the owner can cancel it
+		{"PATCH", recipientToken, `{"status": "cancelled"}`, http.StatusForbidden},
+		{"PATCH", otherToken, `{"status": "cancelled"}`, http.StatusForbidden},
+		{"PATCH", recipientToken, `{"status": "accepted"}`, http.StatusOK},
+		// once accepted the recipient becomes the owner
+		{"POST", ownerToken, `{"email": "someone-else@email.com"}`, http.StatusForbidden},
+		{"POST", recipientToken, `{"email": "someone-else@email.com"}`, http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, url, strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.expected, recorder.Code, "%s %s", test.method, test.input)
+	}
+
+	certs, err := memStore.GetCerts(ctx, recipient.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+}
+
+func TestListTransfersHandlerOK(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner, ownerToken := newTestUser(t, memStore, "owner@email.com")
+	recipient, recipientToken := newTestUser(t, memStore, "recipient@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner.ID, cert.Certificate{
+		OwnerID: owner.ID,
+		Title:   "my cert",
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
+	mux.Handle(pat.Patch("/certificates/:id/transfers"), Handler{S: memStore, H: PatchTransferHandler})
+	mux.Handle(pat.Get("/certificates/:id/transfers"), Handler{S: memStore, H: ListTransfersHandler})
+
+	url := fmt.Sprintf("/certificates/%s/transfers", created.ID)
+
+	// the certificate is offered to the recipient, who rejects it,
+	// then offered again and accepted
+	steps := []struct {
+		method string
+		token  string
+		input  string
+	}{
+		{"POST", ownerToken, `{"email": "recipient@email.com"}`},
+		{"PATCH", recipientToken, `{"status": "rejected"}`},
+		{"POST", ownerToken, `{"email": "recipient@email.com"}`},
+		{"PATCH", recipientToken, `{"status": "accepted"}`},
+	}
+
+	for _, step := range steps {
+		req, err := http.NewRequest(step.method, url, strings.NewReader(step.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+step.token)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		assert.True(t, recorder.Code < 300)
+	}
+
+	req, err := http.NewRequest("GET", url+"?limit=1&offset=1", nil)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	got := transfersResponse{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &got)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, got.Total)
+	assert.Equal(t, 1, got.Offset)
+	assert.Equal(t, 1, got.Limit)
+	assert.Len(t, got.Transfers, 1)
+	assert.Equal(t, owner.ID, got.Transfers[0].From)
+	assert.Equal(t, "recipient@email.com", got.Transfers[0].To)
+	assert.Equal(t, recipient.ID, got.Transfers[0].RecipientID)
+	assert.Equal(t, cert.Accepted, got.Transfers[0].Status)
+	assert.NotNil(t, got.Transfers[0].ResolvedAt)
+
+	// the whole history is returned oldest first
+	req, err = http.NewRequest("GET", url, nil)
+	assert.Nil(t, err)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	err = json.Unmarshal(recorder.Body.Bytes(), &got)
+	assert.Nil(t, err)
+	assert.Len(t, got.Transfers, 2)
+	assert.Equal(t, cert.Rejected, got.Transfers[0].Status)
+	assert.Equal(t, cert.Accepted, got.Transfers[1].Status)
+}
+
+func TestListTransfersHandlerErrors(t *testing.T) {
+	memStore := store.NewMemStore()
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/certificates/:id/transfers"), Handler{S: memStore, H: ListTransfersHandler})
+
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"/certificates/i-dont-exist/transfers", http.StatusNotFound},
+		{"/certificates/i-dont-exist/transfers?offset=-1", http.StatusBadRequest},
+		{"/certificates/i-dont-exist/transfers?limit=abc", http.StatusBadRequest},
+		{"/certificates/i-dont-exist/transfers?limit=1000", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		assert.Nil(t, err)
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.expected, recorder.Code, test.url)
+	}
+}
+
+func TestClaimInvitationHandlerOK(t *testing.T) {
+	memStore := store.NewMemStore()
+	owner, ownerToken := newTestUser(t, memStore, "owner@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner.ID, cert.Certificate{
+		OwnerID: owner.ID,
+		Title:   "my cert",
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/certificates/:id/transfers"), Handler{S: memStore, H: PostTransferHandler})
+	mux.Handle(pat.Post("/invitations/claim"), Handler{S: memStore, H: ClaimInvitationHandler})
+
+	// transfers to unknown recipients return a claim token
+	req, err := http.NewRequest("POST", "/certificates/"+created.ID+"/transfers", strings.NewReader(`{"email": "invited@email.com"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	invited := cert.Transaction{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &invited))
+	assert.NotEmpty(t, invited.ClaimToken)
+	assert.NotNil(t, invited.Invitation)
+
+	_, collectorToken := newTestUser(t, memStore, "collector@email.com")
+
+	req, err = http.NewRequest("POST", "/invitations/claim", strings.NewReader(`{"token": "`+invited.ClaimToken+`"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+collectorToken)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	claimed := cert.Transaction{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &claimed))
+	assert.Equal(t, "collector@email.com", claimed.To)
+	assert.Empty(t, claimed.ClaimToken)
+
+	// claim tokens are single-use
+	req, err = http.NewRequest("POST", "/invitations/claim", strings.NewReader(`{"token": "`+invited.ClaimToken+`"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+collectorToken)
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestClaimInvitationHandlerErrorNoUser(t *testing.T) {
+	memStore := store.NewMemStore()
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/invitations/claim"), Handler{S: memStore, H: ClaimInvitationHandler})
+
+	req, err := http.NewRequest("POST", "/invitations/claim", strings.NewReader(`{"token": "the-token"}`))
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
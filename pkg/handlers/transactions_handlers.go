@@ -3,30 +3,90 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"goji.io/pat"
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
 	store "github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/validation"
 )
 
+// newTransferRequest is the payload of requests creating transfers.
+// Transfers are sent either to an email address or to an organization.
+type newTransferRequest struct {
+	Email          string              `json:"email"`
+	OrganizationID string              `json:"organizationId"`
+	Status         cert.TransferStatus `json:"status"`
+	ExpiresAt      *time.Time          `json:"expiresAt"`
+}
+
+// Validate checks that the recipient email address is valid, unless the
+// transfer is sent to an organization, and that the optional expiry is
+// after now. New transfers are always pending, so a status other than
+// pending is rejected.
+func (req newTransferRequest) Validate(now time.Time) error {
+	v := validation.Validator{}
+
+	if req.OrganizationID == "" {
+		v.Required("email", req.Email)
+	}
+	if req.Email != "" {
+		v.Email("email", req.Email)
+		v.Check(req.OrganizationID == "", "organizationId", "cannot be set together with email")
+	}
+
+	v.Check(req.Status == "" || req.Status == cert.Pending, "status", "new transfers can only be pending")
+	v.Check(req.ExpiresAt == nil || req.ExpiresAt.After(now), "expiresAt", "must be in the future")
+
+	return v.Err()
+}
+
+// updateTransferRequest is the payload of requests finalizing transfers.
+// The recipient email address is accepted but ignored.
+type updateTransferRequest struct {
+	Email  string              `json:"email"`
+	Status cert.TransferStatus `json:"status"`
+}
+
+// Validate checks that the requested status finalizes a transfer.
+func (req updateTransferRequest) Validate() error {
+	v := validation.Validator{}
+
+	switch req.Status {
+	case cert.Accepted, cert.Rejected, cert.Cancelled:
+	default:
+		v.Check(false, "status", "can only be set to 'accepted', 'rejected' or 'cancelled'")
+	}
+
+	return v.Err()
+}
+
 // PostTransferHandler deals with requests that attempt to
-// create a new certificate transfer.
+// create a new certificate transfer. Members allowed to transfer the
+// certificates of an organization can transfer them on its behalf.
 func PostTransferHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
 	certID := pat.Param(r, "id")
 
 	// parse transfer payload
-	txInfo := cert.Transaction{}
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&txInfo)
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	req := newTransferRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
 	}
 
 	// attemp to update certificate transfer
-	trx, err := s.CreateTx(certID, txInfo)
+	trx, err := s.CreateTx(r.Context(), user.ID, certID, cert.Transaction{
+		To:          req.Email,
+		RecipientID: req.OrganizationID,
+		ExpiresAt:   req.ExpiresAt,
+	})
 	if err != nil {
-		return newHTTPError(http.StatusUnprocessableEntity, err.Error())
+		return storeError(err)
 	}
 
 	resp, err := json.Marshal(trx)
@@ -46,25 +106,39 @@ func PostTransferHandler(s store.Storer, w http.ResponseWriter, r *http.Request)
 }
 
 // PatchTransferHandler deals with requests that attempt to
-// finalized (i.e complete or reject) a certificate transfer.
+// finalize (i.e accept, reject or cancel) a certificate transfer.
+// Members allowed to transfer the certificates of an organization
+// finalize the transfers of the organization.
 func PatchTransferHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
 	certID := pat.Param(r, "id")
 
 	// parse transfer payload
-	txInfo := cert.Transaction{}
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&txInfo)
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	req := updateTransferRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
 	}
 
-	if txInfo.Status != cert.Accepted {
-		return newHTTPError(http.StatusUnprocessableEntity, "transaction status can only be set to 'accepted' for now")
+	var (
+		trx *cert.Certificate
+		err error
+	)
+
+	switch req.Status {
+	case cert.Accepted:
+		trx, err = s.AcceptTx(r.Context(), user.ID, certID)
+	case cert.Rejected:
+		trx, err = s.RejectTx(r.Context(), user.ID, certID)
+	case cert.Cancelled:
+		trx, err = s.CancelTx(r.Context(), user.ID, certID)
 	}
 
-	trx, err := s.AcceptTx(certID)
 	if err != nil {
-		return newHTTPError(http.StatusUnprocessableEntity, err.Error())
+		return storeError(err)
 	}
 
 	resp, err := json.Marshal(trx)
@@ -82,3 +156,92 @@ func PatchTransferHandler(s store.Storer, w http.ResponseWriter, r *http.Request
 
 	return nil
 }
+
+// claimRequest is the payload of requests claiming a transaction
+// invitation.
+type claimRequest struct {
+	Token string `json:"token"`
+}
+
+// Validate checks that the claim token is set.
+func (req claimRequest) Validate() error {
+	v := validation.Validator{}
+	v.Required("token", req.Token)
+
+	return v.Err()
+}
+
+// ClaimInvitationHandler deals with requests that redeem the claim token
+// of a transaction sent to a recipient who was not a user. The user
+// sending the request becomes the transaction recipient.
+func ClaimInvitationHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	req := claimRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	trx, err := s.ClaimInvitation(r.Context(), user.ID, req.Token)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, trx)
+}
+
+// transfersResponse is the payload returned when listing the
+// transactions of a certificate.
+type transfersResponse struct {
+	Transfers []cert.Transaction `json:"transfers"`
+	page
+}
+
+// ListTransfersHandler deals with requests that retrieve the history
+// of the transactions of a certificate, in chronological order. The
+// transactions of certificates owned by an organization are only shown
+// to the members allowed to view them.
+func ListTransfersHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	certID := pat.Param(r, "id")
+
+	p, httpErr := parsePage(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	c, err := s.GetCert(r.Context(), certID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	if httpErr := requireViewPermission(s, r, c.OwnerID); httpErr != nil {
+		return httpErr
+	}
+
+	txs, total, err := s.GetTxs(r.Context(), certID, p.Offset, p.Limit)
+	if err != nil {
+		return storeError(err)
+	}
+	p.Total = total
+
+	resp, err := json.Marshal(transfersResponse{
+		Transfers: txs,
+		page:      p,
+	})
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(resp)
+	if err != nil {
+		return newHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
@@ -2,25 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"goji.io/pat"
 
-	cert "github.com/Popcore/verisart/pkg/certificate"
 	store "github.com/Popcore/verisart/pkg/store"
 	users "github.com/Popcore/verisart/pkg/users"
+	"github.com/Popcore/verisart/pkg/validation"
 )
 
 // ListUserCertsHandler accepts requests dealing with the listing of
-// certificates that belong to the user ID specified in the URL.
+// certificates that belong to the user identified, by ID or email address,
+// in the URL. Certificates owned by an organization are listed when the
+// URL identifies it instead, to the members allowed to view them.
 func ListUserCertsHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
-	userID := pat.Param(r, "userId")
+	ownerID := pat.Param(r, "userId")
 
-	certs := []cert.Certificate{}
+	owner, err := s.GetUser(r.Context(), ownerID)
+	if errors.Is(err, store.ErrNotFound) {
+		if _, orgErr := s.GetOrganization(r.Context(), ownerID); orgErr == nil {
+			return listOrgCerts(s, w, r, ownerID)
+		}
+	}
+	if err != nil {
+		return storeError(err)
+	}
 
-	certs, err := s.GetCerts(userID)
+	certs, err := s.GetCerts(r.Context(), owner.ID)
 	if err != nil {
-		return newHTTPError(http.StatusInternalServerError, err.Error())
+		return storeError(err)
 	}
 
 	resp, err := json.Marshal(certs)
@@ -39,28 +50,48 @@ func ListUserCertsHandler(s store.Storer, w http.ResponseWriter, r *http.Request
 	return nil
 }
 
+// newUserResponse is the payload returned when a user is created. It
+// includes the API token the user must use to authenticate requests.
+type newUserResponse struct {
+	*users.User
+	Token string `json:"token"`
+}
+
+// newUserRequest is the payload of requests creating users.
+type newUserRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// Validate checks the email address and name of the new user.
+func (req newUserRequest) Validate() error {
+	return users.User{Email: req.Email, Name: req.Name}.Validate()
+}
+
 // NewUserHandler accepts requests dealing with the creation of
 // new users.
 func NewUserHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
 	// parse payload
-	decoder := json.NewDecoder(r.Body)
-	newUser := users.User{}
-
-	err := decoder.Decode(&newUser)
-	if err != nil {
-		return newHTTPError(http.StatusBadRequest, "invalid json payload")
+	req := newUserRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
 	}
 
-	if newUser.Email == "" || newUser.Name == "" {
-		return newHTTPError(http.StatusUnprocessableEntity, "user email and name must be set in the request body")
+	created, err := s.NewUser(r.Context(), req.Email, req.Name)
+	if err != nil {
+		return storeError(err)
 	}
 
-	resp, err := s.NewUser(newUser.Email, newUser.Name)
+	// the token is returned only once, when the user is created
+	token, err := s.IssueToken(r.Context(), created.ID)
 	if err != nil {
-		return newHTTPError(http.StatusUnprocessableEntity, err.Error())
+		return storeError(err)
 	}
 
-	jsonResp, err := json.Marshal(resp)
+	jsonResp, err := json.Marshal(newUserResponse{
+		User:  created,
+		Token: token,
+	})
 	if err != nil {
 		return newHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -75,3 +106,277 @@ func NewUserHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTT
 
 	return nil
 }
+
+// usersResponse is the payload returned when listing users.
+type usersResponse struct {
+	Users []users.User `json:"users"`
+	page
+}
+
+// ListUsersHandler deals with requests listing users. Users can be
+// filtered by the prefix of their email address and by name with the
+// email and name query parameters. Only admins can list users, since the
+// list discloses their email addresses.
+func ListUsersHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if httpErr := requirePermission(user, "only admins can list users", users.ManageUsers); httpErr != nil {
+		return httpErr
+	}
+
+	p, httpErr := parsePage(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	query := r.URL.Query()
+	f := users.Filter{
+		EmailPrefix: query.Get("email"),
+		Name:        query.Get("name"),
+	}
+
+	list, total, err := s.ListUsers(r.Context(), f, p.Offset, p.Limit)
+	if err != nil {
+		return storeError(err)
+	}
+	p.Total = total
+
+	return writeJSON(w, usersResponse{
+		Users: list,
+		page:  p,
+	})
+}
+
+// GetUserHandler deals with requests retrieving the user identified, by
+// ID or email address, in the URL. Users retrieve their own account,
+// while admins retrieve any account, since users hold their email
+// address.
+func GetUserHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isUser(user, pat.Param(r, "userId")) && !user.Can(users.ManageUsers) {
+		return newHTTPError(http.StatusForbidden, "users can only retrieve their own account")
+	}
+
+	u, err := s.GetUser(r.Context(), pat.Param(r, "userId"))
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, u)
+}
+
+// updateUserRequest is the payload of requests updating users.
+type updateUserRequest users.Patch
+
+// Validate checks the fields set by the request.
+func (req updateUserRequest) Validate() error {
+	return users.Patch(req).Validate()
+}
+
+// isUser returns true if idOrEmail is either the ID or the email address
+// of u.
+func isUser(u *users.User, idOrEmail string) bool {
+	return u.ID == idOrEmail || u.Email == users.NormalizeEmail(idOrEmail)
+}
+
+// UpdateUserHandler deals with requests updating the user identified, by
+// ID or email address, in the URL. Users can only update their own
+// account.
+func UpdateUserHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isUser(user, pat.Param(r, "userId")) {
+		return newHTTPError(http.StatusForbidden, "users can only update their own account")
+	}
+
+	req := updateUserRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	updated, err := s.UpdateUser(r.Context(), user.ID, users.Patch(req))
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, updated)
+}
+
+// emailChangeRequest is the payload of requests changing the email
+// address of users.
+type emailChangeRequest struct {
+	Email string `json:"email"`
+}
+
+// Validate checks the new email address.
+func (req emailChangeRequest) Validate() error {
+	v := validation.Validator{}
+	users.CheckEmail(&v, req.Email)
+
+	return v.Err()
+}
+
+// RequestEmailChangeHandler deals with requests changing the email
+// address of the user identified, by ID or email address, in the URL. A
+// verification token is sent to the new address, which replaces the
+// current one once the token is confirmed. Users can only change their
+// own address.
+func RequestEmailChangeHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isUser(user, pat.Param(r, "userId")) {
+		return newHTTPError(http.StatusForbidden, "users can only change their own email address")
+	}
+
+	req := emailChangeRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	if err := s.RequestEmailChange(r.Context(), user.ID, req.Email); err != nil {
+		return storeError(err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+// confirmEmailChangeRequest is the payload of requests confirming the
+// change of an email address.
+type confirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+// Validate checks that the verification token is set.
+func (req confirmEmailChangeRequest) Validate() error {
+	v := validation.Validator{}
+	v.Required("token", req.Token)
+
+	return v.Err()
+}
+
+// ConfirmEmailChangeHandler deals with requests redeeming the
+// verification token sent to the new email address of the user
+// identified, by ID or email address, in the URL. It returns the updated
+// user.
+func ConfirmEmailChangeHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isUser(user, pat.Param(r, "userId")) {
+		return newHTTPError(http.StatusForbidden, "users can only change their own email address")
+	}
+
+	req := confirmEmailChangeRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	updated, err := s.ConfirmEmailChange(r.Context(), user.ID, req.Token)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, updated)
+}
+
+// assignRoleRequest is the payload of requests assigning roles.
+type assignRoleRequest users.RoleAssignment
+
+// Validate checks the role and the represented artists.
+func (req assignRoleRequest) Validate() error {
+	return users.RoleAssignment(req).Validate()
+}
+
+// AssignRoleHandler deals with requests giving a role to the user
+// identified, by ID or email address, in the URL. Only admins can assign
+// roles.
+func AssignRoleHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if httpErr := requirePermission(user, "only admins can assign roles", users.AssignRoles); httpErr != nil {
+		return httpErr
+	}
+
+	req := assignRoleRequest{}
+	if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+		return httpErr
+	}
+
+	target, err := s.GetUser(r.Context(), pat.Param(r, "userId"))
+	if err != nil {
+		return storeError(err)
+	}
+
+	updated, err := s.AssignRole(r.Context(), target.ID, users.RoleAssignment(req))
+	if err != nil {
+		return storeError(err)
+	}
+
+	return writeJSON(w, updated)
+}
+
+// DeleteUserHandler deals with requests deleting the user identified, by
+// ID or email address, in the URL. Users can delete their own account,
+// while admins can delete any account. Users who own certificates or are
+// the recipient of pending transfers are deleted only when admins set the
+// reassignTo query parameter to the ID or email address of the user who
+// is given their certificates. Other users transfer their certificates,
+// which recipients must accept, before deleting their account.
+func DeleteUserHandler(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+	user, httpErr := authenticatedUser(r)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	if !isUser(user, pat.Param(r, "userId")) && !user.Can(users.ManageUsers) {
+		return newHTTPError(http.StatusForbidden, "users can only delete their own account")
+	}
+
+	target, err := s.GetUser(r.Context(), pat.Param(r, "userId"))
+	if err != nil {
+		return storeError(err)
+	}
+
+	reassignTo := r.URL.Query().Get("reassignTo")
+	if reassignTo != "" && !user.Can(users.ManageUsers) {
+		return newHTTPError(http.StatusForbidden, "only admins can reassign certificates. Transfer them before deleting the account")
+	}
+	if reassignTo != "" {
+		to, err := s.GetUser(r.Context(), reassignTo)
+		if errors.Is(err, store.ErrNotFound) {
+			return newHTTPError(http.StatusUnprocessableEntity, "certificates can only be reassigned to an existing user")
+		}
+		if err != nil {
+			return storeError(err)
+		}
+		reassignTo = to.ID
+	}
+
+	if err := s.DeleteUser(r.Context(), target.ID, reassignTo); err != nil {
+		return storeError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
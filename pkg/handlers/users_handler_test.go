@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -12,43 +15,61 @@ import (
 	"goji.io/pat"
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ids"
+	"github.com/Popcore/verisart/pkg/notify"
 	store "github.com/Popcore/verisart/pkg/store"
+	users "github.com/Popcore/verisart/pkg/users"
 )
 
 func TestListUserCertsHandlerOK(t *testing.T) {
 	mux := goji.NewMux()
 	memStore := store.NewMemStore()
-	memStore.NewUser("owner1@email.com", "joe blog")
-	memStore.NewUser("owner2@email.com", "miss smith")
+	owner1, _ := newTestUser(t, memStore, "owner1@email.com")
+	owner2, _ := newTestUser(t, memStore, "owner2@email.com")
 
-	_, err := memStore.CreateCert(cert.Certificate{
+	_, err := memStore.CreateCert(ctx, owner1.ID, cert.Certificate{
 		Title:   "my cert1",
-		OwnerID: "owner1@email.com",
+		OwnerID: owner1.ID,
 		Year:    2018,
 	})
 
-	_, err = memStore.CreateCert(cert.Certificate{
+	_, err = memStore.CreateCert(ctx, owner1.ID, cert.Certificate{
 		Title:   "my cert2",
-		OwnerID: "owner1@email.com",
+		OwnerID: owner1.ID,
 		Year:    2018,
 	})
 
-	_, err = memStore.CreateCert(cert.Certificate{
+	_, err = memStore.CreateCert(ctx, owner2.ID, cert.Certificate{
 		Title:   "my cert3",
-		OwnerID: "owner2@email.com",
+		OwnerID: owner2.ID,
 		Year:    2018,
 	})
 	assert.Nil(t, err)
 
 	mux.Handle(pat.Get("/users/:userId/certificates"), Handler{S: memStore, H: ListUserCertsHandler})
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("/users/%s/certificates", "owner1@email.com"), nil)
+	// owners can be identified either by ID or by email address
+	for _, userID := range []string{owner1.ID, "owner1@email.com"} {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/users/%s/certificates", userID), nil)
+		assert.Nil(t, err)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		certs := []cert.Certificate{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &certs))
+		assert.Len(t, certs, 2)
+	}
+
+	req, err := http.NewRequest("GET", "/users/i-dont-exist@email.com/certificates", nil)
 	assert.Nil(t, err)
 
 	recorder := httptest.NewRecorder()
 
 	mux.ServeHTTP(recorder, req)
-	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
 }
 
 func TestNewUserHandlerOK(t *testing.T) {
@@ -69,6 +90,19 @@ func TestNewUserHandlerOK(t *testing.T) {
 
 	mux.ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	// the response includes the token authenticating the new user
+	resp := struct {
+		Email string `json:"email"`
+		Token string `json:"token"`
+	}{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "test@email.com", resp.Email)
+
+	user, err := memStore.Authenticate(ctx, resp.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, "test@email.com", user.Email)
 }
 
 func TestNewUserHandlerErrInvalidPayload(t *testing.T) {
@@ -80,6 +114,7 @@ func TestNewUserHandlerErrInvalidPayload(t *testing.T) {
 	input := `{invalid-json`
 	expected := `{
 		"httpStatus": 400,
+		"code": "bad_request",
 		"error": "invalid json payload"
 	}`
 
@@ -102,7 +137,9 @@ func TestNewUserHandlerErrMissingFields(t *testing.T) {
 	input := `{"email": "test@email.com"}`
 	expected := `{
 		"httpStatus": 422,
-		"error": "user email and name must be set in the request body"
+		"code": "validation_failed",
+		"error": "the request payload is not valid",
+		"fields": [{"field": "name", "error": "is required"}]
 	}`
 
 	req, err := http.NewRequest("POST", "/users", strings.NewReader(input))
@@ -114,3 +151,348 @@ func TestNewUserHandlerErrMissingFields(t *testing.T) {
 	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
 	assert.JSONEq(t, expected, recorder.Body.String())
 }
+
+// newUsersMux returns a mux serving the user management endpoints with
+// a memory store holding a user for each email address. It returns the
+// API tokens of the users by email address.
+func newUsersMux(t *testing.T, emails ...string) (*goji.Mux, store.Storer, map[string]string) {
+	memStore := store.NewMemStore(store.WithIDGenerator(&ids.Sequence{}))
+	tokens := map[string]string{}
+	for _, email := range emails {
+		_, tokens[email] = newTestUser(t, memStore, email)
+	}
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Get("/users"), Handler{S: memStore, H: ListUsersHandler})
+	mux.Handle(pat.Get("/users/:userId"), Handler{S: memStore, H: GetUserHandler})
+	mux.Handle(pat.Patch("/users/:userId"), Handler{S: memStore, H: UpdateUserHandler})
+	mux.Handle(pat.Delete("/users/:userId"), Handler{S: memStore, H: DeleteUserHandler})
+
+	return mux, memStore, tokens
+}
+
+func TestListUsersHandlerOK(t *testing.T) {
+	mux, memStore, tokens := newUsersMux(t, "alice@email.com", "bob@email.com", "anna@email.com")
+
+	_, err := memStore.AssignRole(ctx, "00000000-0000-0000-0000-000000000002", users.RoleAssignment{Role: users.Admin})
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest("GET", "/users?email=a&limit=1", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens["bob@email.com"])
+
+	expected := `{
+		"users": [{"id": "00000000-0000-0000-0000-000000000001", "email": "alice@email.com", "name": "test-user", "role": "collector"}],
+		"offset": 0,
+		"limit": 1,
+		"total": 2
+	}`
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, expected, recorder.Body.String())
+
+	// listing users requires authentication
+	req, err = http.NewRequest("GET", "/users", nil)
+	assert.Nil(t, err)
+
+	recorder = httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// and is reserved to admins
+	req, err = http.NewRequest("GET", "/users", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens["alice@email.com"])
+
+	recorder = httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"httpStatus": 403, "code": "forbidden", "error": "only admins can list users"}`, recorder.Body.String())
+}
+
+func TestGetUserHandler(t *testing.T) {
+	mux, memStore, tokens := newUsersMux(t, "alice@email.com", "bob@email.com")
+	_, adminToken := newTestAdmin(t, memStore, "admin@email.com")
+
+	bob := `{"id": "00000000-0000-0000-0000-000000000002", "email": "bob@email.com", "name": "test-user", "role": "collector"}`
+
+	// users retrieve their own account, while admins retrieve any account
+	tests := []struct {
+		userID   string
+		token    string
+		code     int
+		expected string
+	}{
+		{"bob@email.com", tokens["bob@email.com"], http.StatusOK, bob},
+		{"00000000-0000-0000-0000-000000000002", tokens["bob@email.com"], http.StatusOK, bob},
+		{"bob@email.com", tokens["alice@email.com"], http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "users can only retrieve their own account"}`},
+		{"carol@email.com", tokens["alice@email.com"], http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "users can only retrieve their own account"}`},
+		{"bob@email.com", adminToken, http.StatusOK, bob},
+		{"carol@email.com", adminToken, http.StatusNotFound, `{"httpStatus": 404, "code": "not_found", "error": "user not found"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/users/"+test.userID, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.userID)
+		assert.JSONEq(t, test.expected, recorder.Body.String(), test.userID)
+	}
+}
+
+func TestUpdateUserHandler(t *testing.T) {
+	mux, _, tokens := newUsersMux(t, "alice@email.com", "bob@email.com")
+
+	// users are identified either by ID or by email address
+	tests := []struct {
+		userID   string
+		input    string
+		code     int
+		expected string
+	}{
+		{"alice@email.com", `{"name": "Alice Smith"}`, http.StatusOK, `{"id": "00000000-0000-0000-0000-000000000001", "email": "alice@email.com", "name": "Alice Smith", "role": "collector"}`},
+		{"00000000-0000-0000-0000-000000000001", `{"name": ""}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "name", "error": "is required"}]
+		}`},
+		{"00000000-0000-0000-0000-000000000001", `{"id": "another-id"}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "id", "error": "unknown field"}]
+		}`},
+		// email addresses are changed with a verification token
+		{"00000000-0000-0000-0000-000000000001", `{"email": "alice.smith@email.com"}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "email", "error": "unknown field"}]
+		}`},
+		{"bob@email.com", `{"name": "Bob Jones"}`, http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "users can only update their own account"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("PATCH", "/users/"+test.userID, strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+tokens["alice@email.com"])
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.input)
+		assert.JSONEq(t, test.expected, recorder.Body.String(), test.input)
+	}
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	mux, memStore, tokens := newUsersMux(t, "alice@email.com", "bob@email.com")
+	_, adminToken := newTestAdmin(t, memStore, "admin@email.com")
+
+	_, err := memStore.CreateCert(ctx, "00000000-0000-0000-0000-000000000001", cert.Certificate{Title: "the-title", OwnerID: "00000000-0000-0000-0000-000000000001", Year: 2018})
+	assert.Nil(t, err)
+
+	alice := tokens["alice@email.com"]
+
+	// users cannot push their certificates onto another user, since
+	// recipients must accept transfers: only admins reassign them
+	tests := []struct {
+		target   string
+		token    string
+		code     int
+		expected string
+	}{
+		{"/users/bob@email.com", alice, http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "users can only delete their own account"}`},
+		{"/users/alice@email.com", alice, http.StatusConflict, `{"httpStatus": 409, "code": "conflict", "error": "the user owns certificates or has pending transfers. Set a user to reassign them to"}`},
+		{"/users/alice@email.com?reassignTo=bob@email.com", alice, http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "only admins can reassign certificates. Transfer them before deleting the account"}`},
+		{"/users/alice@email.com?reassignTo=carol@email.com", adminToken, http.StatusUnprocessableEntity, `{"httpStatus": 422, "code": "validation_failed", "error": "certificates can only be reassigned to an existing user"}`},
+		{"/users/00000000-0000-0000-0000-000000000001?reassignTo=bob@email.com", adminToken, http.StatusNoContent, ``},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("DELETE", test.target, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.target)
+		if test.expected != "" {
+			assert.JSONEq(t, test.expected, recorder.Body.String(), test.target)
+		}
+	}
+
+	certs, err := memStore.GetCerts(ctx, "00000000-0000-0000-0000-000000000002")
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+
+	// the certificate was given to bob, who must now transfer it before
+	// deleting their account
+	req, err := http.NewRequest("DELETE", "/users/bob@email.com", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens["bob@email.com"])
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestAdminsDeleteUsers(t *testing.T) {
+	mux, memStore, tokens := newUsersMux(t, "alice@email.com", "bob@email.com")
+	_, adminToken := newTestAdmin(t, memStore, "admin@email.com")
+
+	req, err := http.NewRequest("DELETE", "/users/bob@email.com", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// the deleted user is gone, not the admin
+	_, err = memStore.GetUser(ctx, "bob@email.com")
+	assert.True(t, errors.Is(err, store.ErrNotFound))
+
+	_, err = memStore.Authenticate(ctx, adminToken)
+	assert.Nil(t, err)
+
+	_, err = memStore.Authenticate(ctx, tokens["bob@email.com"])
+	assert.True(t, errors.Is(err, store.ErrNotFound))
+
+	req, err = http.NewRequest("DELETE", "/users/i-dont-exist@email.com", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	recorder = httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestEmailChangeHandlers(t *testing.T) {
+	n := &notify.Memory{}
+	memStore := store.NewMemStore(store.WithIDGenerator(&ids.Sequence{}), store.WithNotifier(n))
+	_, token := newTestUser(t, memStore, "alice@email.com")
+	newTestUser(t, memStore, "bob@email.com")
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/users/:userId/email"), Handler{S: memStore, H: RequestEmailChangeHandler})
+	mux.Handle(pat.Post("/users/:userId/email/confirm"), Handler{S: memStore, H: ConfirmEmailChangeHandler})
+
+	tests := []struct {
+		target   string
+		input    string
+		code     int
+		expected string
+	}{
+		{"/users/bob@email.com/email", `{"email": "new@email.com"}`, http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "users can only change their own email address"}`},
+		{"/users/alice@email.com/email", `{"email": "not-an-email"}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "email", "error": "must be a valid email address"}]
+		}`},
+		{"/users/alice@email.com/email", `{"email": "Bob@email.com"}`, http.StatusConflict, `{"httpStatus": 409, "code": "conflict", "error": "a user with the same email address already exists"}`},
+		{"/users/00000000-0000-0000-0000-000000000001/email/confirm", `{"token": ""}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "token", "error": "is required"}]
+		}`},
+		{"/users/00000000-0000-0000-0000-000000000001/email/confirm", `{"token": "not-a-token"}`, http.StatusNotFound, `{"httpStatus": 404, "code": "not_found", "error": "invalid verification token"}`},
+		{"/users/ALICE@email.com/email", `{"email": "Alice.Smith@email.com"}`, http.StatusAccepted, ``},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", test.target, strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.input)
+		if test.expected != "" {
+			assert.JSONEq(t, test.expected, recorder.Body.String(), test.input)
+		}
+	}
+
+	msg, ok := n.Last("alice.smith@email.com")
+	if !assert.True(t, ok) {
+		return
+	}
+	verification := regexp.MustCompile(`[0-9a-f]{64}`).FindString(msg.Body)
+
+	req, err := http.NewRequest("POST", "/users/alice@email.com/email/confirm", strings.NewReader(`{"token": "`+verification+`"}`))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"id": "00000000-0000-0000-0000-000000000001", "email": "alice.smith@email.com", "name": "test-user", "role": "collector"}`, recorder.Body.String())
+}
+
+func TestAssignRoleHandler(t *testing.T) {
+	memStore := store.NewMemStore(store.WithIDGenerator(&ids.Sequence{}))
+	_, adminToken := newTestAdmin(t, memStore, "admin@email.com")
+	_, aliceToken := newTestUser(t, memStore, "alice@email.com")
+	newTestUser(t, memStore, "bob@email.com")
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Put("/users/:userId/role"), Handler{S: memStore, H: AssignRoleHandler})
+
+	tests := []struct {
+		target   string
+		token    string
+		input    string
+		code     int
+		expected string
+	}{
+		{"/users/bob@email.com/role", aliceToken, `{"role": "artist"}`, http.StatusForbidden, `{"httpStatus": 403, "code": "forbidden", "error": "only admins can assign roles"}`},
+		{"/users/bob@email.com/role", adminToken, `{"role": "curator"}`, http.StatusUnprocessableEntity, `{
+			"httpStatus": 422,
+			"code": "validation_failed",
+			"error": "the request payload is not valid",
+			"fields": [{"field": "role", "error": "must be 'collector', 'artist', 'gallery' or 'admin'"}]
+		}`},
+		{"/users/carol@email.com/role", adminToken, `{"role": "artist"}`, http.StatusNotFound, `{"httpStatus": 404, "code": "not_found", "error": "user not found"}`},
+		{"/users/alice@email.com/role", adminToken, `{"role": "gallery", "represents": ["00000000-0000-0000-0000-000000000003"]}`, http.StatusUnprocessableEntity,
+			`{"httpStatus": 422, "code": "validation_failed", "error": "galleries can only represent existing artists"}`},
+		{"/users/bob@email.com/role", adminToken, `{"role": "artist"}`, http.StatusOK,
+			`{"id": "00000000-0000-0000-0000-000000000003", "email": "bob@email.com", "name": "test-user", "role": "artist"}`},
+		{"/users/alice@email.com/role", adminToken, `{"role": "gallery", "represents": ["00000000-0000-0000-0000-000000000003"]}`, http.StatusOK,
+			`{"id": "00000000-0000-0000-0000-000000000002", "email": "alice@email.com", "name": "test-user", "role": "gallery", "represents": ["00000000-0000-0000-0000-000000000003"]}`},
+		{"/users/admin@email.com/role", adminToken, `{"role": "collector"}`, http.StatusConflict,
+			`{"httpStatus": 409, "code": "conflict", "error": "the last admin cannot be given another role"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("PUT", test.target, strings.NewReader(test.input))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+
+		recorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(recorder, req)
+		assert.Equal(t, test.code, recorder.Code, test.target+" "+test.input)
+		assert.JSONEq(t, test.expected, recorder.Body.String(), test.target+" "+test.input)
+	}
+}
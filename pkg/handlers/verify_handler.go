@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+	store "github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/validation"
+	"github.com/Popcore/verisart/pkg/verification"
+)
+
+// verifyRequest is the payload of requests verifying a certificate
+// document. It holds the certificate as it was handed to the requester.
+type verifyRequest cert.Certificate
+
+// Validate checks that the document identifies a certificate.
+func (req verifyRequest) Validate() error {
+	v := validation.Validator{}
+	v.Required("id", req.ID)
+
+	return v.Err()
+}
+
+// VerifyCertHandler returns a handler that checks a certificate document
+// against the record held in the store and the signatures made with k.
+// Requests do not need to be authenticated, except to verify the
+// certificates of an organization, which only the members allowed to view
+// them can verify. Verdicts are returned with a 200 status whatever their
+// outcome.
+func VerifyCertHandler(k *signing.Key) handler {
+	return func(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+		req := verifyRequest{}
+		if httpErr := decodeJSON(w, r, &req); httpErr != nil {
+			return httpErr
+		}
+
+		stored, httpErr := storedCert(r.Context(), s, req.ID)
+		if httpErr != nil {
+			return httpErr
+		}
+		if stored != nil {
+			if httpErr := requireViewPermission(s, r, stored.OwnerID); httpErr != nil {
+				return httpErr
+			}
+		}
+
+		return writeJSON(w, verification.Verify(cert.Certificate(req), stored, k.PublicKey()))
+	}
+}
+
+// VerifyStoredCertHandler returns a handler that checks the signature of
+// the certificate identified in the URL. Requests do not need to be
+// authenticated, except to verify the certificates of an organization.
+func VerifyStoredCertHandler(k *signing.Key) handler {
+	return func(s store.Storer, w http.ResponseWriter, r *http.Request) *HTTPError {
+		stored, httpErr := storedCert(r.Context(), s, pat.Param(r, "id"))
+		if httpErr != nil {
+			return httpErr
+		}
+		if stored != nil {
+			if httpErr := requireViewPermission(s, r, stored.OwnerID); httpErr != nil {
+				return httpErr
+			}
+		}
+
+		return writeJSON(w, verification.VerifyStored(stored, k.PublicKey()))
+	}
+}
+
+// storedCert returns the certificate identified by id, or nil if it is
+// not in the store.
+func storedCert(ctx context.Context, s store.Storer, id string) (*cert.Certificate, *HTTPError) {
+	c, err := s.GetCert(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return c, nil
+}
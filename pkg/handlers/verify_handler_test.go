@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	goji "goji.io"
+	"goji.io/pat"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+	store "github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/verification"
+)
+
+// newVerifyMux returns a mux serving the verification endpoints backed by
+// a store whose certificates are signed with a new key.
+func newVerifyMux(t *testing.T) (*goji.Mux, store.Storer) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	memStore := store.NewMemStore(store.WithSigner(key))
+
+	mux := goji.NewMux()
+	mux.Use(Authenticate(memStore))
+	mux.Handle(pat.Post("/verify"), Handler{S: memStore, H: VerifyCertHandler(key)})
+	mux.Handle(pat.Get("/certificates/:id/verify"), Handler{S: memStore, H: VerifyStoredCertHandler(key)})
+
+	return mux, memStore
+}
+
+// verify sends req to mux and returns the verdict in the response.
+func verify(t *testing.T, mux *goji.Mux, req *http.Request) verification.Verdict {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	v := verification.Verdict{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &v))
+
+	return v
+}
+
+func TestVerifyCertHandler(t *testing.T) {
+	mux, memStore := newVerifyMux(t)
+	owner1, _ := newTestUser(t, memStore, "owner1@email.com")
+	owner2, _ := newTestUser(t, memStore, "owner2@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	doc, err := json.Marshal(created)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest("POST", "/verify", strings.NewReader(string(doc)))
+	assert.Nil(t, err)
+	v := verify(t, mux, req)
+	assert.Equal(t, verification.Valid, v.Status)
+	assert.True(t, v.Valid)
+
+	// a document with a modified title does not match its signature
+	tampered := strings.Replace(string(doc), "the-title", "a-better-title", 1)
+	req, err = http.NewRequest("POST", "/verify", strings.NewReader(tampered))
+	assert.Nil(t, err)
+	assert.Equal(t, verification.Tampered, verify(t, mux, req).Status)
+
+	_, err = memStore.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+	_, err = memStore.AcceptTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+
+	req, err = http.NewRequest("POST", "/verify", strings.NewReader(string(doc)))
+	assert.Nil(t, err)
+	v = verify(t, mux, req)
+	assert.Equal(t, verification.Transferred, v.Status)
+	assert.Equal(t, owner2.ID, v.Current.OwnerID)
+
+	assert.Nil(t, memStore.DeleteCert(ctx, owner2.ID, created.ID))
+
+	req, err = http.NewRequest("POST", "/verify", strings.NewReader(string(doc)))
+	assert.Nil(t, err)
+	v = verify(t, mux, req)
+	assert.Equal(t, verification.Deleted, v.Status)
+	assert.Nil(t, v.Current)
+}
+
+func TestVerifyCertHandlerErrorNoID(t *testing.T) {
+	mux, _ := newVerifyMux(t)
+
+	req, err := http.NewRequest("POST", "/verify", strings.NewReader(`{"title": "the-title"}`))
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestVerifyStoredCertHandler(t *testing.T) {
+	mux, memStore := newVerifyMux(t)
+	owner1, _ := newTestUser(t, memStore, "owner1@email.com")
+
+	created, err := memStore.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest("GET", "/certificates/"+created.ID+"/verify", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, verification.Valid, verify(t, mux, req).Status)
+
+	req, err = http.NewRequest("GET", "/certificates/i-dont-exist/verify", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, verification.Deleted, verify(t, mux, req).Status)
+}
+
+func TestVerifyHandlersOrganization(t *testing.T) {
+	mux, memStore := newVerifyMux(t)
+	manager, managerToken := newTestArtist(t, memStore, "manager@email.com")
+	_, strangerToken := newTestUser(t, memStore, "stranger@email.com")
+
+	o, err := memStore.CreateOrganization(ctx, manager.ID, "the gallery")
+	assert.Nil(t, err)
+
+	created, err := memStore.CreateCert(ctx, manager.ID, cert.Certificate{Title: "the-title", OwnerID: o.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	document, err := json.Marshal(created)
+	assert.Nil(t, err)
+
+	// the certificates of an organization are only verified for the
+	// members allowed to view them, since verdicts hold the record
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{strangerToken, http.StatusForbidden},
+		{managerToken, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		for _, recorder := range []*httptest.ResponseRecorder{
+			serve(t, mux, "GET", "/certificates/"+created.ID+"/verify", "", test.token),
+			serve(t, mux, "POST", "/verify", string(document), test.token),
+		} {
+			assert.Equal(t, test.code, recorder.Code)
+			if test.code != http.StatusOK {
+				assert.NotContains(t, recorder.Body.String(), "the-title")
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package ids generates the identifiers of stored resources.
+package ids
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/satori/go.uuid"
+)
+
+// Generator is the interface that generates unique identifiers.
+type Generator interface {
+	NewID() string
+}
+
+// UUID is a Generator of random version 4 UUIDs.
+type UUID struct{}
+
+// NewID returns a new random UUID.
+func (UUID) NewID() string {
+	return uuid.NewV4().String()
+}
+
+// Sequence is a Generator of predictable UUIDs, numbered from 1 in the
+// order they are generated. It is meant for tests and is safe for
+// concurrent use.
+type Sequence struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewID returns the next UUID of the sequence, such as
+// 00000000-0000-0000-0000-000000000001.
+func (s *Sequence) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", s.next)
+}
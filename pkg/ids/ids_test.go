@@ -0,0 +1,24 @@
+package ids
+
+import (
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequence(t *testing.T) {
+	s := &Sequence{}
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", s.NewID())
+	assert.Equal(t, "00000000-0000-0000-0000-000000000002", s.NewID())
+
+	_, err := uuid.FromString(s.NewID())
+	assert.Nil(t, err)
+}
+
+func TestUUID(t *testing.T) {
+	id := UUID{}.NewID()
+	_, err := uuid.FromString(id)
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, UUID{}.NewID())
+}
@@ -0,0 +1,222 @@
+// Package ledger implements the hash-chained logs recording the history
+// of certificates. Each entry of a chain commits to the previous one, so
+// that altering, removing or reordering past entries breaks the chain.
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventType describes what happened to a certificate.
+type EventType string
+
+const (
+	// Created is recorded when a certificate is created.
+	Created EventType = "created"
+
+	// Updated is recorded when the content of a certificate is edited.
+	Updated EventType = "updated"
+
+	// TransferCreated is recorded when a certificate transfer is started.
+	TransferCreated EventType = "transfer_created"
+
+	// TransferAccepted is recorded when a transfer is accepted by its
+	// recipient and the certificate changes owner.
+	TransferAccepted EventType = "transfer_accepted"
+
+	// TransferRejected is recorded when a transfer is declined by its
+	// recipient.
+	TransferRejected EventType = "transfer_rejected"
+
+	// TransferCancelled is recorded when a transfer is withdrawn by the
+	// certificate owner.
+	TransferCancelled EventType = "transfer_cancelled"
+
+	// TransferClaimed is recorded when the invitation of a transfer sent
+	// to a recipient who was not a user is claimed.
+	TransferClaimed EventType = "transfer_claimed"
+
+	// TransferExpired is recorded when a transfer is not resolved, or its
+	// invitation is not claimed, in time.
+	TransferExpired EventType = "transfer_expired"
+
+	// Reassigned is recorded when a certificate is given to another user
+	// because its owner was deleted.
+	Reassigned EventType = "reassigned"
+
+	// Deleted is recorded when a certificate is deleted.
+	Deleted EventType = "deleted"
+)
+
+// Entry is an event in the history of a certificate.
+type Entry struct {
+	// Seq is the position of the entry in the chain, starting at 0.
+	Seq    int       `json:"seq"`
+	CertID string    `json:"certificateId"`
+	Type   EventType `json:"type"`
+
+	// Actor is the ID of the user who caused the event. It is empty for
+	// events caused by the service itself, such as expiries.
+	Actor string `json:"actor"`
+
+	// ActorRole is the role the actor had when the event happened. It is
+	// empty for entries recorded before users had roles.
+	ActorRole string `json:"actorRole,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+
+	// Data is the JSON encoded state of the certificate or transfer
+	// after the event.
+	Data json.RawMessage `json:"data"`
+
+	// PrevHash is the hash of the previous entry. It is empty for the
+	// first entry of a chain.
+	PrevHash string `json:"prevHash"`
+
+	// Hash is the hex encoded SHA-256 hash of the entry.
+	Hash string `json:"hash"`
+}
+
+// hashedEntry lists the entry fields covered by its hash, in the order
+// they are encoded.
+type hashedEntry struct {
+	Seq       int             `json:"seq"`
+	CertID    string          `json:"certificateId"`
+	Type      EventType       `json:"type"`
+	Actor     string          `json:"actor"`
+	ActorRole string          `json:"actorRole,omitempty"`
+	Timestamp string          `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+	PrevHash  string          `json:"prevHash"`
+}
+
+// ComputeHash returns the hash of the entry: the hex encoded SHA-256 hash
+// of the compact JSON encoding of all its fields but Hash, with the
+// timestamp formatted as RFC 3339 in UTC. The actor role is left out
+// when empty, so that the hashes of the entries recorded before users had
+// roles do not change.
+func (e Entry) ComputeHash() (string, error) {
+	data := &bytes.Buffer{}
+	if len(e.Data) > 0 {
+		if err := json.Compact(data, e.Data); err != nil {
+			return "", err
+		}
+	} else {
+		data.WriteString("null")
+	}
+
+	b, err := json.Marshal(hashedEntry{
+		Seq:       e.Seq,
+		CertID:    e.CertID,
+		Type:      e.Type,
+		Actor:     e.Actor,
+		ActorRole: e.ActorRole,
+		Timestamp: e.Timestamp.UTC().Format(time.RFC3339Nano),
+		Data:      data.Bytes(),
+		PrevHash:  e.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Actor identifies the user who caused an event and the role they had.
+// The zero value is the service itself.
+type Actor struct {
+	ID   string
+	Role string
+}
+
+// Append returns a new chain made of the entries of chain followed by a
+// new entry recording an event. chain itself is never modified, so that
+// it can be safely shared with readers.
+func Append(chain []Entry, certID string, typ EventType, actor Actor, at time.Time, data interface{}) ([]Entry, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	e := Entry{
+		Seq:       len(chain),
+		CertID:    certID,
+		Type:      typ,
+		Actor:     actor.ID,
+		ActorRole: actor.Role,
+		Timestamp: at.UTC(),
+		Data:      encoded,
+	}
+
+	if len(chain) > 0 {
+		e.PrevHash = chain[len(chain)-1].Hash
+	}
+
+	e.Hash, err = e.ComputeHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(chain[:len(chain):len(chain)], e), nil
+}
+
+// BreakError is returned by Verify when a chain has been altered.
+type BreakError struct {
+	// Seq is the position of the first entry that does not fit in the chain.
+	Seq    int
+	Reason string
+}
+
+func (e *BreakError) Error() string {
+	return fmt.Sprintf("the ledger is broken at entry %d: %s", e.Seq, e.Reason)
+}
+
+// Verify checks that the entries of chain are in sequence, that each
+// entry matches its hash and that each entry commits to the previous
+// one. It returns a *BreakError locating the first inconsistency found.
+func Verify(chain []Entry) error {
+	for i, e := range chain {
+		if e.Seq != i {
+			return &BreakError{Seq: i, Reason: fmt.Sprintf("expected sequence number %d, found %d", i, e.Seq)}
+		}
+
+		if e.CertID != chain[0].CertID {
+			return &BreakError{Seq: i, Reason: "the entry belongs to another certificate"}
+		}
+
+		prevHash := ""
+		if i > 0 {
+			prevHash = chain[i-1].Hash
+		}
+		if e.PrevHash != prevHash {
+			return &BreakError{Seq: i, Reason: "the entry does not follow the previous one"}
+		}
+
+		hash, err := e.ComputeHash()
+		if err != nil {
+			return &BreakError{Seq: i, Reason: fmt.Sprintf("the entry cannot be encoded: %s", err.Error())}
+		}
+		if e.Hash != hash {
+			return &BreakError{Seq: i, Reason: "the entry does not match its hash"}
+		}
+	}
+
+	return nil
+}
+
+// Provider is the interface implemented by stores keeping the ledgers
+// of certificates.
+type Provider interface {
+	// GetLedger returns the chain of entries recording the history of the
+	// certificate identified by certID. The ledger of deleted certificates
+	// is kept.
+	GetLedger(ctx context.Context, certID string) ([]Entry, error)
+}
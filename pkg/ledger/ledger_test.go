@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newChain returns a chain recording the creation, edit and transfer of
+// a certificate.
+func newChain(t *testing.T) []Entry {
+	at := time.Date(2018, 11, 22, 12, 0, 0, 0, time.UTC)
+
+	chain, err := Append(nil, "the-id", Created, Actor{ID: "owner1@email.com"}, at, map[string]string{"title": "the-title"})
+	assert.Nil(t, err)
+	chain, err = Append(chain, "the-id", Updated, Actor{ID: "owner1@email.com", Role: "artist"}, at.Add(time.Hour), map[string]string{"title": "the-new-title"})
+	assert.Nil(t, err)
+	chain, err = Append(chain, "the-id", TransferCreated, Actor{ID: "owner1@email.com"}, at.Add(2*time.Hour), map[string]string{"email": "owner2@email.com"})
+	assert.Nil(t, err)
+
+	return chain
+}
+
+func TestAppend(t *testing.T) {
+	chain := newChain(t)
+
+	assert.Len(t, chain, 3)
+	assert.Equal(t, "", chain[0].PrevHash)
+	for i, e := range chain {
+		assert.Equal(t, i, e.Seq)
+		assert.Len(t, e.Hash, 64)
+		if i > 0 {
+			assert.Equal(t, chain[i-1].Hash, e.PrevHash)
+		}
+	}
+
+	// appending never modifies the original chain
+	shorter := chain[:2]
+	longer, err := Append(shorter, "the-id", Deleted, Actor{ID: "owner1@email.com"}, time.Now(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, TransferCreated, chain[2].Type)
+	assert.Equal(t, Deleted, longer[2].Type)
+	assert.Nil(t, Verify(longer))
+}
+
+func TestVerify(t *testing.T) {
+	assert.Nil(t, Verify(nil))
+	assert.Nil(t, Verify(newChain(t)))
+
+	// the chain survives a round trip through indented JSON
+	b, err := json.MarshalIndent(newChain(t), "", "  ")
+	assert.Nil(t, err)
+	decoded := []Entry{}
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Nil(t, Verify(decoded))
+
+	tests := []struct {
+		name    string
+		alter   func([]Entry) []Entry
+		brokeAt int
+	}{
+		{"edited data", func(c []Entry) []Entry {
+			c[1].Data = json.RawMessage(`{"title":"another-title"}`)
+			return c
+		}, 1},
+		{"edited actor", func(c []Entry) []Entry {
+			c[0].Actor = "someone@email.com"
+			return c
+		}, 0},
+		{"edited actor role", func(c []Entry) []Entry {
+			c[1].ActorRole = "admin"
+			return c
+		}, 1},
+		{"rehashed entry", func(c []Entry) []Entry {
+			c[1].Actor = "someone@email.com"
+			c[1].Hash, _ = c[1].ComputeHash()
+			return c
+		}, 2},
+		{"removed entry", func(c []Entry) []Entry {
+			return append(c[:1], c[2:]...)
+		}, 1},
+		{"reordered entries", func(c []Entry) []Entry {
+			c[1], c[2] = c[2], c[1]
+			return c
+		}, 1},
+		{"other certificate", func(c []Entry) []Entry {
+			c[2].CertID = "another-id"
+			return c
+		}, 2},
+	}
+
+	for _, test := range tests {
+		err := Verify(test.alter(newChain(t)))
+
+		breakErr, ok := err.(*BreakError)
+		if assert.True(t, ok, test.name) {
+			assert.Equal(t, test.brokeAt, breakErr.Seq, test.name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package logging writes leveled log messages with the standard logger.
+// Messages below the configured level are discarded.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message.
+type Level int32
+
+const (
+	// Debug messages help diagnosing problems.
+	Debug Level = iota
+
+	// Info messages describe the normal operation of the application.
+	Info
+
+	// Warn messages describe unexpected conditions the application
+	// recovered from.
+	Warn
+
+	// Error messages describe operations that failed.
+	Error
+)
+
+var levelNames = map[Level]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level called name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+
+	return Info, fmt.Errorf("unknown log level %q", name)
+}
+
+// level is the minimum level of the messages that are logged.
+var level = int32(Info)
+
+// SetLevel discards the messages below l. Messages of level info and
+// above are logged by default.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+func logf(l Level, format string, v ...interface{}) {
+	if int32(l) < atomic.LoadInt32(&level) {
+		return
+	}
+
+	log.Printf("["+l.String()+"] "+format, v...)
+}
+
+// Debugf logs a debug message.
+func Debugf(format string, v ...interface{}) {
+	logf(Debug, format, v...)
+}
+
+// Infof logs an info message.
+func Infof(format string, v ...interface{}) {
+	logf(Info, format, v...)
+}
+
+// Warnf logs a warning.
+func Warnf(format string, v ...interface{}) {
+	logf(Warn, format, v...)
+}
+
+// Errorf logs an error.
+func Errorf(format string, v ...interface{}) {
+	logf(Error, format, v...)
+}
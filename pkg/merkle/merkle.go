@@ -0,0 +1,262 @@
+// Package merkle implements the Merkle trees used by append-only
+// transparency logs, as specified in RFC 6962: tree hashes, inclusion
+// (audit) proofs, consistency proofs and their verification.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Leaf and node hashes are prefixed differently so that a leaf can never
+// be mistaken for an inner node.
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// ErrInvalidProof is returned when a proof does not match the tree
+// hashes it is checked against.
+var ErrInvalidProof = errors.New("the proof is not valid")
+
+// LeafHash returns the hash of a leaf holding data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+// nodeHash returns the hash of an inner node with the given children.
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
+
+// Tree is an append-only Merkle tree. It keeps the hashes of its leaves
+// and computes the hash of the tree, or of any of its previous versions,
+// on demand.
+// Tree is not safe for concurrent use.
+type Tree struct {
+	leaves [][]byte
+}
+
+// Append adds a leaf holding data to the tree and returns its index.
+func (t *Tree) Append(data []byte) int {
+	t.leaves = append(t.leaves, LeafHash(data))
+
+	return len(t.leaves) - 1
+}
+
+// Size returns the number of leaves of the tree.
+func (t *Tree) Size() int {
+	return len(t.leaves)
+}
+
+// LeafHash returns the hash of the leaf at index.
+func (t *Tree) LeafHash(index int) ([]byte, error) {
+	if index < 0 || index >= len(t.leaves) {
+		return nil, fmt.Errorf("leaf index %d is out of range", index)
+	}
+
+	return t.leaves[index], nil
+}
+
+// Root returns the hash of the tree made of the first size leaves.
+func (t *Tree) Root(size int) ([]byte, error) {
+	if size < 0 || size > len(t.leaves) {
+		return nil, fmt.Errorf("tree size %d is out of range", size)
+	}
+
+	return rootHash(t.leaves[:size]), nil
+}
+
+// InclusionProof returns the audit path proving that the leaf at index is
+// part of the tree made of the first size leaves.
+func (t *Tree) InclusionProof(index, size int) ([][]byte, error) {
+	if size < 1 || size > len(t.leaves) {
+		return nil, fmt.Errorf("tree size %d is out of range", size)
+	}
+
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf("leaf index %d is out of range for tree size %d", index, size)
+	}
+
+	return auditPath(index, t.leaves[:size]), nil
+}
+
+// ConsistencyProof returns the proof that the tree made of the first
+// first leaves is a prefix of the tree made of the first second leaves.
+func (t *Tree) ConsistencyProof(first, second int) ([][]byte, error) {
+	if second < 1 || second > len(t.leaves) {
+		return nil, fmt.Errorf("tree size %d is out of range", second)
+	}
+
+	if first < 1 || first > second {
+		return nil, fmt.Errorf("tree size %d is out of range for tree size %d", first, second)
+	}
+
+	return subProof(first, t.leaves[:second], true), nil
+}
+
+// split returns the largest power of two smaller than n, n > 1.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+
+	return k
+}
+
+// rootHash returns the Merkle tree hash of a list of leaf hashes.
+func rootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+
+	k := split(len(leaves))
+
+	return nodeHash(rootHash(leaves[:k]), rootHash(leaves[k:]))
+}
+
+// auditPath returns the audit path of the leaf at index m.
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return [][]byte{}
+	}
+
+	k := split(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), rootHash(leaves[k:]))
+	}
+
+	return append(auditPath(m-k, leaves[k:]), rootHash(leaves[:k]))
+}
+
+// subProof returns the consistency proof between the first m leaves and
+// all the leaves. complete is true when the tree made of the first m
+// leaves is a complete subtree whose hash is known to the verifier.
+func subProof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{rootHash(leaves)}
+	}
+
+	k := split(n)
+	if m <= k {
+		return append(subProof(m, leaves[:k], complete), rootHash(leaves[k:]))
+	}
+
+	return append(subProof(m-k, leaves[k:], false), rootHash(leaves[:k]))
+}
+
+// VerifyInclusion checks that proof proves that the leaf with hash
+// leafHash is at index in the tree of the given size whose hash is root.
+func VerifyInclusion(index, size int, leafHash []byte, proof [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return ErrInvalidProof
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInvalidProof
+	}
+
+	return nil
+}
+
+// VerifyConsistency checks that proof proves that the tree of size first
+// whose hash is firstRoot is a prefix of the tree of size second whose
+// hash is secondRoot.
+func VerifyConsistency(first, second int, firstRoot, secondRoot []byte, proof [][]byte) error {
+	if first < 1 || first > second {
+		return ErrInvalidProof
+	}
+
+	if first == second {
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrInvalidProof
+		}
+		return nil
+	}
+
+	// when the first tree is complete its hash is the first node of
+	// the path
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	if len(proof) == 0 {
+		return ErrInvalidProof
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrInvalidProof
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTree returns a tree with n leaves.
+func newTree(n int) *Tree {
+	t := &Tree{}
+	for i := 0; i < n; i++ {
+		t.Append([]byte(fmt.Sprintf("leaf-%d", i)))
+	}
+
+	return t
+}
+
+func TestRoot(t *testing.T) {
+	tree := &Tree{}
+
+	// the hash of the empty tree is the hash of the empty string
+	root, err := tree.Root(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(root))
+
+	tree.Append([]byte("a"))
+	tree.Append([]byte("b"))
+	tree.Append([]byte("c"))
+
+	a, b, c := LeafHash([]byte("a")), LeafHash([]byte("b")), LeafHash([]byte("c"))
+
+	root, err = tree.Root(1)
+	assert.Nil(t, err)
+	assert.Equal(t, a, root)
+
+	root, err = tree.Root(3)
+	assert.Nil(t, err)
+	assert.Equal(t, nodeHash(nodeHash(a, b), c), root)
+
+	_, err = tree.Root(4)
+	assert.NotNil(t, err)
+}
+
+func TestInclusionProofs(t *testing.T) {
+	tree := newTree(17)
+
+	for size := 1; size <= tree.Size(); size++ {
+		root, err := tree.Root(size)
+		assert.Nil(t, err)
+
+		for index := 0; index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			assert.Nil(t, err)
+
+			leaf, err := tree.LeafHash(index)
+			assert.Nil(t, err)
+
+			assert.Nil(t, VerifyInclusion(index, size, leaf, proof, root), "index %d size %d", index, size)
+
+			// the proof does not hold for another leaf or tree
+			other, _ := tree.LeafHash((index + 1) % size)
+			if size > 1 {
+				assert.Equal(t, ErrInvalidProof, VerifyInclusion(index, size, other, proof, root))
+			}
+			if size < tree.Size() {
+				nextRoot, _ := tree.Root(size + 1)
+				assert.Equal(t, ErrInvalidProof, VerifyInclusion(index, size, leaf, proof, nextRoot))
+			}
+		}
+	}
+
+	_, err := tree.InclusionProof(17, 17)
+	assert.NotNil(t, err)
+	_, err = tree.InclusionProof(0, 18)
+	assert.NotNil(t, err)
+}
+
+func TestConsistencyProofs(t *testing.T) {
+	tree := newTree(17)
+
+	for second := 1; second <= tree.Size(); second++ {
+		secondRoot, err := tree.Root(second)
+		assert.Nil(t, err)
+
+		for first := 1; first <= second; first++ {
+			firstRoot, err := tree.Root(first)
+			assert.Nil(t, err)
+
+			proof, err := tree.ConsistencyProof(first, second)
+			assert.Nil(t, err)
+
+			assert.Nil(t, VerifyConsistency(first, second, firstRoot, secondRoot, proof), "first %d second %d", first, second)
+
+			// a rewritten history is detected
+			assert.Equal(t, ErrInvalidProof, VerifyConsistency(first, second, LeafHash([]byte("forged")), secondRoot, proof))
+		}
+	}
+
+	_, err := tree.ConsistencyProof(0, 3)
+	assert.NotNil(t, err)
+	_, err = tree.ConsistencyProof(4, 3)
+	assert.NotNil(t, err)
+}
+
+func TestConsistencyProofRFC6962Example(t *testing.T) {
+	// the example from section 2.1.3 of RFC 6962: the proof between the
+	// trees of 3 and 7 leaves is made of c, d, g and l
+	tree := newTree(7)
+	leaf := func(i int) []byte {
+		h, _ := tree.LeafHash(i)
+		return h
+	}
+
+	c := leaf(2)
+	d := leaf(3)
+	g := nodeHash(leaf(0), leaf(1))
+	l := nodeHash(nodeHash(leaf(4), leaf(5)), leaf(6))
+
+	proof, err := tree.ConsistencyProof(3, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{c, d, g, l}, proof)
+}
@@ -1,23 +1,39 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/organizations"
+	"github.com/Popcore/verisart/pkg/store"
+	"github.com/Popcore/verisart/pkg/transparency"
 	"github.com/Popcore/verisart/pkg/users"
 )
 
 // MockStore is a mock implementation of the Storer interface.MockStore
 // It must be used for testing purposes only.
 type MockStore struct {
-	Err   error
-	Certs []cert.Certificate
-	Cert  cert.Certificate
-	Txs   []cert.Transaction
-	Tx    cert.Transaction
-	User  users.User
+	Err    error
+	Certs  []cert.Certificate
+	Cert   cert.Certificate
+	Txs    []cert.Transaction
+	Tx     cert.Transaction
+	User   users.User
+	Users  []users.User
+	Token  string
+	Ledger []ledger.Entry
+	Org    organizations.Organization
+	Orgs   []organizations.Organization
+
+	TreeHead         transparency.TreeHead
+	InclusionProof   transparency.InclusionProof
+	ConsistencyProof transparency.ConsistencyProof
 }
 
 // CreateCert mock
-func (m MockStore) CreateCert(c cert.Certificate) (*cert.Certificate, error) {
+func (m MockStore) CreateCert(ctx context.Context, userID string, c cert.Certificate) (*cert.Certificate, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
@@ -26,16 +42,18 @@ func (m MockStore) CreateCert(c cert.Certificate) (*cert.Certificate, error) {
 }
 
 // UpdateCert mock
-func (m MockStore) UpdateCert(id string, c cert.Certificate) (*cert.Certificate, error) {
+func (m MockStore) UpdateCert(ctx context.Context, userID, id string, p cert.Patch) (*cert.Certificate, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
 
+	c := p.Apply(m.Cert)
+
 	return &c, nil
 }
 
 // DeleteCert mock
-func (m MockStore) DeleteCert(id string) error {
+func (m MockStore) DeleteCert(ctx context.Context, userID, id string) error {
 	if m.Err != nil {
 		return m.Err
 	}
@@ -43,8 +61,17 @@ func (m MockStore) DeleteCert(id string) error {
 	return nil
 }
 
+// GetCert mock
+func (m MockStore) GetCert(ctx context.Context, id string) (*cert.Certificate, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.Cert, nil
+}
+
 // GetCerts mock
-func (m MockStore) GetCerts(ownerID string) ([]cert.Certificate, error) {
+func (m MockStore) GetCerts(ctx context.Context, ownerID string) ([]cert.Certificate, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
@@ -53,7 +80,7 @@ func (m MockStore) GetCerts(ownerID string) ([]cert.Certificate, error) {
 }
 
 // CreateTx mock
-func (m MockStore) CreateTx(certID string, tx cert.Transaction) (*cert.Transaction, error) {
+func (m MockStore) CreateTx(ctx context.Context, userID, certID string, tx cert.Transaction) (*cert.Transaction, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
@@ -62,7 +89,25 @@ func (m MockStore) CreateTx(certID string, tx cert.Transaction) (*cert.Transacti
 }
 
 // AcceptTx mock
-func (m MockStore) AcceptTx(certID string) (*cert.Certificate, error) {
+func (m MockStore) AcceptTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.Cert, nil
+}
+
+// RejectTx mock
+func (m MockStore) RejectTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.Cert, nil
+}
+
+// CancelTx mock
+func (m MockStore) CancelTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
@@ -70,11 +115,207 @@ func (m MockStore) AcceptTx(certID string) (*cert.Certificate, error) {
 	return &m.Cert, nil
 }
 
+// GetTxs mock
+func (m MockStore) GetTxs(ctx context.Context, certID string, offset, limit int) ([]cert.Transaction, int, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	return m.Txs, len(m.Txs), nil
+}
+
 // NewUser mock
-func (m MockStore) NewUser(email string, name string) (*users.User, error) {
+func (m MockStore) NewUser(ctx context.Context, email string, name string) (*users.User, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.User, nil
+}
+
+// IssueToken mock
+func (m MockStore) IssueToken(ctx context.Context, userID string) (string, error) {
+	if m.Err != nil {
+		return "", m.Err
+	}
+
+	return m.Token, nil
+}
+
+// Authenticate mock. It always succeeds so that requests reach the
+// handlers under test, whatever the value of Err.
+func (m MockStore) Authenticate(ctx context.Context, token string) (*users.User, error) {
+	return &m.User, nil
+}
+
+// GetLedger mock
+func (m MockStore) GetLedger(ctx context.Context, certID string) ([]ledger.Entry, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.Ledger, nil
+}
+
+// GetTreeHead mock
+func (m MockStore) GetTreeHead(ctx context.Context) (*transparency.TreeHead, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.TreeHead, nil
+}
+
+// GetInclusionProof mock
+func (m MockStore) GetInclusionProof(ctx context.Context, certID string, seq, treeSize int) (*transparency.InclusionProof, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.InclusionProof, nil
+}
+
+// GetConsistencyProof mock
+func (m MockStore) GetConsistencyProof(ctx context.Context, first, second int) (*transparency.ConsistencyProof, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.ConsistencyProof, nil
+}
+
+// ClaimInvitation mock
+func (m MockStore) ClaimInvitation(ctx context.Context, userID, token string) (*cert.Transaction, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.Tx, nil
+}
+
+// ExpireTxs mock
+func (m MockStore) ExpireTxs(ctx context.Context, now time.Time) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+
+	return 0, nil
+}
+
+// GetUser mock
+func (m MockStore) GetUser(ctx context.Context, idOrEmail string) (*users.User, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.User, nil
+}
+
+// ListUsers mock
+func (m MockStore) ListUsers(ctx context.Context, f users.Filter, offset, limit int) ([]users.User, int, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	return m.Users, len(m.Users), nil
+}
+
+// UpdateUser mock
+func (m MockStore) UpdateUser(ctx context.Context, userID string, p users.Patch) (*users.User, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	u := p.Apply(m.User)
+
+	return &u, nil
+}
+
+// RequestEmailChange mock
+func (m MockStore) RequestEmailChange(ctx context.Context, userID, email string) error {
+	return m.Err
+}
+
+// ConfirmEmailChange mock
+func (m MockStore) ConfirmEmailChange(ctx context.Context, userID, token string) (*users.User, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
 
 	return &m.User, nil
 }
+
+// AssignRole mock
+func (m MockStore) AssignRole(ctx context.Context, userID string, a users.RoleAssignment) (*users.User, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	u := m.User
+	u.Role = a.Role
+	u.Represents = a.Represents
+
+	return &u, nil
+}
+
+// DeleteUser mock
+func (m MockStore) DeleteUser(ctx context.Context, userID, reassignTo string) error {
+	return m.Err
+}
+
+// CreateOrganization mock
+func (m MockStore) CreateOrganization(ctx context.Context, userID, name string) (*organizations.Organization, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	o := m.Org
+	o.Name = name
+
+	return &o, nil
+}
+
+// GetOrganization mock. Only Org can be found, so that certificates owned
+// by users are not mistaken for certificates owned by an organization.
+func (m MockStore) GetOrganization(ctx context.Context, id string) (*organizations.Organization, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	if id == "" || id != m.Org.ID {
+		return nil, &store.Error{Kind: store.ErrNotFound, Msg: "organization not found"}
+	}
+
+	return &m.Org, nil
+}
+
+// ListOrganizations mock
+func (m MockStore) ListOrganizations(ctx context.Context, userID string) ([]organizations.Organization, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.Orgs, nil
+}
+
+// SetMember mock
+func (m MockStore) SetMember(ctx context.Context, userID, orgID string, member organizations.Member) (*organizations.Organization, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	o := m.Org
+	o.Members = append([]organizations.Member{}, o.Members...)
+	o.Members = append(o.Members, member)
+
+	return &o, nil
+}
+
+// RemoveMember mock
+func (m MockStore) RemoveMember(ctx context.Context, userID, orgID, memberID string) (*organizations.Organization, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return &m.Org, nil
+}
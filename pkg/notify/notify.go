@@ -0,0 +1,97 @@
+// Package notify delivers messages to users, for instance the tokens
+// they must present to verify a new email address.
+package notify
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Popcore/verisart/pkg/logging"
+)
+
+// Message is a message sent to an email address.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+
+	// Secrets lists the values found in Body, such as verification
+	// tokens, that must never be written to the log.
+	Secrets []string
+}
+
+// redacted replaces the secrets of the messages written to the log.
+const redacted = "<redacted>"
+
+// Notifier is the interface that delivers messages.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Log is a Notifier that writes messages to the application log instead
+// of delivering them. It is meant for development, where no mail server
+// is available. The secrets of messages are redacted, so the tokens they
+// carry cannot be read from the log.
+type Log struct{}
+
+// Notify writes msg, with its secrets redacted, to the log.
+func (Log) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	body := msg.Body
+	for _, secret := range msg.Secrets {
+		if secret != "" {
+			body = strings.Replace(body, secret, redacted, -1)
+		}
+	}
+
+	logging.Infof("Message to %s: %s\n%s", msg.To, msg.Subject, body)
+
+	return nil
+}
+
+// Memory is a Notifier that keeps the messages it is sent, so that tests
+// can read them. It is safe for concurrent use.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Notify records msg.
+func (m *Memory) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent message sent to the address to.
+func (m *Memory) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+
+	return Message{}, false
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := &Memory{}
+	ctx := context.Background()
+
+	_, ok := m.Last("joe@email.com")
+	assert.False(t, ok)
+
+	assert.Nil(t, m.Notify(ctx, Message{To: "joe@email.com", Subject: "first"}))
+	assert.Nil(t, m.Notify(ctx, Message{To: "ann@email.com", Subject: "second"}))
+	assert.Nil(t, m.Notify(ctx, Message{To: "joe@email.com", Subject: "third"}))
+
+	assert.Len(t, m.Messages(), 3)
+
+	last, ok := m.Last("joe@email.com")
+	assert.True(t, ok)
+	assert.Equal(t, "third", last.Subject)
+
+	// messages are not recorded once the context is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, m.Notify(cancelled, Message{To: "joe@email.com"}))
+	assert.Len(t, m.Messages(), 3)
+}
+
+func TestLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	assert.Nil(t, Log{}.Notify(context.Background(), Message{
+		To:      "joe@email.com",
+		Subject: "hello",
+		Body:    "your token is s3cr3t",
+		Secrets: []string{"s3cr3t"},
+	}))
+
+	assert.True(t, strings.Contains(buf.String(), "your token is <redacted>"), buf.String())
+	assert.False(t, strings.Contains(buf.String(), "s3cr3t"), buf.String())
+}
+
+func TestSMTPFormat(t *testing.T) {
+	n := NewSMTP("localhost:25", "noreply@verisart.com", "", "")
+	assert.Nil(t, n.Auth)
+
+	msg := n.format(Message{To: "joe@email.com", Subject: "hello", Body: "your token is s3cr3t"})
+	assert.Equal(t, "From: noreply@verisart.com\r\nTo: joe@email.com\r\nSubject: hello\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n\r\nyour token is s3cr3t\r\n", string(msg))
+
+	assert.NotNil(t, NewSMTP("localhost:25", "noreply@verisart.com", "joe", "pass").Auth)
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTP is a Notifier that delivers messages by email through a mail
+// server.
+type SMTP struct {
+	// Addr is the host and port of the mail server.
+	Addr string
+
+	// From is the address messages are sent from.
+	From string
+
+	// Auth authenticates with the mail server. No authentication is
+	// attempted when it is nil.
+	Auth smtp.Auth
+}
+
+// NewSMTP returns a Notifier delivering messages from the address from
+// through the mail server at addr. The server is authenticated with
+// the PLAIN mechanism when username is set.
+func NewSMTP(addr, from, username, password string) SMTP {
+	n := SMTP{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		n.Auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return n
+}
+
+// Notify sends msg to its recipient.
+func (s SMTP) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{msg.To}, s.format(msg))
+}
+
+// format returns msg as an email with its headers.
+func (s SMTP) format(msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	b.WriteString("\r\n")
+
+	return b.Bytes()
+}
@@ -0,0 +1,132 @@
+package organizations
+
+import (
+	"context"
+	"time"
+)
+
+// Organization is a group of users, such as the staff of a gallery,
+// that owns certificates. Its members manage its certificates according
+// to the permissions the organization granted them.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Members   []Member  `json:"members"`
+}
+
+// Member is a user belonging to an organization together with the
+// permissions they were granted.
+type Member struct {
+	UserID      string       `json:"userId"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Permission is an action members can take on behalf of their
+// organization.
+type Permission string
+
+const (
+	// View allows seeing the organization, its members and its
+	// certificates.
+	View Permission = "view"
+
+	// Edit allows issuing, updating and deleting the certificates of the
+	// organization.
+	Edit Permission = "edit"
+
+	// Transfer allows transferring the certificates of the organization
+	// and accepting or rejecting the transfers sent to it.
+	Transfer Permission = "transfer"
+
+	// Manage allows adding and removing members and changing their
+	// permissions.
+	Manage Permission = "manage"
+)
+
+// AllPermissions lists every permission. They are granted to the user
+// creating an organization.
+var AllPermissions = []Permission{View, Edit, Transfer, Manage}
+
+// Valid returns true if p is one of the defined permissions.
+func (p Permission) Valid() bool {
+	for _, defined := range AllPermissions {
+		if p == defined {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Can returns true if m was granted p.
+func (m Member) Can(p Permission) bool {
+	for _, granted := range m.Permissions {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Member returns the member of o identified by userID, if any.
+func (o Organization) Member(userID string) (Member, bool) {
+	for _, m := range o.Members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// Can returns true if the user identified by userID is a member of o who
+// was granted p.
+func (o Organization) Can(userID string, p Permission) bool {
+	m, ok := o.Member(userID)
+
+	return ok && m.Can(p)
+}
+
+// Managers returns the number of members of o allowed to manage it.
+func (o Organization) Managers() int {
+	n := 0
+	for _, m := range o.Members {
+		if m.Can(Manage) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Manager is the interface that defines the operations allowed on
+// organizations. Operations changing an organization are carried out on
+// behalf of the user identified by userID, who must be a member allowed
+// to manage it.
+type Manager interface {
+	// CreateOrganization adds a new organization named name. The user
+	// identified by userID becomes its first member, with every
+	// permission.
+	CreateOrganization(ctx context.Context, userID, name string) (*Organization, error)
+
+	// GetOrganization returns the organization identified by id.
+	GetOrganization(ctx context.Context, id string) (*Organization, error)
+
+	// ListOrganizations returns the organizations the user identified by
+	// userID is a member of, ordered by name.
+	ListOrganizations(ctx context.Context, userID string) ([]Organization, error)
+
+	// SetMember adds m to the organization identified by orgID, or
+	// replaces the permissions of m if they already are a member. It
+	// returns the updated organization. The last member allowed to
+	// manage an organization cannot lose the manage permission.
+	SetMember(ctx context.Context, userID, orgID string, m Member) (*Organization, error)
+
+	// RemoveMember removes the user identified by memberID from the
+	// organization identified by orgID. Members can always leave an
+	// organization, unless they are the last member allowed to manage
+	// it. It returns the updated organization.
+	RemoveMember(ctx context.Context, userID, orgID, memberID string) (*Organization, error)
+}
@@ -0,0 +1,37 @@
+package organizations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	o := Organization{
+		Members: []Member{
+			{UserID: "manager-id", Permissions: AllPermissions},
+			{UserID: "viewer-id", Permissions: []Permission{View}},
+		},
+	}
+
+	for _, p := range AllPermissions {
+		assert.True(t, o.Can("manager-id", p), p)
+		assert.False(t, o.Can("stranger-id", p), p)
+	}
+
+	assert.True(t, o.Can("viewer-id", View))
+	assert.False(t, o.Can("viewer-id", Edit))
+	assert.False(t, o.Can("viewer-id", Transfer))
+	assert.False(t, o.Can("viewer-id", Manage))
+
+	assert.Equal(t, 1, o.Managers())
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Organization{Name: "the gallery"}.Validate())
+	assert.EqualError(t, Organization{Name: " "}.Validate(), "name: is required")
+
+	assert.Nil(t, Member{Permissions: []Permission{View, Transfer}}.Validate())
+	assert.EqualError(t, Member{}.Validate(), "permissions: must contain at least one permission")
+	assert.EqualError(t, Member{Permissions: []Permission{"delete"}}.Validate(), "permissions: can only contain 'view', 'edit', 'transfer' or 'manage'")
+}
@@ -0,0 +1,31 @@
+package organizations
+
+import (
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+// MaxNameLength is the maximum length of an organization name.
+const MaxNameLength = 100
+
+// Validate checks that the organization name is valid.
+func (o Organization) Validate() error {
+	v := validation.Validator{}
+
+	v.Required("name", o.Name)
+	v.MaxLength("name", o.Name, MaxNameLength)
+
+	return v.Err()
+}
+
+// Validate checks that the member is granted at least one permission
+// and that every permission exists.
+func (m Member) Validate() error {
+	v := validation.Validator{}
+
+	v.Check(len(m.Permissions) > 0, "permissions", "must contain at least one permission")
+	for _, p := range m.Permissions {
+		v.Check(p.Valid(), "permissions", "can only contain 'view', 'edit', 'transfer' or 'manage'")
+	}
+
+	return v.Err()
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Popcore/verisart/pkg/clock"
+)
+
+// DefaultSweepInterval is how often the server looks for overdue
+// transfers, unless configured with WithSweepInterval.
+const DefaultSweepInterval = time.Minute
+
+// Option configures optional server behaviour.
+type Option func(*Server)
+
+// WithClock sets the clock used to decide which transfers are overdue and
+// to validate the years of certificates and the expiries of transfers.
+// It should be the clock of the store.
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithSweepInterval sets how often the server looks for overdue
+// transfers.
+func WithSweepInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.sweepInterval = d
+	}
+}
+
+// WithAllowedOrigins sets the origins allowed to send cross-origin
+// requests. "*" allows any origin, which is the default.
+func WithAllowedOrigins(origins []string) Option {
+	return func(s *Server) {
+		s.allowedOrigins = origins
+	}
+}
+
+// WithTLS makes the server serve https with the certificate and private
+// key found in the files at certFile and keyFile.
+func WithTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+	}
+}
+
+// WithTimeouts bounds the time spent reading requests and writing
+// responses. By default they are not bounded.
+func WithTimeouts(read, write time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = read
+		s.writeTimeout = write
+	}
+}
+
+// WithMaxPayloadBytes sets the maximum size of request payloads.
+func WithMaxPayloadBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxPayloadBytes = n
+	}
+}
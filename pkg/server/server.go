@@ -1,14 +1,21 @@
 package server
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/rs/cors"
 	"goji.io"
 	"goji.io/pat"
 
+	"github.com/Popcore/verisart/pkg/clock"
 	"github.com/Popcore/verisart/pkg/handlers"
+	"github.com/Popcore/verisart/pkg/logging"
+	"github.com/Popcore/verisart/pkg/signing"
 	store "github.com/Popcore/verisart/pkg/store"
 )
 
@@ -17,48 +24,213 @@ import (
 type Server struct {
 	Address string
 	Mux     *goji.Mux
+
+	clock         clock.Clock
+	sweepInterval time.Duration
+
+	allowedOrigins  []string
+	tlsCertFile     string
+	tlsKeyFile      string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	maxPayloadBytes int64
+	sweeper         *sweeper
+	httpServer      *http.Server
+
+	// mu guards listener and hooks.
+	mu       sync.Mutex
+	listener net.Listener
+	hooks    []Hook
+
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
+// Hook is a function run when the server shuts down. It should return
+// when ctx is done.
+type Hook func(ctx context.Context) error
+
 // New returns a server instance than can be used to handle
-// http requests.
-func New(addr string) *Server {
+// http requests. All handlers read and write data using the
+// supplied store, whose certificates are signed with key.
+// Overdue transfers in the store are expired in the background
+// while the server runs.
+func New(addr string, s store.Storer, key *signing.Key, opts ...Option) *Server {
 
-	memStore := store.NewMemStore()
 	mux := goji.NewMux()
-	mux.Handle(pat.Post("/certificates"), handlers.Handler{S: memStore, H: handlers.PostCertHandler})
-	mux.Handle(pat.Patch("/certificates/:id"), handlers.Handler{S: memStore, H: handlers.PatchCertHandler})
-	mux.Handle(pat.Delete("/certificates/:id"), handlers.Handler{S: memStore, H: handlers.DeleteCertHandler})
-	mux.Handle(pat.Post("/certificates/:id/transfers"), handlers.Handler{S: memStore, H: handlers.PostTransferHandler})
-	mux.Handle(pat.Patch("/certificates/:id/transfers"), handlers.Handler{S: memStore, H: handlers.PatchTransferHandler})
-	mux.Handle(pat.Get("/users/:userId/certificates"), handlers.Handler{S: memStore, H: handlers.ListUserCertsHandler})
-	mux.Handle(pat.Post("/users"), handlers.Handler{S: memStore, H: handlers.NewUserHandler})
+	mux.Handle(pat.Post("/certificates"), handlers.Handler{S: s, H: handlers.PostCertHandler})
+	mux.Handle(pat.Get("/certificates/:id"), handlers.Handler{S: s, H: handlers.GetCertHandler})
+	mux.Handle(pat.Patch("/certificates/:id"), handlers.Handler{S: s, H: handlers.PatchCertHandler})
+	mux.Handle(pat.Delete("/certificates/:id"), handlers.Handler{S: s, H: handlers.DeleteCertHandler})
+	mux.Handle(pat.Post("/certificates/:id/transfers"), handlers.Handler{S: s, H: handlers.PostTransferHandler})
+	mux.Handle(pat.Patch("/certificates/:id/transfers"), handlers.Handler{S: s, H: handlers.PatchTransferHandler})
+	mux.Handle(pat.Get("/certificates/:id/transfers"), handlers.Handler{S: s, H: handlers.ListTransfersHandler})
+	mux.Handle(pat.Get("/certificates/:id/ledger"), handlers.Handler{S: s, H: handlers.GetLedgerHandler})
+	mux.Handle(pat.Post("/invitations/claim"), handlers.Handler{S: s, H: handlers.ClaimInvitationHandler})
+	mux.Handle(pat.Get("/certificates/:id/inclusion-proof"), handlers.Handler{S: s, H: handlers.InclusionProofHandler})
+	mux.Handle(pat.Get("/log/tree-head"), handlers.Handler{S: s, H: handlers.GetTreeHeadHandler})
+	mux.Handle(pat.Get("/log/consistency-proof"), handlers.Handler{S: s, H: handlers.ConsistencyProofHandler})
+	mux.Handle(pat.Get("/users/:userId/certificates"), handlers.Handler{S: s, H: handlers.ListUserCertsHandler})
+	mux.Handle(pat.Post("/users"), handlers.Handler{S: s, H: handlers.NewUserHandler})
+	mux.Handle(pat.Get("/users"), handlers.Handler{S: s, H: handlers.ListUsersHandler})
+	mux.Handle(pat.Get("/users/:userId"), handlers.Handler{S: s, H: handlers.GetUserHandler})
+	mux.Handle(pat.Patch("/users/:userId"), handlers.Handler{S: s, H: handlers.UpdateUserHandler})
+	mux.Handle(pat.Delete("/users/:userId"), handlers.Handler{S: s, H: handlers.DeleteUserHandler})
+	mux.Handle(pat.Put("/users/:userId/role"), handlers.Handler{S: s, H: handlers.AssignRoleHandler})
+	mux.Handle(pat.Post("/users/:userId/email"), handlers.Handler{S: s, H: handlers.RequestEmailChangeHandler})
+	mux.Handle(pat.Post("/users/:userId/email/confirm"), handlers.Handler{S: s, H: handlers.ConfirmEmailChangeHandler})
+	mux.Handle(pat.Post("/organizations"), handlers.Handler{S: s, H: handlers.PostOrgHandler})
+	mux.Handle(pat.Get("/organizations"), handlers.Handler{S: s, H: handlers.ListOrgsHandler})
+	mux.Handle(pat.Get("/organizations/:orgId"), handlers.Handler{S: s, H: handlers.GetOrgHandler})
+	mux.Handle(pat.Get("/organizations/:orgId/certificates"), handlers.Handler{S: s, H: handlers.ListOrgCertsHandler})
+	mux.Handle(pat.Put("/organizations/:orgId/members/:userId"), handlers.Handler{S: s, H: handlers.SetMemberHandler})
+	mux.Handle(pat.Delete("/organizations/:orgId/members/:userId"), handlers.Handler{S: s, H: handlers.RemoveMemberHandler})
+	mux.Handle(pat.Get("/signing-key"), handlers.Handler{S: s, H: handlers.PublicKeyHandler(key)})
+	mux.Handle(pat.Post("/verify"), handlers.Handler{S: s, H: handlers.VerifyCertHandler(key)})
+	mux.Handle(pat.Get("/certificates/:id/verify"), handlers.Handler{S: s, H: handlers.VerifyStoredCertHandler(key)})
+
+	srv := &Server{
+		Address:        addr,
+		Mux:            mux,
+		clock:          clock.Real{},
+		sweepInterval:  DefaultSweepInterval,
+		allowedOrigins: []string{"*"},
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+
 	// define cors policies
 	c := cors.New(
 		cors.Options{
-			AllowedOrigins: []string{"*"},
-			AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE"},
-			AllowedHeaders: []string{"Authorization", "Content-Type", "X-User-Email"},
+			AllowedOrigins: srv.allowedOrigins,
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type"},
 		},
 	)
 	mux.Use(c.Handler)
+	mux.Use(handlers.Authenticate(s))
+	mux.Use(handlers.UseClock(srv.clock))
+	if srv.maxPayloadBytes > 0 {
+		mux.Use(handlers.LimitPayload(srv.maxPayloadBytes))
+	}
 
-	return &Server{
-		Address: addr,
-		Mux:     mux,
+	srv.sweeper = newSweeper(s, srv.clock, srv.sweepInterval)
+	srv.httpServer = &http.Server{
+		Addr:         srv.Address,
+		Handler:      srv.Mux,
+		ReadTimeout:  srv.readTimeout,
+		WriteTimeout: srv.writeTimeout,
 	}
+
+	return srv
 }
 
-// Start generates and runs and http.Server at the defined address.
-func (s *Server) Start() {
-	servMux := &http.Server{
-		Addr:    s.Address,
-		Handler: s.Mux,
+// Listen binds the server to its address, so that Addr returns the
+// address it accepts connections on. Calling Listen is only needed to
+// know the address before Start, for instance when listening on an
+// ephemeral port.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return nil
+	}
+
+	l, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %s", s.Address, err.Error())
+	}
+	s.listener = l
+
+	return nil
+}
+
+// Addr returns the address the server accepts connections on once it
+// is listening, or the configured address otherwise.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return s.Address
 	}
 
-	log.Printf("Server running at %s", s.Address)
+	return s.listener.Addr().String()
+}
 
-	err := servMux.ListenAndServe()
+// Start starts expiring overdue transfers and serves http requests on
+// the server address until the server is shut down. It returns nil once
+// Shutdown is called, or the error that stopped the server.
+func (s *Server) Start() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	s.sweeper.Start()
+
+	var err error
+	if s.tlsCertFile != "" || s.tlsKeyFile != "" {
+		logging.Infof("Server running at https://%s", s.Addr())
+		err = s.httpServer.ServeTLS(s.listener, s.tlsCertFile, s.tlsKeyFile)
+	} else {
+		logging.Infof("Server running at http://%s", s.Addr())
+		err = s.httpServer.Serve(s.listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("unexpected error running http server: %s", err.Error())
+	}
+
+	return nil
+}
+
+// OnShutdown registers a hook run when the server shuts down, after it
+// stopped serving requests and its background workers stopped. Hooks
+// run in the order they were registered, so that for instance a store
+// can be closed after the hooks of the services using it.
+func (s *Server) OnShutdown(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, h)
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting
+// connections and waits for active requests to complete, stops
+// expiring overdue transfers and then runs the shutdown hooks. All
+// hooks run even if some of them fail, but waiting for requests stops
+// when ctx is done. Shutdown returns the first error encountered, and
+// the same error when called again.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
 	if err != nil {
-		log.Fatalf("Unexpected error starting http server: %s", err.Error())
+		err = fmt.Errorf("could not stop http server: %s", err.Error())
+	}
+
+	s.sweeper.Stop()
+
+	s.mu.Lock()
+	hooks := s.hooks
+	// the listener is only closed by the http server once it serves it
+	if s.listener != nil {
+		s.listener.Close()
 	}
+	s.mu.Unlock()
+
+	for _, h := range hooks {
+		if hookErr := h(ctx); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+
+	return err
 }
@@ -1,14 +1,138 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/Popcore/verisart/pkg/signing"
+	"github.com/Popcore/verisart/pkg/store"
 )
 
+// ctx is the context of the store operations of the tests.
+var ctx = context.Background()
+
+func newTestServer(t *testing.T) *Server {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	return New("127.0.0.1:0", store.NewMemStore(store.WithSigner(key)), key)
+}
+
 func TestNewServer(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
 	port := ":1234"
-	s := New(port)
+	s := New(port, store.NewMemStore(store.WithSigner(key)), key)
 
 	assert.Equal(t, s.Address, port)
+	assert.Equal(t, port, s.Addr())
+}
+
+func TestServerStartAndShutdown(t *testing.T) {
+	s := newTestServer(t)
+	assert.Nil(t, s.Listen())
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Start()
+	}()
+
+	resp, err := http.Get("http://" + s.Addr() + "/signing-key")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	order := []string{}
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "first")
+		return errors.New("some error")
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// all hooks run, in order, even if some fail
+	err = s.Shutdown(ctx)
+	assert.EqualError(t, err, "some error")
+	assert.Equal(t, []string{"first", "second"}, order)
+
+	select {
+	case err := <-errs:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the server did not stop")
+	}
+
+	// hooks run only once
+	assert.EqualError(t, s.Shutdown(ctx), "some error")
+	assert.Equal(t, []string{"first", "second"}, order)
+
+	_, err = http.Get("http://" + s.Addr() + "/signing-key")
+	assert.NotNil(t, err)
+}
+
+func TestServerStartError(t *testing.T) {
+	s := newTestServer(t)
+	assert.Nil(t, s.Listen())
+	defer s.Shutdown(context.Background())
+
+	// the address is already in use
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+	other := New(s.Addr(), store.NewMemStore(), key)
+
+	assert.NotNil(t, other.Start())
+}
+
+func TestServerShutdownBeforeStart(t *testing.T) {
+	s := newTestServer(t)
+	assert.Nil(t, s.Listen())
+	assert.Nil(t, s.Shutdown(context.Background()))
+
+	// a server that was shut down does not serve requests
+	assert.Nil(t, s.Start())
+}
+
+func TestServerOptions(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s := New(":1234", store.NewMemStore(), key,
+		WithAllowedOrigins([]string{"https://gallery.example.com"}),
+		WithMaxPayloadBytes(16),
+		WithTimeouts(time.Second, 2*time.Second),
+	)
+	assert.Equal(t, time.Second, s.httpServer.ReadTimeout)
+	assert.Equal(t, 2*time.Second, s.httpServer.WriteTimeout)
+
+	for origin, allowed := range map[string]string{
+		"https://gallery.example.com": "https://gallery.example.com",
+		"https://other.example.com":   "",
+	} {
+		req := httptest.NewRequest("GET", "/signing-key", nil)
+		req.Header.Set("Origin", origin)
+		recorder := httptest.NewRecorder()
+
+		s.Mux.ServeHTTP(recorder, req)
+		assert.Equal(t, allowed, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"email": "user@email.com", "name": "joe blog"}`))
+	recorder := httptest.NewRecorder()
+
+	s.Mux.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
 }
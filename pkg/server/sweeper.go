@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/logging"
+)
+
+// sweeper periodically marks overdue transfers as expired.
+type sweeper struct {
+	txs      cert.Transferer
+	clock    clock.Clock
+	interval time.Duration
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	started   bool
+	stop      chan struct{}
+	done      chan struct{}
+
+	// ctx is cancelled when the sweeper stops, so that a sweep in
+	// progress is aborted.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newSweeper(txs cert.Transferer, c clock.Clock, interval time.Duration) *sweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &sweeper{
+		txs:      txs,
+		clock:    c,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start runs the sweeper in a new goroutine. Calling Start more than
+// once has no effect.
+func (sw *sweeper) Start() {
+	sw.startOnce.Do(func() {
+		sw.started = true
+		go sw.run()
+	})
+}
+
+// Stop stops the sweeper, aborting the current sweep if any, and waits
+// for it to return. It is safe to call Stop more than once, or before Start.
+func (sw *sweeper) Stop() {
+	// prevent the sweeper from starting after being stopped. This also
+	// guarantees started is set if Start was called.
+	sw.startOnce.Do(func() {})
+	sw.stopOnce.Do(func() {
+		sw.cancel()
+		close(sw.stop)
+	})
+
+	if sw.started {
+		<-sw.done
+	}
+}
+
+func (sw *sweeper) run() {
+	defer close(sw.done)
+
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sw.stop:
+			return
+		case <-ticker.C:
+			sw.sweep()
+		}
+	}
+}
+
+// sweep expires the transfers that are overdue at the current time.
+func (sw *sweeper) sweep() {
+	n, err := sw.txs.ExpireTxs(sw.ctx, sw.clock.Now())
+	if err != nil && sw.ctx.Err() == nil {
+		logging.Errorf("Unable to expire transfers: %s", err.Error())
+	}
+	if n > 0 {
+		logging.Infof("Expired %d overdue transfers", n)
+	}
+}
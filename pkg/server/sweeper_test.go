@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/signing"
+	"github.com/Popcore/verisart/pkg/store"
+)
+
+func TestSweeperExpiresOverdueTransfers(t *testing.T) {
+	s := store.NewMemStore()
+	owner, err := s.NewUser(ctx, "owner1@email.com", "joe blog")
+	assert.Nil(t, err)
+	_, err = s.NewUser(ctx, "collector@email.com", "joe blog")
+	assert.Nil(t, err)
+	c, err := s.CreateCert(ctx, owner.ID, cert.Certificate{Title: "the-title", OwnerID: owner.ID, Year: 2018})
+	assert.Nil(t, err)
+	tx, err := s.CreateTx(ctx, owner.ID, c.ID, cert.Transaction{To: "collector@email.com"})
+	assert.Nil(t, err)
+
+	fake := clock.NewFake(tx.CreatedAt)
+	sw := newSweeper(s, fake, time.Millisecond)
+	sw.Start()
+	defer sw.Stop()
+
+	status := func() cert.TransferStatus {
+		txs, _, err := s.GetTxs(ctx, c.ID, 0, 1)
+		assert.Nil(t, err)
+		return txs[0].Status
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, cert.Pending, status())
+
+	fake.Set(tx.ExpiresAt.Add(time.Second))
+	deadline := time.Now().Add(time.Second)
+	for status() != cert.Expired && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, cert.Expired, status())
+}
+
+func TestSweeperStop(t *testing.T) {
+	// stopping a sweeper that never started returns immediately
+	sw := newSweeper(store.NewMemStore(), clock.Real{}, time.Millisecond)
+	sw.Stop()
+	sw.Start()
+	sw.Stop()
+
+	sw = newSweeper(store.NewMemStore(), clock.Real{}, time.Millisecond)
+	sw.Start()
+	sw.Start()
+	sw.Stop()
+	sw.Stop()
+
+	select {
+	case <-sw.done:
+	default:
+		t.Fatal("the sweeper is still running")
+	}
+}
+
+func TestServerShutdownStopsSweeper(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s := New("127.0.0.1:0", store.NewMemStore(), key, WithSweepInterval(time.Millisecond), WithClock(clock.NewFake(time.Now())))
+	assert.Equal(t, time.Millisecond, s.sweepInterval)
+
+	s.sweeper.Start()
+	ran := false
+	s.OnShutdown(func(ctx context.Context) error {
+		// the sweeper stops before shutdown hooks run
+		select {
+		case <-s.sweeper.done:
+			ran = true
+		default:
+		}
+		return nil
+	})
+	assert.Nil(t, s.Shutdown(context.Background()))
+	assert.True(t, ran)
+
+	select {
+	case <-s.sweeper.done:
+	default:
+		t.Fatal("the sweeper is still running")
+	}
+}
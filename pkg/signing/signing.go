@@ -0,0 +1,155 @@
+// Package signing implements the Ed25519 keys used by the service to sign
+// certificates.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+)
+
+// Algorithm is the name of the signature algorithm used by Key.
+const Algorithm = "Ed25519"
+
+// pemType is the type of the PEM blocks holding private keys.
+const pemType = "PRIVATE KEY"
+
+// Key is an Ed25519 key pair used to sign certificates. It implements
+// the cert.Signer interface.
+type Key struct {
+	id   string
+	priv ed25519.PrivateKey
+}
+
+// NewKey returns a Key wrapping an Ed25519 private key.
+func NewKey(priv ed25519.PrivateKey) *Key {
+	pub := priv.Public().(ed25519.PublicKey)
+
+	return &Key{
+		id:   keyID(pub),
+		priv: priv,
+	}
+}
+
+// GenerateKey returns a new random Key.
+func GenerateKey() (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(priv), nil
+}
+
+// LoadOrCreateKey reads the PEM encoded PKCS #8 private key stored at
+// path. If the file does not exist a new key is generated and saved there.
+func LoadOrCreateKey(path string) (*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		k, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.save(path); err != nil {
+			return nil, err
+		}
+
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read key file: %s", err.Error())
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("key file %s does not contain a PEM encoded private key", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key file %s: %s", path, err.Error())
+	}
+
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key file %s does not contain an Ed25519 key", path)
+	}
+
+	return NewKey(priv), nil
+}
+
+// save writes the private key to path, readable by its owner only.
+func (k *Key) save(path string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(k.priv)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("could not save key file: %s", err.Error())
+	}
+
+	return nil
+}
+
+// ID returns the identifier of the key: the first 16 hex encoded bytes
+// of the SHA-256 hash of its public key.
+func (k *Key) ID() string {
+	return k.id
+}
+
+// PublicKey returns the public key used to verify signatures.
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.priv.Public().(ed25519.PublicKey)
+}
+
+// Sign returns the signature of payload.
+func (k *Key) Sign(payload []byte) (cert.Signature, error) {
+	return cert.Signature{
+		KeyID:     k.id,
+		Algorithm: Algorithm,
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(k.priv, payload)),
+	}, nil
+}
+
+// Verify checks that sig is a valid signature of payload made with the
+// private key matching pub.
+func Verify(pub ed25519.PublicKey, payload []byte, sig cert.Signature) error {
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+
+	if sig.KeyID != keyID(pub) {
+		return fmt.Errorf("the signature was made with unknown key %q", sig.KeyID)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return errors.New("the signature is not base64 encoded")
+	}
+
+	if !ed25519.Verify(pub, payload, value) {
+		return errors.New("the signature does not match the payload")
+	}
+
+	return nil
+}
+
+// keyID returns the identifier of a public key.
+func keyID(pub ed25519.PublicKey) string {
+	h := sha256.Sum256(pub)
+
+	return hex.EncodeToString(h[:16])
+}
@@ -0,0 +1,70 @@
+package signing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	k, err := GenerateKey()
+	assert.Nil(t, err)
+
+	payload := []byte(`{"id":"the-id"}`)
+
+	sig, err := k.Sign(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, k.ID(), sig.KeyID)
+	assert.Equal(t, Algorithm, sig.Algorithm)
+
+	assert.Nil(t, Verify(k.PublicKey(), payload, sig))
+	assert.NotNil(t, Verify(k.PublicKey(), []byte(`{"id":"another-id"}`), sig))
+
+	other, err := GenerateKey()
+	assert.Nil(t, err)
+	assert.NotNil(t, Verify(other.PublicKey(), payload, sig))
+
+	tampered := sig
+	tampered.Value = "not base64!"
+	assert.NotNil(t, Verify(k.PublicKey(), payload, tampered))
+
+	tampered = sig
+	tampered.Algorithm = "RS256"
+	assert.NotNil(t, Verify(k.PublicKey(), payload, tampered))
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verisart")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key.pem")
+
+	created, err := LoadOrCreateKey(path)
+	assert.Nil(t, err)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the same key is loaded once the file exists
+	loaded, err := LoadOrCreateKey(path)
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID(), loaded.ID())
+	assert.Equal(t, created.PublicKey(), loaded.PublicKey())
+
+	err = ioutil.WriteFile(path, []byte("not-a-key"), 0600)
+	assert.Nil(t, err)
+
+	_, err = LoadOrCreateKey(path)
+	assert.NotNil(t, err)
+}
+
+func TestKeyImplementsSigner(t *testing.T) {
+	var _ cert.Signer = &Key{}
+}
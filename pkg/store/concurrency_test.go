@@ -0,0 +1,244 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// The tests below are meant to be run with the race detector enabled
+// (go test -race) as well as on their own.
+
+const (
+	stressUsers    = 4
+	stressCerts    = 8
+	stressWorkers  = 16
+	stressAttempts = 50
+)
+
+// seedStressStore creates the users and certificates used by the
+// stress tests and returns the users and the certificate ids.
+func seedStressStore(t *testing.T, s Storer) ([]users.User, []string) {
+	us := []users.User{}
+	for i := 0; i < stressUsers; i++ {
+		u, err := s.NewUser(ctx, fmt.Sprintf("user%d@email.com", i), "stress user")
+		assert.Nil(t, err)
+		us = append(us, *u)
+	}
+
+	ids := []string{}
+	for i := 0; i < stressCerts; i++ {
+		c, err := s.CreateCert(ctx, us[i%stressUsers].ID, cert.Certificate{
+			Title:   fmt.Sprintf("cert%d", i),
+			OwnerID: us[i%stressUsers].ID,
+			Year:    2018,
+		})
+		assert.Nil(t, err)
+		ids = append(ids, c.ID)
+	}
+
+	return us, ids
+}
+
+// hammer runs the same mix of transfers, acceptances and updates from
+// many goroutines at once.
+func hammer(s Storer, us []users.User, ids []string) {
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < stressAttempts; i++ {
+				id := ids[(w+i)%len(ids)]
+				from := us[w%stressUsers]
+				to := us[(w+i)%stressUsers]
+
+				// operations attempted by users other than the owner or
+				// the recipient fail, but still compete for the locks
+				s.CreateTx(ctx, from.ID, id, cert.Transaction{To: to.Email})
+				title := fmt.Sprintf("title-%d-%d", w, i)
+				s.UpdateCert(ctx, from.ID, id, cert.Patch{Title: &title})
+				switch i % 3 {
+				case 0:
+					s.RejectTx(ctx, to.ID, id)
+				case 1:
+					s.CancelTx(ctx, from.ID, id)
+				default:
+					s.AcceptTx(ctx, to.ID, id)
+				}
+				s.GetCerts(ctx, to.ID)
+			}
+		}(w)
+	}
+
+	wg.Wait()
+}
+
+// assertConsistent checks that the transactions of every certificate
+// agree with its ownership and transfer status.
+func assertConsistent(t *testing.T, m *memStore, ids []string) {
+	for _, id := range ids {
+		c := m.Certs[id]
+		txs := m.Txs[id]
+
+		for i, tx := range txs {
+			// only the most recent transaction can be pending
+			if i > 0 {
+				assert.NotEqual(t, cert.Pending, tx.Status)
+			}
+		}
+
+		if len(txs) > 0 {
+			assert.Equal(t, txs[0], *c.Transfer)
+
+			if txs[0].Status == cert.Accepted {
+				assert.Equal(t, txs[0].RecipientID, c.OwnerID)
+			}
+		}
+	}
+}
+
+func TestMemStoreConcurrentTransfers(t *testing.T) {
+	s := NewMemStore()
+	us, ids := seedStressStore(t, s)
+
+	hammer(s, us, ids)
+
+	assertConsistent(t, s.(*memStore), ids)
+}
+
+func TestFileStoreConcurrentTransfers(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+	us, ids := seedStressStore(t, s)
+
+	hammer(s, us, ids)
+
+	assertConsistent(t, s.(*fileStore).memStore, ids)
+
+	// the data file must hold the final state of the store
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+	assertConsistent(t, reloaded.(*fileStore).memStore, ids)
+	assert.Equal(t, s.(*fileStore).Certs, reloaded.(*fileStore).Certs)
+}
+
+func TestConcurrentCreateTxSingleWinner(t *testing.T) {
+	s := NewMemStore()
+	us, ids := seedStressStore(t, s)
+
+	wg := sync.WaitGroup{}
+	results := make(chan error, stressWorkers)
+
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			_, err := s.CreateTx(ctx, us[0].ID, ids[0], cert.Transaction{
+				To: us[w%stressUsers].Email,
+			})
+			results <- err
+		}(w)
+	}
+
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		}
+	}
+
+	// only one of the concurrent transfers can become the pending one
+	assert.Equal(t, 1, succeeded)
+	assert.Len(t, s.(*memStore).Txs[ids[0]], 1)
+}
+
+func TestConcurrentDeleteKeepsAnAdmin(t *testing.T) {
+	for i := 0; i < stressAttempts; i++ {
+		s := NewMemStore()
+		admins := []users.User{}
+		for a := 0; a < 2; a++ {
+			u := newTestUser(t, s, fmt.Sprintf("admin%d@email.com", a))
+			admins = append(admins, assignRole(t, s, u, users.Admin))
+		}
+
+		// admins deleting their accounts at the same time cannot leave
+		// the store without an admin
+		wg := sync.WaitGroup{}
+		for _, admin := range admins {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+
+				s.DeleteUser(ctx, id, "")
+			}(admin.ID)
+		}
+		wg.Wait()
+
+		left, _, err := s.ListUsers(ctx, users.Filter{}, 0, stressUsers)
+		assert.Nil(t, err)
+		if assert.Len(t, left, 1) {
+			assert.Equal(t, users.Admin, left[0].Role)
+		}
+	}
+}
+
+func TestConcurrentDeleteReassignsNewCerts(t *testing.T) {
+	for i := 0; i < stressAttempts; i++ {
+		s := NewMemStore()
+		leaving := newTestUser(t, s, "leaving@email.com")
+		heir := newTestUser(t, s, "heir@email.com")
+
+		// certificates issued while their owner is deleted are either
+		// refused or reassigned, never left to a deleted user
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			s.CreateCert(ctx, leaving.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: leaving.ID})
+		}()
+		go func() {
+			defer wg.Done()
+
+			assert.Nil(t, s.DeleteUser(ctx, leaving.ID, heir.ID))
+		}()
+		wg.Wait()
+
+		certs, err := s.GetCerts(ctx, leaving.ID)
+		assert.Nil(t, err)
+		assert.Len(t, certs, 0)
+	}
+}
+
+func TestKeyedMutexIsReleased(t *testing.T) {
+	k := keyedMutex{}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			unlock := k.Lock(fmt.Sprintf("key%d", i%2))
+			unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, k.locks, 0)
+}
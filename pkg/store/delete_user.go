@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+)
+
+// DeleteUser removes the user identified by userID. Users who own
+// certificates or are the recipient of pending transfers are deleted
+// only when reassignTo identifies another user, who is given their
+// certificates. The last admin cannot be deleted, and neither can the last
+// member allowed to manage an organization. Deleted users leave the
+// organizations they were a member of.
+//
+// The account is removed once every certificate is reassigned, so that
+// no certificate is left to a user who no longer exists: if reassigning a
+// certificate fails the user is not deleted, although the certificates
+// reassigned so far keep their new owner.
+func (m *memStore) DeleteUser(ctx context.Context, userID, reassignTo string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if reassignTo != "" && reassignTo == userID {
+		return newError(ErrValidation, "certificates cannot be reassigned to the user being deleted")
+	}
+
+	for {
+		certIDs, unlock := m.lockUserCerts(userID)
+
+		// the ledger records the role the user had when their certificates
+		// are reassigned
+		actor := m.actor(userID)
+
+		err := m.checkRemoval(userID, reassignTo)
+		for i := 0; err == nil && i < len(certIDs); i++ {
+			err = m.reassignCert(certIDs[i], userID, reassignTo, actor)
+		}
+
+		removed := false
+		if err == nil {
+			removed, err = m.removeAccount(userID, reassignTo)
+		}
+
+		unlock()
+
+		if err != nil || removed {
+			return err
+		}
+		// the user was given certificates or transfers while theirs were
+		// reassigned
+	}
+}
+
+// canRemove checks that the user identified by userID can be deleted,
+// giving their certificates to reassignTo. It must be called with the
+// lock of the store and of the users held.
+func (m *memStore) canRemove(userID, reassignTo string) error {
+	if _, ok := m.Users[userID]; !ok {
+		return newError(ErrNotFound, "user not found")
+	}
+
+	if m.isLastAdmin(userID) {
+		return newError(ErrConflict, "the last admin cannot be deleted")
+	}
+
+	if m.isLastManager(userID) {
+		return newError(ErrConflict, "the last member allowed to manage an organization cannot be deleted")
+	}
+
+	if _, ok := m.Users[reassignTo]; reassignTo != "" && !ok {
+		return newError(ErrValidation, "certificates can only be reassigned to an existing user")
+	}
+
+	if reassignTo == "" && len(m.userCertIDs(userID)) > 0 {
+		return newError(ErrConflict, "the user owns certificates or has pending transfers. Set a user to reassign them to")
+	}
+
+	return nil
+}
+
+// checkRemoval returns canRemove, taking the locks, so that certificates
+// are only reassigned when the user can be deleted.
+func (m *memStore) checkRemoval(userID, reassignTo string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.userStore.mu.RLock()
+	defer m.userStore.mu.RUnlock()
+
+	return m.canRemove(userID, reassignTo)
+}
+
+// removeAccount removes the user identified by userID, whose certificates
+// were given to reassignTo, together with its API tokens, its pending
+// email changes and its memberships. The checks of canRemove run again
+// under the same locks as the removal, so that no role or membership
+// changes in between. It returns false, without changing the store, if
+// the user was given certificates or transfers since theirs were
+// reassigned.
+func (m *memStore) removeAccount(userID, reassignTo string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.userStore.mu.Lock()
+	defer m.userStore.mu.Unlock()
+
+	if err := m.canRemove(userID, reassignTo); err != nil {
+		return false, err
+	}
+
+	if len(m.userCertIDs(userID)) > 0 {
+		return false, nil
+	}
+
+	m.removeUser(userID)
+	m.dropEmailChanges(userID)
+	m.dropMemberships(userID)
+
+	return true, nil
+}
+
+// userCertIDs returns the sorted IDs of the certificates owned by the
+// user identified by userID, or pending a transfer to them. It must be
+// called with the lock held.
+func (m *memStore) userCertIDs(userID string) []string {
+	ids := []string{}
+	for id, c := range m.Certs {
+		txs := m.Txs[id]
+		if c.OwnerID == userID || (len(txs) > 0 && txs[0].Status == cert.Pending && txs[0].RecipientID == userID) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// lockedUserCertIDs returns userCertIDs, taking the lock.
+func (m *memStore) lockedUserCertIDs(userID string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.userCertIDs(userID)
+}
+
+// lockUserCerts acquires the locks of the certificates returned by
+// userCertIDs. It returns the IDs of the locked certificates and the
+// function that releases the locks. Locks are acquired again if the
+// certificates of the user change while they are acquired.
+func (m *memStore) lockUserCerts(userID string) ([]string, func()) {
+	for {
+		ids := m.lockedUserCertIDs(userID)
+
+		unlocks := make([]func(), 0, len(ids))
+		unlock := func() {
+			for _, u := range unlocks {
+				u()
+			}
+		}
+		locked := map[string]bool{}
+		for _, id := range ids {
+			unlocks = append(unlocks, m.certLocks.Lock(id))
+			locked[id] = true
+		}
+
+		current := m.lockedUserCertIDs(userID)
+		stable := true
+		for _, id := range current {
+			stable = stable && locked[id]
+		}
+		if stable {
+			return current, unlock
+		}
+
+		unlock()
+	}
+}
+
+// reassignCert resolves the pending transfer of a certificate involving
+// the user identified by userID and, if the user owns the certificate,
+// gives it to the user identified by to. Transfers sent by the user are
+// cancelled while transfers sent to them are rejected. The changes are
+// recorded in the ledger on behalf of actor, the deleted user.
+// It must be called with the certificate lock held.
+func (m *memStore) reassignCert(id, userID, to string, actor ledger.Actor) error {
+	c, txs, ok := m.getCert(id)
+	if !ok {
+		return nil
+	}
+
+	now := m.now()
+
+	if len(txs) > 0 && txs[0].Status == cert.Pending {
+		var err error
+		switch tx := txs[0]; {
+		case txExpired(tx, now):
+			c, txs, err = m.expireTx(c, txs)
+		case c.OwnerID == userID:
+			tx.Status = cert.Cancelled
+			tx.ResolvedAt = &now
+			err = m.saveLastTx(&c, txs, tx, ledger.TransferCancelled, actor, now)
+		case tx.RecipientID == userID:
+			tx.Status = cert.Rejected
+			tx.ResolvedAt = &now
+			err = m.saveLastTx(&c, txs, tx, ledger.TransferRejected, actor, now)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.OwnerID != userID {
+		return nil
+	}
+
+	c.OwnerID = to
+	if err := m.sign(&c); err != nil {
+		return err
+	}
+
+	chain, err := ledger.Append(m.getLedger(id), id, ledger.Reassigned, actor, now, c)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Certs[id] = c
+	m.appendLedger(id, chain)
+
+	return nil
+}
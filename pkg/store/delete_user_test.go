@@ -0,0 +1,177 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/signing"
+)
+
+func TestDeleteUserWithoutCertificates(t *testing.T) {
+	s := NewMemStore()
+	leaving := newTestUser(t, s, "leaving@email.com")
+	token, err := s.IssueToken(ctx, leaving.ID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.DeleteUser(ctx, leaving.ID, ""))
+
+	_, err = s.GetUser(ctx, "leaving@email.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// the tokens of deleted users are revoked
+	_, err = s.Authenticate(ctx, token)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Empty(t, s.(*memStore).Tokens)
+
+	// the email address of deleted users can be used again
+	_, err = s.NewUser(ctx, "leaving@email.com", "joe blog")
+	assert.Nil(t, err)
+
+	err = s.DeleteUser(ctx, leaving.ID, "")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestDeleteUserReassignsCertificates(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s := NewMemStore(WithSigner(key))
+	leaving := newTestUser(t, s, "leaving@email.com")
+	heir := newTestUser(t, s, "heir@email.com")
+	collector := newTestUser(t, s, "collector@email.com")
+
+	owned, err := s.CreateCert(ctx, leaving.ID, cert.Certificate{Title: "owned", OwnerID: leaving.ID, Year: 2018})
+	assert.Nil(t, err)
+	sent, err := s.CreateCert(ctx, leaving.ID, cert.Certificate{Title: "sent", OwnerID: leaving.ID, Year: 2018})
+	assert.Nil(t, err)
+	_, err = s.CreateTx(ctx, leaving.ID, sent.ID, cert.Transaction{To: "collector@email.com"})
+	assert.Nil(t, err)
+	incoming, err := s.CreateCert(ctx, collector.ID, cert.Certificate{Title: "incoming", OwnerID: collector.ID, Year: 2018})
+	assert.Nil(t, err)
+	_, err = s.CreateTx(ctx, collector.ID, incoming.ID, cert.Transaction{To: "leaving@email.com"})
+	assert.Nil(t, err)
+
+	// users with certificates or pending transfers need a reassignment target
+	err = s.DeleteUser(ctx, leaving.ID, "")
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	err = s.DeleteUser(ctx, leaving.ID, leaving.ID)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	err = s.DeleteUser(ctx, leaving.ID, "i-dont-exist")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	_, err = s.GetUser(ctx, leaving.ID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.DeleteUser(ctx, leaving.ID, heir.ID))
+
+	for _, id := range []string{owned.ID, sent.ID} {
+		c, err := s.GetCert(ctx, id)
+		assert.Nil(t, err)
+		assert.Equal(t, heir.ID, c.OwnerID)
+		assertSigned(t, key, c)
+
+		entries, err := s.GetLedger(ctx, id)
+		assert.Nil(t, err)
+		last := entries[len(entries)-1]
+		assert.Equal(t, ledger.Reassigned, last.Type)
+		assert.Equal(t, leaving.ID, last.Actor)
+	}
+
+	// pending transfers sent by the user are cancelled while those sent to
+	// them are rejected
+	txs, _, err := s.GetTxs(ctx, sent.ID, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Cancelled, txs[0].Status)
+
+	txs, _, err = s.GetTxs(ctx, incoming.ID, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Rejected, txs[0].Status)
+
+	c, err := s.GetCert(ctx, incoming.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, collector.ID, c.OwnerID)
+}
+
+func TestFileStoreDeleteUser(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+	leaving := newTestUser(t, s, "leaving@email.com")
+	heir := newTestUser(t, s, "heir@email.com")
+	c, err := s.CreateCert(ctx, leaving.ID, cert.Certificate{Title: "owned", OwnerID: leaving.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.DeleteUser(ctx, leaving.ID, heir.ID))
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	_, err = reloaded.GetUser(ctx, leaving.ID)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	got, err := reloaded.GetCert(ctx, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, heir.ID, got.OwnerID)
+}
+
+// failingSigner is a signer that fails once it signed left payloads.
+type failingSigner struct {
+	key  *signing.Key
+	left int
+}
+
+func (f *failingSigner) Sign(payload []byte) (cert.Signature, error) {
+	if f.left == 0 {
+		return cert.Signature{}, errors.New("signing key unavailable")
+	}
+	f.left--
+
+	return f.key.Sign(payload)
+}
+
+func TestDeleteUserReassignError(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	// the signer signs both certificates and fails while reassigning the
+	// second one
+	signer := &failingSigner{key: key, left: 3}
+	s := NewMemStore(WithSigner(signer))
+	leaving := newTestUser(t, s, "leaving@email.com")
+	heir := newTestUser(t, s, "heir@email.com")
+
+	for _, title := range []string{"first", "second"} {
+		_, err := s.CreateCert(ctx, leaving.ID, cert.Certificate{Title: title, OwnerID: leaving.ID, Year: 2018})
+		assert.Nil(t, err)
+	}
+
+	assert.EqualError(t, s.DeleteUser(ctx, leaving.ID, heir.ID), "could not sign certificate: signing key unavailable")
+
+	// the user is kept along with the certificate that was not reassigned
+	_, err = s.GetUser(ctx, leaving.ID)
+	assert.Nil(t, err)
+
+	owned, err := s.GetCerts(ctx, leaving.ID)
+	assert.Nil(t, err)
+	assert.Len(t, owned, 1)
+
+	reassigned, err := s.GetCerts(ctx, heir.ID)
+	assert.Nil(t, err)
+	assert.Len(t, reassigned, 1)
+
+	// deleting the user again reassigns the remaining certificate
+	signer.left = 1
+	assert.Nil(t, s.DeleteUser(ctx, leaving.ID, heir.ID))
+
+	reassigned, err = s.GetCerts(ctx, heir.ID)
+	assert.Nil(t, err)
+	assert.Len(t, reassigned, 2)
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Popcore/verisart/pkg/notify"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// DefaultEmailChangeTTL is the time users have to confirm the change of
+// their email address, unless configured with WithEmailChangeTTL.
+const DefaultEmailChangeTTL = 24 * time.Hour
+
+// emailChange is a pending change of the email address of a user, stored
+// under the hash of its verification token.
+type emailChange struct {
+	UserID    string    `json:"userId"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WithEmailChangeTTL sets the time users have to confirm the change of
+// their email address.
+func WithEmailChangeTTL(ttl time.Duration) Option {
+	return func(m *memStore) {
+		m.emailChangeTTL = ttl
+	}
+}
+
+// RequestEmailChange sends a verification token to email, the address
+// the user identified by userID wants to use. A new request replaces the
+// pending one of the user, if any. Users can request a change to their
+// current address only to verify it is theirs when it is an admin
+// address.
+func (m *memStore) RequestEmailChange(ctx context.Context, userID, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	email = users.NormalizeEmail(email)
+
+	u, ok := m.getUser(userID)
+	if !ok {
+		return newError(ErrNotFound, "user not found")
+	}
+
+	if u.Email == email && (u.Role == users.Admin || !m.isAdminAddress(email)) {
+		return newError(ErrValidation, "the new email address must be different from the current one")
+	}
+
+	if m.emailTaken(email, userID) {
+		return newError(ErrConflict, "a user with the same email address already exists")
+	}
+
+	return m.sendVerification(ctx, userID, email)
+}
+
+// sendVerification sends a new verification token to email on behalf of
+// the user identified by userID, replacing their pending email change.
+func (m *memStore) sendVerification(ctx context.Context, userID, email string) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+	expiresAt := m.now().Add(m.emailChangeTTL)
+
+	m.mu.Lock()
+	for h, change := range m.EmailChanges {
+		if change.UserID == userID {
+			delete(m.EmailChanges, h)
+		}
+	}
+	m.EmailChanges[hash] = emailChange{
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: expiresAt,
+	}
+	m.mu.Unlock()
+
+	err = m.notifier.Notify(ctx, notify.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm that %s is the new email address of your account with the verification token %s. The token expires at %s.",
+			email, token, expiresAt.Format(time.RFC3339)),
+		Secrets: []string{token},
+	})
+	if err != nil {
+		// the token was never delivered, so it could never be confirmed
+		m.mu.Lock()
+		delete(m.EmailChanges, hash)
+		m.mu.Unlock()
+		return fmt.Errorf("could not send verification token: %s", err.Error())
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange redeems a verification token sent to the user
+// identified by userID, switching their email address. Tokens can be
+// redeemed only once. Pending invitations sent to the new address are
+// claimed on behalf of the user, who becomes an admin if the address is
+// an admin address.
+func (m *memStore) ConfirmEmailChange(ctx context.Context, userID, token string) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hash := hashToken(token)
+
+	m.mu.Lock()
+	change, ok := m.EmailChanges[hash]
+	if ok && change.UserID == userID {
+		delete(m.EmailChanges, hash)
+	}
+	m.mu.Unlock()
+	if !ok || change.UserID != userID {
+		return nil, newError(ErrNotFound, "invalid verification token")
+	}
+
+	if !m.now().Before(change.ExpiresAt) {
+		return nil, newError(ErrConflict, "the verification token has expired")
+	}
+
+	u, err := m.setEmail(userID, change.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if admin, ok := m.promoteAdmin(userID); ok {
+		u = admin
+	}
+
+	m.claimInvitations(u)
+
+	return &u, nil
+}
+
+// dropEmailChanges deletes the pending email changes of the user
+// identified by userID. It must be called with the lock held.
+func (m *memStore) dropEmailChanges(userID string) {
+	for hash, change := range m.EmailChanges {
+		if change.UserID == userID {
+			delete(m.EmailChanges, hash)
+		}
+	}
+}
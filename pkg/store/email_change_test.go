@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/notify"
+)
+
+// tokenPattern matches the tokens sent in messages.
+var tokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// verificationToken returns the token of the last message sent to email.
+// It stops the test if there is none.
+func verificationToken(t *testing.T, n *notify.Memory, email string) string {
+	msg, ok := n.Last(email)
+	if !assert.True(t, ok, "no message sent to %s", email) {
+		t.FailNow()
+	}
+
+	token := tokenPattern.FindString(msg.Body)
+	if !assert.NotEmpty(t, token, "no token sent to %s", email) {
+		t.FailNow()
+	}
+	// tokens are secrets, which are never logged
+	assert.Equal(t, []string{token}, msg.Secrets)
+
+	return token
+}
+
+func TestChangeEmail(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithNotifier(n))
+	joe := newTestUser(t, s, "joe@email.com")
+
+	err := s.RequestEmailChange(ctx, joe.ID, "Joe.Blog@Email.com")
+	assert.Nil(t, err)
+
+	// the address changes only once the token is confirmed
+	got, err := s.GetUser(ctx, joe.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "joe@email.com", got.Email)
+
+	// the token is sent to the new address only and never stored
+	assert.Len(t, n.Messages(), 1)
+	token := verificationToken(t, n, "joe.blog@email.com")
+	_, ok := s.(*memStore).EmailChanges[token]
+	assert.False(t, ok)
+
+	updated, err := s.ConfirmEmailChange(ctx, joe.ID, token)
+	assert.Nil(t, err)
+	assert.Equal(t, joe.ID, updated.ID)
+	assert.Equal(t, "joe.blog@email.com", updated.Email)
+
+	got, err = s.GetUser(ctx, "joe.blog@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, joe.ID, got.ID)
+
+	_, err = s.GetUser(ctx, "joe@email.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// tokens can be redeemed only once
+	_, err = s.ConfirmEmailChange(ctx, joe.ID, token)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// the previous address is free again
+	newTestUser(t, s, "joe@email.com")
+}
+
+func TestRequestEmailChangeErrors(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithNotifier(n))
+	joe := newTestUser(t, s, "joe@email.com")
+	newTestUser(t, s, "ann@email.com")
+
+	err := s.RequestEmailChange(ctx, "i-dont-exist", "new@email.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	err = s.RequestEmailChange(ctx, joe.ID, "JOE@email.com")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	err = s.RequestEmailChange(ctx, joe.ID, "Ann@email.com")
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, "a user with the same email address already exists", err.Error())
+
+	assert.Empty(t, n.Messages())
+}
+
+func TestConfirmEmailChangeErrors(t *testing.T) {
+	n := &notify.Memory{}
+	c := clock.NewFake(time.Date(2018, 11, 21, 12, 0, 0, 0, time.UTC))
+	s := NewMemStore(WithNotifier(n), WithClock(c), WithEmailChangeTTL(time.Hour))
+	joe := newTestUser(t, s, "joe@email.com")
+	ann := newTestUser(t, s, "ann@email.com")
+
+	assert.Nil(t, s.RequestEmailChange(ctx, joe.ID, "first@email.com"))
+	first := verificationToken(t, n, "first@email.com")
+
+	// a new request replaces the pending one
+	assert.Nil(t, s.RequestEmailChange(ctx, joe.ID, "second@email.com"))
+	second := verificationToken(t, n, "second@email.com")
+
+	_, err := s.ConfirmEmailChange(ctx, joe.ID, first)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// tokens can only be redeemed by the user who requested them
+	_, err = s.ConfirmEmailChange(ctx, ann.ID, second)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// the address was taken after the change was requested
+	newTestUser(t, s, "second@email.com")
+	_, err = s.ConfirmEmailChange(ctx, joe.ID, second)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	assert.Nil(t, s.RequestEmailChange(ctx, joe.ID, "third@email.com"))
+	third := verificationToken(t, n, "third@email.com")
+
+	c.Advance(time.Hour)
+	_, err = s.ConfirmEmailChange(ctx, joe.ID, third)
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, "the verification token has expired", err.Error())
+
+	got, err := s.GetUser(ctx, joe.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "joe@email.com", got.Email)
+	assert.Empty(t, s.(*memStore).EmailChanges)
+}
+
+// failingNotifier is a notifier that cannot deliver messages.
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	return errors.New("mail server unavailable")
+}
+
+func TestRequestEmailChangeNotifierError(t *testing.T) {
+	s := NewMemStore(WithNotifier(failingNotifier{}))
+	joe := newTestUser(t, s, "joe@email.com")
+
+	err := s.RequestEmailChange(ctx, joe.ID, "new@email.com")
+	assert.EqualError(t, err, "could not send verification token: mail server unavailable")
+
+	// changes whose token was not delivered are dropped
+	assert.Empty(t, s.(*memStore).EmailChanges)
+}
+
+func TestEmailChangeClaimsInvitations(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithNotifier(n))
+	c, _ := newInvitation(t, s)
+	collector := newTestUser(t, s, "collector@email.com")
+
+	assert.Nil(t, s.RequestEmailChange(ctx, collector.ID, "Invited@email.com"))
+	_, err := s.ConfirmEmailChange(ctx, collector.ID, verificationToken(t, n, "invited@email.com"))
+	assert.Nil(t, err)
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, collector.ID, txs[0].RecipientID)
+	assert.NotNil(t, txs[0].Invitation.ClaimedAt)
+}
+
+func TestDeleteUserDropsEmailChanges(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithNotifier(n))
+	joe := newTestUser(t, s, "joe@email.com")
+
+	assert.Nil(t, s.RequestEmailChange(ctx, joe.ID, "new@email.com"))
+	assert.Nil(t, s.DeleteUser(ctx, joe.ID, ""))
+
+	assert.Empty(t, s.(*memStore).EmailChanges)
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors below describe the kinds of failure a Storer can report.
+// They are never returned on their own but wrapped in an *Error, and can be
+// detected with errors.Is.
+var (
+	// ErrNotFound is reported when the requested resource does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is reported when an operation clashes with the current
+	// state of a resource, e.g. a duplicate user or a pending transfer.
+	ErrConflict = errors.New("conflict")
+
+	// ErrForbidden is reported when the operation is not allowed.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrValidation is reported when the supplied data is not valid.
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is the error type returned by stores. It holds the kind of
+// failure, one of the Err* values, and a message describing it.
+type Error struct {
+	Kind error
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns the kind of the error so that it can be matched
+// with errors.Is.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// newError returns an *Error of the given kind. The message is
+// formatted according to format.
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
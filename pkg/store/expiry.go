@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+)
+
+// DefaultTransferTTL is the time transactions created without an expiry
+// stay pending, unless configured with WithTransferTTL.
+const DefaultTransferTTL = 30 * 24 * time.Hour
+
+// WithTransferTTL sets the time transactions created without an expiry
+// stay pending. With a ttl of 0 such transactions never expire.
+func WithTransferTTL(ttl time.Duration) Option {
+	return func(m *memStore) {
+		m.transferTTL = ttl
+	}
+}
+
+// deadline returns the time a pending transaction expires: its expiry or,
+// for invitations that were not claimed yet, the end of the claim window
+// if earlier. It returns false if the transaction never expires.
+func deadline(tx cert.Transaction) (time.Time, bool) {
+	var (
+		at  time.Time
+		set bool
+	)
+
+	if tx.ExpiresAt != nil {
+		at, set = *tx.ExpiresAt, true
+	}
+
+	if awaitingClaim(tx) && (!set || tx.Invitation.ExpiresAt.Before(at)) {
+		at, set = tx.Invitation.ExpiresAt, true
+	}
+
+	return at, set
+}
+
+// txExpired returns true if tx is pending and its deadline is before now.
+func txExpired(tx cert.Transaction, now time.Time) bool {
+	if tx.Status != cert.Pending {
+		return false
+	}
+
+	at, ok := deadline(tx)
+
+	return ok && now.After(at)
+}
+
+// expireTx marks the most recent transaction of c, whose deadline has
+// passed, as expired. It returns the updated certificate and transactions.
+// It must be called with the certificate lock held.
+func (m *memStore) expireTx(c cert.Certificate, txs []cert.Transaction) (cert.Certificate, []cert.Transaction, error) {
+	tx := txs[0]
+	expiredAt, _ := deadline(tx)
+	tx.Status = cert.Expired
+	tx.ResolvedAt = &expiredAt
+
+	// expiries are caused by the service itself rather than by a user
+	if err := m.saveLastTx(&c, txs, tx, ledger.TransferExpired, ledger.Actor{}, m.now()); err != nil {
+		return c, txs, err
+	}
+
+	_, txs, _ = m.getCert(c.ID)
+
+	return c, txs, nil
+}
+
+// ExpireTxs marks the pending transactions whose deadline is before now
+// as expired. It returns the number of expired transactions, including
+// those expired before ctx was done.
+func (m *memStore) ExpireTxs(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	overdue := []string{}
+	for certID, txs := range m.Txs {
+		if len(txs) > 0 && txExpired(txs[0], now) {
+			overdue = append(overdue, certID)
+		}
+	}
+	m.mu.RUnlock()
+
+	expired := 0
+	for _, certID := range overdue {
+		if err := ctx.Err(); err != nil {
+			return expired, err
+		}
+
+		ok, err := m.expireCertTx(certID, now)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+// expireCertTx expires the most recent transaction of a certificate if
+// its deadline is still before now once the certificate is locked.
+func (m *memStore) expireCertTx(certID string, now time.Time) (bool, error) {
+	unlock := m.certLocks.Lock(certID)
+	defer unlock()
+
+	c, txs, ok := m.getCert(certID)
+	if !ok || len(txs) == 0 || !txExpired(txs[0], now) {
+		return false, nil
+	}
+
+	if _, _, err := m.expireTx(c, txs); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
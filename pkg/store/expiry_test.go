@@ -0,0 +1,197 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+)
+
+// newTransfer creates a certificate owned by owner1@email.com and a
+// transaction sending it to collector@email.com.
+func newTransfer(t *testing.T, s Storer, tx cert.Transaction) (*cert.Certificate, *cert.Transaction) {
+	owner := newTestUser(t, s, "owner1@email.com")
+	newTestUser(t, s, "collector@email.com")
+
+	c, err := s.CreateCert(ctx, owner.ID, cert.Certificate{Title: "the-title", OwnerID: owner.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	tx.To = "collector@email.com"
+	created, err := s.CreateTx(ctx, owner.ID, c.ID, tx)
+	assert.Nil(t, err)
+
+	return c, created
+}
+
+func TestTransferExpiry(t *testing.T) {
+	s := NewMemStore()
+	_, tx := newTransfer(t, s, cert.Transaction{})
+	if assert.NotNil(t, tx.ExpiresAt) {
+		assert.Equal(t, tx.CreatedAt.Add(DefaultTransferTTL), *tx.ExpiresAt)
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Hour)
+	s = NewMemStore()
+	_, tx = newTransfer(t, s, cert.Transaction{ExpiresAt: &expiresAt})
+	assert.Equal(t, expiresAt, *tx.ExpiresAt)
+
+	s = NewMemStore(WithTransferTTL(0))
+	_, tx = newTransfer(t, s, cert.Transaction{})
+	assert.Nil(t, tx.ExpiresAt)
+
+	// transactions cannot be created already expired
+	s = NewMemStore()
+	past := time.Now().UTC().Add(-time.Hour)
+	c, _ := newTransfer(t, s, cert.Transaction{})
+	_, err := s.CancelTx(ctx, c.OwnerID, c.ID)
+	assert.Nil(t, err)
+	_, err = s.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "collector@email.com", ExpiresAt: &past})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestExpireTxs(t *testing.T) {
+	s := NewMemStore()
+	c, tx := newTransfer(t, s, cert.Transaction{})
+
+	n, err := s.ExpireTxs(ctx, tx.ExpiresAt.Add(-time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = s.ExpireTxs(ctx, tx.ExpiresAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+	assert.Equal(t, *tx.ExpiresAt, *txs[0].ResolvedAt)
+
+	entries, err := s.GetLedger(ctx, c.ID)
+	assert.Nil(t, err)
+	last := entries[len(entries)-1]
+	assert.Equal(t, "transfer_expired", string(last.Type))
+	assert.Empty(t, last.Actor)
+
+	// expired transactions are swept once and can no longer be accepted
+	n, err = s.ExpireTxs(ctx, tx.ExpiresAt.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = s.AcceptTx(ctx, tx.RecipientID, c.ID)
+	assert.True(t, errors.Is(err, ErrConflict))
+}
+
+func TestExpireTxsUnclaimedInvitation(t *testing.T) {
+	s := NewMemStore()
+	c, tx := newInvitation(t, s)
+
+	// unclaimed invitations expire at the end of the claim window, before
+	// the transaction expiry
+	n, err := s.ExpireTxs(ctx, tx.Invitation.ExpiresAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+	assert.Equal(t, tx.Invitation.ExpiresAt, *txs[0].ResolvedAt)
+}
+
+func TestFileStoreExpireTxs(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+	c, tx := newTransfer(t, s, cert.Transaction{})
+
+	n, err := s.ExpireTxs(ctx, tx.ExpiresAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	txs, _, err := reloaded.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+	assert.Equal(t, *tx.ExpiresAt, *txs[0].ExpiresAt)
+}
+
+func TestResolveTxExpiresOnlyForInvolvedUsers(t *testing.T) {
+	now := clock.NewFake(testTime)
+	s := NewMemStore(WithClock(now))
+	c, tx := newTransfer(t, s, cert.Transaction{})
+	stranger := newTestUser(t, s, "stranger@email.com")
+
+	now.Set(tx.ExpiresAt.Add(time.Second))
+
+	// users who are not involved in the transaction cannot expire it
+	_, err := s.AcceptTx(ctx, stranger.ID, c.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	_, err = s.CancelTx(ctx, stranger.ID, c.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Pending, txs[0].Status)
+
+	_, err = s.AcceptTx(ctx, tx.RecipientID, c.ID)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	txs, _, err = s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+}
+
+func TestFileStorePersistsLazyExpiry(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	now := clock.NewFake(testTime)
+	s, err := NewFileStore(path, WithClock(now))
+	assert.Nil(t, err)
+	c, tx := newTransfer(t, s, cert.Transaction{})
+
+	// the transaction is expired while being accepted, which fails
+	now.Set(tx.ExpiresAt.Add(time.Second))
+	_, err = s.AcceptTx(ctx, tx.RecipientID, c.ID)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	head, err := s.GetTreeHead(ctx)
+	assert.Nil(t, err)
+
+	reloaded, err := NewFileStore(path, WithClock(now))
+	assert.Nil(t, err)
+
+	txs, _, err := reloaded.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+
+	reloadedHead, err := reloaded.GetTreeHead(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, head.TreeSize, reloadedHead.TreeSize)
+	assert.Equal(t, head.RootHash, reloadedHead.RootHash)
+
+	// the same holds when a new transaction fails after expiring the
+	// previous one
+	_, err = reloaded.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "collector@email.com"})
+	assert.Nil(t, err)
+
+	now.Advance(DefaultTransferTTL + time.Second)
+	past := now.Now().Add(-time.Hour)
+	_, err = reloaded.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "collector@email.com", ExpiresAt: &past})
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	reloaded, err = NewFileStore(path, WithClock(now))
+	assert.Nil(t, err)
+
+	txs, _, err = reloaded.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, txs, 2)
+	assert.Equal(t, cert.Expired, txs[1].Status)
+}
@@ -0,0 +1,457 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/organizations"
+	"github.com/Popcore/verisart/pkg/transparency"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// snapshotVersion is the version of the format of the snapshots written
+// by the store. Snapshots written before versions were introduced have
+// version 0 and identify users by email address. Snapshots written before
+// version 2 may hold email addresses that are not in canonical form, and
+// snapshots written before version 3 hold users without a role.
+const snapshotVersion = 3
+
+// snapshot is the on-disk representation of the data held by a store.
+type snapshot struct {
+	Version int `json:"version"`
+
+	Users  map[string]users.User                 `json:"users"`
+	Tokens map[string]string                     `json:"tokens"`
+	Orgs   map[string]organizations.Organization `json:"organizations"`
+	Certs  map[string]cert.Certificate           `json:"certificates"`
+	Txs    map[string][]cert.Transaction         `json:"transactions"`
+	Ledger map[string][]ledger.Entry             `json:"ledger"`
+	Log    []transparency.LeafRef                `json:"log"`
+
+	Invitations  map[string]invitation  `json:"invitations"`
+	EmailChanges map[string]emailChange `json:"emailChanges"`
+}
+
+// fileStore is the file backed implementation of the Storer interface.
+// Reads are served from an embedded memStore while every successful write
+// is followed by a snapshot of the whole store being saved to disk, so that
+// data survives process restarts.
+type fileStore struct {
+	*memStore
+	path string
+
+	// mu serializes writes to the data file.
+	mu sync.Mutex
+}
+
+// NewFileStore returns a Storer that persists its data in the file located
+// at path. If the file exists its content is loaded in the store, otherwise
+// it will be created on the first write. The store is configured with opts.
+func NewFileStore(path string, opts ...Option) (Storer, error) {
+	m := NewMemStore(opts...).(*memStore)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read data file: %s", err.Error())
+	}
+
+	snap := snapshot{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("could not parse data file %s: %s", path, err.Error())
+		}
+
+		if snap.Users != nil {
+			m.Users = snap.Users
+		}
+		if snap.Tokens != nil {
+			m.Tokens = snap.Tokens
+		}
+		if snap.Orgs != nil {
+			m.Orgs = snap.Orgs
+		}
+		if snap.Certs != nil {
+			m.Certs = snap.Certs
+		}
+		if snap.Txs != nil {
+			m.Txs = snap.Txs
+		}
+		if snap.Ledger != nil {
+			m.Ledger = snap.Ledger
+		}
+		if snap.Invitations != nil {
+			m.Invitations = snap.Invitations
+		}
+		if snap.EmailChanges != nil {
+			m.EmailChanges = snap.EmailChanges
+		}
+		if err := m.loadLog(snap.Log); err != nil {
+			return nil, fmt.Errorf("could not load data file %s: %s", path, err.Error())
+		}
+	}
+
+	f := &fileStore{
+		memStore: m,
+		path:     path,
+	}
+
+	if len(data) > 0 && snap.Version < snapshotVersion {
+		if err := m.migrate(snap.Version); err != nil {
+			return nil, fmt.Errorf("could not migrate data file %s: %s", path, err.Error())
+		}
+		if err := f.save(); err != nil {
+			return nil, err
+		}
+	}
+	m.indexEmails()
+
+	return f, nil
+}
+
+// save writes the current content of the store to disk. The snapshot is
+// first written to a temporary file which then replaces the data file, so
+// that a crash never leaves a partially written file behind.
+func (f *fileStore) save() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.memStore.mu.RLock()
+	f.userStore.mu.RLock()
+	data, err := json.Marshal(snapshot{
+		Version: snapshotVersion,
+
+		Users:  f.Users,
+		Tokens: f.Tokens,
+		Orgs:   f.Orgs,
+		Certs:  f.Certs,
+		Txs:    f.Txs,
+		Ledger: f.Ledger,
+		Log:    f.Log,
+
+		Invitations:  f.Invitations,
+		EmailChanges: f.EmailChanges,
+	})
+	f.userStore.mu.RUnlock()
+	f.memStore.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("could not persist data: %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not persist data: %s", err.Error())
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not persist data: %s", err.Error())
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not persist data: %s", err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("could not persist data: %s", err.Error())
+	}
+
+	return nil
+}
+
+// logSize returns the number of leaves of the transparency log. Every
+// change made to a certificate adds a leaf to the log.
+func (m *memStore) logSize() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.Log)
+}
+
+// saveChanges persists the store after an operation that returned err,
+// when the log had size leaves before the operation started. Operations
+// that fail are persisted too when they changed a certificate first, for
+// instance by expiring an overdue transaction, so that the data file and
+// the signed log do not diverge from the store. It returns err, or the
+// error that prevented the store from being saved.
+func (f *fileStore) saveChanges(size int, err error) error {
+	if err != nil && f.logSize() == size {
+		return err
+	}
+
+	if saveErr := f.save(); saveErr != nil {
+		return saveErr
+	}
+
+	return err
+}
+
+// NewUser adds a new user to the store and persists it.
+func (f *fileStore) NewUser(ctx context.Context, email string, name string) (*users.User, error) {
+	u, err := f.memStore.NewUser(ctx, email, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// IssueToken generates a new API token for a user and persists its hash.
+func (f *fileStore) IssueToken(ctx context.Context, userID string) (string, error) {
+	token, err := f.memStore.IssueToken(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := f.save(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// CreateCert adds a new certificate to the store and persists it.
+func (f *fileStore) CreateCert(ctx context.Context, userID string, c cert.Certificate) (*cert.Certificate, error) {
+	created, err := f.memStore.CreateCert(ctx, userID, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// UpdateCert applies a patch to an existing certificate and persists the change.
+func (f *fileStore) UpdateCert(ctx context.Context, userID, id string, p cert.Patch) (*cert.Certificate, error) {
+	updated, err := f.memStore.UpdateCert(ctx, userID, id, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteCert removes a certificate from the store and persists the change.
+func (f *fileStore) DeleteCert(ctx context.Context, userID, id string) error {
+	if err := f.memStore.DeleteCert(ctx, userID, id); err != nil {
+		return err
+	}
+
+	return f.save()
+}
+
+// CreateTx creates a new pending transaction and persists it, together
+// with the expiry of the previous transaction if it was overdue.
+func (f *fileStore) CreateTx(ctx context.Context, userID, certID string, tx cert.Transaction) (*cert.Transaction, error) {
+	size := f.logSize()
+	created, err := f.memStore.CreateTx(ctx, userID, certID, tx)
+	if err := f.saveChanges(size, err); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// AcceptTx accepts the pending transaction of a certificate and persists
+// the new ownership, or the expiry of the transaction if it is overdue.
+func (f *fileStore) AcceptTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	size := f.logSize()
+	updated, err := f.memStore.AcceptTx(ctx, userID, certID)
+	if err := f.saveChanges(size, err); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// RejectTx rejects the pending transaction of a certificate and persists
+// the change.
+func (f *fileStore) RejectTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	size := f.logSize()
+	updated, err := f.memStore.RejectTx(ctx, userID, certID)
+	if err := f.saveChanges(size, err); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// CancelTx cancels the pending transaction of a certificate and persists
+// the change.
+func (f *fileStore) CancelTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	size := f.logSize()
+	updated, err := f.memStore.CancelTx(ctx, userID, certID)
+	if err := f.saveChanges(size, err); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ClaimInvitation redeems the claim token of a transaction and persists
+// its new recipient, or the expiry of the invitation if it is overdue.
+func (f *fileStore) ClaimInvitation(ctx context.Context, userID, token string) (*cert.Transaction, error) {
+	size := f.logSize()
+	claimed, err := f.memStore.ClaimInvitation(ctx, userID, token)
+	if err := f.saveChanges(size, err); err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// ExpireTxs marks overdue transactions as expired and persists the change.
+func (f *fileStore) ExpireTxs(ctx context.Context, now time.Time) (int, error) {
+	expired, err := f.memStore.ExpireTxs(ctx, now)
+	if expired == 0 {
+		return expired, err
+	}
+
+	if saveErr := f.save(); saveErr != nil {
+		return expired, saveErr
+	}
+
+	return expired, err
+}
+
+// Close persists the current content of the store. Every write is already
+// persisted when it succeeds, so Close only guarantees that the data file
+// exists and reflects the store once the last write completed. It should
+// be called after all writes completed.
+func (f *fileStore) Close() error {
+	return f.save()
+}
+
+// UpdateUser applies a patch to a user and persists the change.
+func (f *fileStore) UpdateUser(ctx context.Context, userID string, p users.Patch) (*users.User, error) {
+	u, err := f.memStore.UpdateUser(ctx, userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// RequestEmailChange sends a verification token to the new email address
+// of a user and persists the pending change.
+func (f *fileStore) RequestEmailChange(ctx context.Context, userID, email string) error {
+	if err := f.memStore.RequestEmailChange(ctx, userID, email); err != nil {
+		return err
+	}
+
+	return f.save()
+}
+
+// ConfirmEmailChange redeems a verification token and persists the new
+// email address of the user.
+func (f *fileStore) ConfirmEmailChange(ctx context.Context, userID, token string) (*users.User, error) {
+	u, err := f.memStore.ConfirmEmailChange(ctx, userID, token)
+
+	// tokens are redeemed even when the change fails because they
+	// expired or the address was taken in the meantime
+	if err != nil && !errors.Is(err, ErrConflict) {
+		return nil, err
+	}
+
+	if saveErr := f.save(); saveErr != nil {
+		return nil, saveErr
+	}
+
+	return u, err
+}
+
+// AssignRole changes the role of a user and persists the change.
+func (f *fileStore) AssignRole(ctx context.Context, userID string, a users.RoleAssignment) (*users.User, error) {
+	u, err := f.memStore.AssignRole(ctx, userID, a)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// DeleteUser removes a user, reassigning its certificates if requested,
+// and persists the change. Certificates reassigned before an error are
+// persisted too.
+func (f *fileStore) DeleteUser(ctx context.Context, userID, reassignTo string) error {
+	size := f.logSize()
+
+	return f.saveChanges(size, f.memStore.DeleteUser(ctx, userID, reassignTo))
+}
+
+// CreateOrganization adds a new organization to the store and persists it.
+func (f *fileStore) CreateOrganization(ctx context.Context, userID, name string) (*organizations.Organization, error) {
+	o, err := f.memStore.CreateOrganization(ctx, userID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// SetMember adds a member to an organization, or changes their
+// permissions, and persists the change.
+func (f *fileStore) SetMember(ctx context.Context, userID, orgID string, m organizations.Member) (*organizations.Organization, error) {
+	o, err := f.memStore.SetMember(ctx, userID, orgID, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// RemoveMember removes a member from an organization and persists the
+// change.
+func (f *fileStore) RemoveMember(ctx context.Context, userID, orgID, memberID string) (*organizations.Organization, error) {
+	o, err := f.memStore.RemoveMember(ctx, userID, orgID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
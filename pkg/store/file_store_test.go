@@ -0,0 +1,383 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ids"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/notify"
+	"github.com/Popcore/verisart/pkg/signing"
+)
+
+// tempDataFile returns the path of a data file located in a new temporary
+// directory, together with a function that removes the directory.
+func tempDataFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "verisart")
+	assert.Nil(t, err)
+
+	return filepath.Join(dir, "data.json"), func() { os.RemoveAll(dir) }
+}
+
+// testStorer exercises the behaviour that every Storer implementation
+// must provide.
+func testStorer(t *testing.T, s Storer) {
+	owner1 := newTestUser(t, s, "owner1@email.com")
+	owner2 := newTestUser(t, s, "owner2@email.com")
+
+	_, err := s.NewUser(ctx, "owner1@email.com", "joe blog")
+	assert.NotNil(t, err)
+
+	created, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	// certificates are owned by user IDs, not email addresses
+	_, err = s.CreateCert(ctx, "owner1@email.com", cert.Certificate{
+		Title:   "the-title",
+		OwnerID: "owner1@email.com",
+	})
+	assert.NotNil(t, err)
+
+	title := "the-new-title"
+	updated, err := s.UpdateCert(ctx, owner1.ID, created.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+	assert.Equal(t, "the-new-title", updated.Title)
+	assert.Equal(t, 2018, updated.Year)
+
+	tx, err := s.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, owner1.ID, tx.From)
+	assert.Equal(t, owner2.ID, tx.RecipientID)
+
+	_, err = s.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.NotNil(t, err)
+
+	accepted, err := s.AcceptTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, owner2.ID, accepted.OwnerID)
+
+	certs, err := s.GetCerts(ctx, owner2.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+
+	certs, err = s.GetCerts(ctx, owner1.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 0)
+
+	assert.Nil(t, s.DeleteCert(ctx, owner2.ID, created.ID))
+	assert.NotNil(t, s.DeleteCert(ctx, owner2.ID, created.ID))
+}
+
+func TestMemStoreStorer(t *testing.T) {
+	testStorer(t, NewMemStore())
+}
+
+func TestFileStoreStorer(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	testStorer(t, s)
+}
+
+func TestFileStoreReload(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	owner1 := newTestUser(t, s, "owner1@email.com")
+	owner2 := newTestUser(t, s, "owner2@email.com")
+
+	created, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	_, err = s.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+
+	token, err := s.IssueToken(ctx, owner1.ID)
+	assert.Nil(t, err)
+
+	// a new store reading the same file should see everything written
+	// by the first one
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	certs, err := reloaded.GetCerts(ctx, owner1.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, created.ID, certs[0].ID)
+	assert.Equal(t, cert.Pending, certs[0].Transfer.Status)
+
+	_, err = reloaded.NewUser(ctx, "owner2@email.com", "miss smith")
+	assert.NotNil(t, err)
+
+	user, err := reloaded.Authenticate(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, owner1, *user)
+
+	// the email index is rebuilt when the store is loaded
+	user, err = reloaded.GetUser(ctx, "owner2@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, owner2, *user)
+
+	accepted, err := reloaded.AcceptTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, owner2.ID, accepted.OwnerID)
+}
+
+func TestFileStoreErrorInvalidFile(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(path, []byte("this-is-not-json"), 0600)
+	assert.Nil(t, err)
+
+	_, err = NewFileStore(path)
+	assert.NotNil(t, err)
+}
+
+func TestFileStoreLedgerTampering(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	owner := newTestUser(t, s, "owner1@email.com")
+
+	created, err := s.CreateCert(ctx, owner.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+
+	title := "the-new-title"
+	_, err = s.UpdateCert(ctx, owner.ID, created.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	entries, err := reloaded.GetLedger(ctx, created.ID)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Nil(t, ledger.Verify(entries))
+
+	// an operator rewriting the history in the data file breaks the chain
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	data = bytes.Replace(data, []byte(`"title":"the-title"`), []byte(`"title":"a-forged-title"`), -1)
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+
+	tampered, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	entries, err = tampered.GetLedger(ctx, created.ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, ledger.Verify(entries))
+}
+
+func TestFileStoreClose(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	// closing a store that was never written creates the data file
+	closer, ok := s.(io.Closer)
+	if assert.True(t, ok) {
+		assert.Nil(t, closer.Close())
+	}
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+
+	_, err = NewFileStore(path)
+	assert.Nil(t, err)
+}
+
+// legacyData is a data file written before users were identified by ID.
+// Users, token owners, certificate owners and transactions reference
+// email addresses.
+const legacyData = `{
+	"users": {
+		"owner1@email.com": {"id": "", "email": "owner1@email.com", "name": "joe blog"},
+		"owner2@email.com": {"id": "owner2-id", "email": "owner2@email.com", "name": "miss smith"}
+	},
+	"tokens": {"the-token-hash": "owner1@email.com"},
+	"certificates": {
+		"cert1": {
+			"id": "cert1",
+			"title": "the-title",
+			"ownerId": "owner1@email.com",
+			"year": 2018,
+			"transfer": {"id": "tx1", "from": "owner1@email.com", "email": "owner2@email.com", "status": "pending"}
+		},
+		"cert2": {
+			"id": "cert2",
+			"title": "another-title",
+			"ownerId": "owner1@email.com",
+			"year": 2018,
+			"transfer": {"id": "tx2", "from": "owner1@email.com", "email": "invited@email.com", "status": "pending", "invitation": {}}
+		}
+	},
+	"transactions": {
+		"cert1": [{"id": "tx1", "from": "owner1@email.com", "email": "owner2@email.com", "status": "pending"}],
+		"cert2": [{"id": "tx2", "from": "owner1@email.com", "email": "invited@email.com", "status": "pending", "invitation": {}}]
+	}
+}`
+
+func TestFileStoreMigratesUserIDs(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(legacyData), 0600))
+
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s, err := NewFileStore(path, WithSigner(key), WithIDGenerator(&ids.Sequence{}))
+	assert.Nil(t, err)
+
+	// users without an ID are given one while existing IDs are kept
+	owner1, err := s.GetUser(ctx, "owner1@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", owner1.ID)
+
+	owner2, err := s.GetUser(ctx, "owner2-id")
+	assert.Nil(t, err)
+	assert.Equal(t, "owner2@email.com", owner2.Email)
+
+	assert.Equal(t, map[string]string{"the-token-hash": owner1.ID}, s.(*fileStore).Tokens)
+
+	c, err := s.GetCert(ctx, "cert1")
+	assert.Nil(t, err)
+	assert.Equal(t, owner1.ID, c.OwnerID)
+	assert.Equal(t, owner1.ID, c.Transfer.From)
+	assert.Equal(t, owner2.ID, c.Transfer.RecipientID)
+	assertSigned(t, key, c)
+
+	// unclaimed invitations have no recipient yet
+	txs, _, err := s.GetTxs(ctx, "cert2", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, owner1.ID, txs[0].From)
+	assert.Empty(t, txs[0].RecipientID)
+
+	// the migrated data is saved, so that it is migrated only once
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"version":3`)
+
+	reloaded, err := NewFileStore(path, WithSigner(key))
+	assert.Nil(t, err)
+
+	accepted, err := reloaded.AcceptTx(ctx, owner2.ID, "cert1")
+	assert.Nil(t, err)
+	assert.Equal(t, owner2.ID, accepted.OwnerID)
+}
+
+func TestFileStoreNormalizesEmails(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	data := `{
+		"version": 1,
+		"users": {
+			"owner1-id": {"id": "owner1-id", "email": "Owner1@Email.com", "name": "joe blog"}
+		},
+		"certificates": {
+			"cert1": {"id": "cert1", "title": "the-title", "year": 2018, "ownerId": "owner1-id",
+				"transfer": {"id": "tx1", "from": "owner1-id", "email": "Invited@Email.com", "status": "pending",
+					"invitation": {"expiresAt": "2100-01-01T00:00:00Z"}}}
+		},
+		"transactions": {
+			"cert1": [{"id": "tx1", "from": "owner1-id", "email": "Invited@Email.com", "status": "pending",
+				"invitation": {"expiresAt": "2100-01-01T00:00:00Z"}}]
+		},
+		"invitations": {
+			"the-token-hash": {"certificateId": "cert1", "transactionId": "tx1", "email": "Invited@Email.com", "expiresAt": "2100-01-01T00:00:00Z"}
+		}
+	}`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	owner1, err := s.GetUser(ctx, "owner1@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "owner1@email.com", owner1.Email)
+
+	// invitations sent to addresses typed with a different case are
+	// claimed on sign up
+	invited := newTestUser(t, s, "invited@email.com")
+	c, err := s.GetCert(ctx, "cert1")
+	assert.Nil(t, err)
+	assert.Equal(t, "invited@email.com", c.Transfer.To)
+	assert.Equal(t, invited.ID, c.Transfer.RecipientID)
+}
+
+func TestFileStoreEmailConflictOnLoad(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	data := `{
+		"version": 1,
+		"users": {
+			"user1": {"id": "user1", "email": "joe@email.com", "name": "joe blog"},
+			"user2": {"id": "user2", "email": "Joe@Email.com", "name": "joe blog"}
+		}
+	}`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	_, err := NewFileStore(path)
+	assert.EqualError(t, err, "could not migrate data file "+path+": users user1 and user2 share the email address joe@email.com")
+}
+
+func TestFileStoreEmailChange(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	n := &notify.Memory{}
+	s, err := NewFileStore(path, WithNotifier(n))
+	assert.Nil(t, err)
+
+	joe := newTestUser(t, s, "joe@email.com")
+	assert.Nil(t, s.RequestEmailChange(ctx, joe.ID, "new@email.com"))
+
+	// pending changes survive restarts
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	updated, err := reloaded.ConfirmEmailChange(ctx, joe.ID, verificationToken(t, n, "new@email.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new@email.com", updated.Email)
+
+	reloaded, err = NewFileStore(path)
+	assert.Nil(t, err)
+
+	got, err := reloaded.GetUser(ctx, "new@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, joe.ID, got.ID)
+	assert.Empty(t, reloaded.(*fileStore).EmailChanges)
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/logging"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// DefaultInvitationTTL is the time recipients who are not users have to
+// claim a transaction, unless configured with WithInvitationTTL.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// invitation is the record of a transaction sent to a recipient who was
+// not a user, stored under the hash of its claim token.
+type invitation struct {
+	CertID    string    `json:"certificateId"`
+	TxID      string    `json:"transactionId"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WithInvitationTTL sets the time recipients who are not users have to
+// claim a transaction.
+func WithInvitationTTL(ttl time.Duration) Option {
+	return func(m *memStore) {
+		m.invitationTTL = ttl
+	}
+}
+
+// awaitingClaim returns true if tx is a pending invitation that was not
+// claimed yet.
+func awaitingClaim(tx cert.Transaction) bool {
+	return tx.Status == cert.Pending && tx.Invitation != nil && tx.Invitation.ClaimedAt == nil
+}
+
+// saveLastTx replaces the most recent transaction of c with tx, makes it
+// the certificate transfer and records event in the ledger. The claim
+// token of tx is dropped once it is no longer awaiting a claim. actor is
+// the user who caused the event, or empty for the service.
+// It must be called with the certificate lock held.
+func (m *memStore) saveLastTx(c *cert.Certificate, txs []cert.Transaction, tx cert.Transaction, event ledger.EventType, actor ledger.Actor, at time.Time) error {
+	c.Transfer = &tx
+
+	chain, err := ledger.Append(m.getLedger(c.ID), c.ID, event, actor, at, tx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Certs[c.ID] = *c
+	m.Txs[c.ID] = append([]cert.Transaction{tx}, txs[1:]...)
+	m.appendLedger(c.ID, chain)
+
+	if tx.Invitation != nil && !awaitingClaim(tx) {
+		for hash, inv := range m.Invitations {
+			if inv.TxID == tx.ID {
+				delete(m.Invitations, hash)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ClaimInvitation redeems the claim token of a transaction, making the
+// user identified by userID its recipient.
+func (m *memStore) ClaimInvitation(ctx context.Context, userID, token string) (*cert.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	inv, ok := m.Invitations[hashToken(token)]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, newError(ErrNotFound, "invalid claim token")
+	}
+
+	u, ok := m.getUser(userID)
+	if !ok {
+		return nil, newError(ErrNotFound, "user not found")
+	}
+
+	return m.claim(u, inv)
+}
+
+// claim makes u the recipient of the invited transaction.
+func (m *memStore) claim(u users.User, inv invitation) (*cert.Transaction, error) {
+	unlock := m.certLocks.Lock(inv.CertID)
+	defer unlock()
+
+	c, txs, ok := m.getCert(inv.CertID)
+	if !ok || len(txs) == 0 || txs[0].ID != inv.TxID || !awaitingClaim(txs[0]) {
+		return nil, newError(ErrNotFound, "invalid claim token")
+	}
+
+	if txExpired(txs[0], m.now()) {
+		if _, _, err := m.expireTx(c, txs); err != nil {
+			return nil, err
+		}
+		return nil, newError(ErrConflict, "the invitation has expired")
+	}
+
+	if c.OwnerID == u.ID {
+		return nil, newError(ErrValidation, "certificate owners cannot claim their own transactions")
+	}
+
+	claimedAt := m.now()
+	tx := txs[0]
+	tx.To = u.Email
+	tx.RecipientID = u.ID
+	tx.Invitation = &cert.Invitation{
+		ExpiresAt: tx.Invitation.ExpiresAt,
+		ClaimedAt: &claimedAt,
+	}
+
+	if err := m.saveLastTx(&c, txs, tx, ledger.TransferClaimed, m.actor(u.ID), claimedAt); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// NewUser adds a new user to the store. Pending invitations sent to the
+// user email address are claimed on their behalf. Users signing up with
+// an admin address are sent a verification token, which makes them
+// admins once confirmed with ConfirmEmailChange.
+func (m *memStore) NewUser(ctx context.Context, email string, name string) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	u, err := m.userStore.NewUser(ctx, email, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.claimInvitations(*u)
+
+	if m.isAdminAddress(u.Email) {
+		// the user can request a new token if this one is not delivered
+		if err := m.sendVerification(ctx, u.ID, u.Email); err != nil {
+			logging.Warnf("Could not verify the admin address of user %s: %s", u.ID, err.Error())
+		}
+	}
+
+	return u, nil
+}
+
+// claimInvitations claims the pending invitations sent to the email
+// address of u on their behalf. Invitations that cannot be claimed, e.g.
+// because they expired, are logged and left for the certificate owner to
+// deal with.
+func (m *memStore) claimInvitations(u users.User) {
+	m.mu.RLock()
+	invited := []invitation{}
+	for _, inv := range m.Invitations {
+		if inv.Email == u.Email {
+			invited = append(invited, inv)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, inv := range invited {
+		if _, err := m.claim(u, inv); err != nil {
+			logging.Warnf("Could not claim transaction %s of certificate %s for user %s: %s", inv.TxID, inv.CertID, u.ID, err.Error())
+		}
+	}
+}
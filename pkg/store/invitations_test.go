@@ -0,0 +1,205 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+)
+
+// newInvitation creates a certificate owned by owner1@email.com and a
+// transaction sending it to invited@email.com, who is not a user.
+func newInvitation(t *testing.T, s Storer) (*cert.Certificate, *cert.Transaction) {
+	owner := newTestUser(t, s, "owner1@email.com")
+
+	c, err := s.CreateCert(ctx, owner.ID, cert.Certificate{Title: "the-title", OwnerID: owner.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	tx, err := s.CreateTx(ctx, owner.ID, c.ID, cert.Transaction{To: "invited@email.com"})
+	assert.Nil(t, err)
+
+	return c, tx
+}
+
+func TestInvitationClaimedOnSignUp(t *testing.T) {
+	s := NewMemStore()
+	c, tx := newInvitation(t, s)
+
+	assert.Len(t, tx.ClaimToken, 2*tokenBytes)
+	if assert.NotNil(t, tx.Invitation) {
+		assert.Nil(t, tx.Invitation.ClaimedAt)
+		assert.WithinDuration(t, tx.CreatedAt.Add(DefaultInvitationTTL), tx.Invitation.ExpiresAt, time.Second)
+	}
+
+	// claim tokens are never stored
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, txs[0].ClaimToken)
+	assert.Empty(t, txs[0].RecipientID)
+
+	invited := newTestUser(t, s, "invited@email.com")
+
+	txs, _, err = s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.NotNil(t, txs[0].Invitation.ClaimedAt)
+	assert.Equal(t, invited.ID, txs[0].RecipientID)
+
+	accepted, err := s.AcceptTx(ctx, invited.ID, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, invited.ID, accepted.OwnerID)
+
+	// the claim token was consumed when the invitation was claimed
+	_, err = s.ClaimInvitation(ctx, invited.ID, tx.ClaimToken)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClaimInvitationWithToken(t *testing.T) {
+	s := NewMemStore()
+	c, tx := newInvitation(t, s)
+
+	collector := newTestUser(t, s, "collector@email.com")
+
+	// owners cannot claim the invitations they send
+	_, err := s.ClaimInvitation(ctx, c.OwnerID, tx.ClaimToken)
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	_, err = s.ClaimInvitation(ctx, collector.ID, "not-a-token")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	claimed, err := s.ClaimInvitation(ctx, collector.ID, tx.ClaimToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "collector@email.com", claimed.To)
+	assert.Equal(t, collector.ID, claimed.RecipientID)
+	assert.NotNil(t, claimed.Invitation.ClaimedAt)
+
+	// tokens can be redeemed only once
+	_, err = s.ClaimInvitation(ctx, collector.ID, tx.ClaimToken)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// registering with the invited address no longer claims the transaction
+	invited := newTestUser(t, s, "invited@email.com")
+	_, err = s.AcceptTx(ctx, invited.ID, c.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	accepted, err := s.AcceptTx(ctx, collector.ID, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, collector.ID, accepted.OwnerID)
+}
+
+func TestInvitationExpires(t *testing.T) {
+	now := clock.NewFake(testTime)
+	s := NewMemStore(WithClock(now))
+	c, tx := newInvitation(t, s)
+
+	now.Advance(DefaultInvitationTTL + time.Second)
+
+	collector := newTestUser(t, s, "collector@email.com")
+
+	_, err := s.ClaimInvitation(ctx, collector.ID, tx.ClaimToken)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+	assert.Equal(t, tx.Invitation.ExpiresAt, *txs[0].ResolvedAt)
+
+	entries, err := s.GetLedger(ctx, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "transfer_expired", string(entries[len(entries)-1].Type))
+
+	// expired invitations do not block new transactions
+	_, err = s.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "collector@email.com"})
+	assert.Nil(t, err)
+}
+
+func TestInvitationExpiredOnSignUp(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := clock.NewFake(testTime)
+	s := NewMemStore(WithClock(now))
+	c, tx := newInvitation(t, s)
+
+	now.Advance(DefaultInvitationTTL + time.Second)
+
+	invited := newTestUser(t, s, "invited@email.com")
+	assert.Contains(t, buf.String(), "Could not claim transaction "+tx.ID+" of certificate "+c.ID+" for user "+invited.ID+": the invitation has expired")
+
+	txs, _, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+	assert.Empty(t, txs[0].RecipientID)
+}
+
+func TestInvitationExpiresOnNewTx(t *testing.T) {
+	now := clock.NewFake(testTime)
+	s := NewMemStore(WithClock(now), WithInvitationTTL(time.Hour))
+	c, _ := newInvitation(t, s)
+
+	_, err := s.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "someone@email.com"})
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	now.Advance(time.Hour + time.Second)
+
+	_, err = s.CreateTx(ctx, c.OwnerID, c.ID, cert.Transaction{To: "someone@email.com"})
+	assert.Nil(t, err)
+
+	_, total, err := s.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestFileStoreInvitationReload(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+	c, tx := newInvitation(t, s)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	collector := newTestUser(t, reloaded, "collector@email.com")
+
+	_, err = reloaded.ClaimInvitation(ctx, collector.ID, tx.ClaimToken)
+	assert.Nil(t, err)
+
+	reloaded, err = NewFileStore(path)
+	assert.Nil(t, err)
+
+	accepted, err := reloaded.AcceptTx(ctx, collector.ID, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, collector.ID, accepted.OwnerID)
+}
+
+func TestFileStorePersistsExpiredInvitation(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	now := clock.NewFake(testTime)
+	s, err := NewFileStore(path, WithClock(now))
+	assert.Nil(t, err)
+	c, tx := newInvitation(t, s)
+	collector := newTestUser(t, s, "collector@email.com")
+
+	now.Advance(DefaultInvitationTTL + time.Second)
+
+	_, err = s.ClaimInvitation(ctx, collector.ID, tx.ClaimToken)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	reloaded, err := NewFileStore(path, WithClock(now))
+	assert.Nil(t, err)
+
+	txs, _, err := reloaded.GetTxs(ctx, c.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Expired, txs[0].Status)
+}
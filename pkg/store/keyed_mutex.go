@@ -0,0 +1,49 @@
+package store
+
+import "sync"
+
+// keyedMutex hands out a separate mutex for every key, so that operations
+// on different keys can proceed in parallel while operations on the same
+// key are serialized. Its zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a mutex shared by all the callers currently interested in
+// the same key. refs counts them so that the lock can be dropped once it
+// is no longer used.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock acquires the mutex associated with key. It returns the function
+// that must be called to release it.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// migrate converts data loaded from a snapshot of the given version to
+// the current format. It must be called before the store is used.
+func (m *memStore) migrate(version int) error {
+	if version < 1 {
+		if err := m.migrateUserIDs(); err != nil {
+			return err
+		}
+	}
+
+	if version < 2 {
+		if err := m.normalizeEmails(); err != nil {
+			return err
+		}
+	}
+
+	if version < 3 {
+		m.assignDefaultRoles()
+	}
+
+	return nil
+}
+
+// migrateUserIDs converts data loaded from snapshots identifying users by
+// email address to data identifying them by ID. Users without an ID are
+// given one, while API tokens, certificate owners and transactions are
+// updated to reference user IDs. Certificates are signed again when the
+// store has a signer.
+//
+// Ledger entries are left unchanged since their hashes cover them: the
+// actors of the entries recorded before the migration are email addresses.
+// It must be called before the store is used.
+func (m *memStore) migrateUserIDs() error {
+	// users are migrated in a deterministic order so that stores using
+	// sequential IDs always give users the same ID
+	emails := make([]string, 0, len(m.Users))
+	for email := range m.Users {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	byEmail := make(map[string]string, len(m.Users))
+	migrated := make(map[string]users.User, len(m.Users))
+	for _, email := range emails {
+		u := m.Users[email]
+		if u.ID == "" {
+			u.ID = m.newID()
+		}
+		if u.Email == "" {
+			u.Email = email
+		}
+		byEmail[email] = u.ID
+		migrated[u.ID] = u
+	}
+	m.Users = migrated
+
+	for hash, email := range m.Tokens {
+		if id, ok := byEmail[email]; ok {
+			m.Tokens[hash] = id
+		} else {
+			delete(m.Tokens, hash)
+		}
+	}
+
+	for certID, txs := range m.Txs {
+		for i := range txs {
+			migrateTx(&txs[i], byEmail)
+		}
+		m.Txs[certID] = txs
+	}
+
+	for id, c := range m.Certs {
+		if ownerID, ok := byEmail[c.OwnerID]; ok {
+			c.OwnerID = ownerID
+		}
+		if c.Transfer != nil {
+			tx := *c.Transfer
+			migrateTx(&tx, byEmail)
+			c.Transfer = &tx
+		}
+		if err := m.sign(&c); err != nil {
+			return err
+		}
+		m.Certs[id] = c
+	}
+
+	return nil
+}
+
+// migrateTx replaces the email address of the sender of tx with its ID
+// and sets the ID of its recipient, unless the transaction invitation
+// was never claimed.
+func migrateTx(tx *cert.Transaction, byEmail map[string]string) {
+	if from, ok := byEmail[tx.From]; ok {
+		tx.From = from
+	}
+
+	if tx.RecipientID == "" && (tx.Invitation == nil || tx.Invitation.ClaimedAt != nil) {
+		tx.RecipientID = byEmail[tx.To]
+	}
+}
+
+// normalizeEmails puts the email addresses of users, transaction
+// recipients and invitations in canonical form. It fails if several users
+// share the same canonical address, since they cannot be told apart: the
+// conflicting accounts must be merged or changed by hand.
+//
+// Ledger entries are left unchanged since their hashes cover them.
+func (m *memStore) normalizeEmails() error {
+	// users are checked in a deterministic order so that conflicts are
+	// always reported the same way
+	userIDs := make([]string, 0, len(m.Users))
+	for id := range m.Users {
+		userIDs = append(userIDs, id)
+	}
+	sort.Strings(userIDs)
+
+	owners := make(map[string]string, len(m.Users))
+	for _, id := range userIDs {
+		u := m.Users[id]
+		u.Email = users.NormalizeEmail(u.Email)
+		if other, ok := owners[u.Email]; ok {
+			return fmt.Errorf("users %s and %s share the email address %s", other, id, u.Email)
+		}
+		owners[u.Email] = id
+		m.Users[id] = u
+	}
+
+	for certID, txs := range m.Txs {
+		for i := range txs {
+			txs[i].To = users.NormalizeEmail(txs[i].To)
+		}
+		m.Txs[certID] = txs
+	}
+
+	for id, c := range m.Certs {
+		if c.Transfer != nil {
+			tx := *c.Transfer
+			tx.To = users.NormalizeEmail(tx.To)
+			c.Transfer = &tx
+			m.Certs[id] = c
+		}
+	}
+
+	for hash, inv := range m.Invitations {
+		inv.Email = users.NormalizeEmail(inv.Email)
+		m.Invitations[hash] = inv
+	}
+
+	return nil
+}
+
+// assignDefaultRoles makes collectors of the users without a role. Admins
+// can then give them the role they need.
+func (m *memStore) assignDefaultRoles() {
+	for id, u := range m.Users {
+		if u.Role == "" {
+			u.Role = users.Collector
+			m.Users[id] = u
+		}
+	}
+}
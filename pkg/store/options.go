@@ -0,0 +1,84 @@
+package store
+
+import (
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/ids"
+	"github.com/Popcore/verisart/pkg/notify"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// Option configures the stores returned by NewMemStore and NewFileStore.
+type Option func(*memStore)
+
+// WithSigner makes the store sign certificates with s whenever they are
+// created, updated or change owner. Without a signer certificates are
+// not signed.
+func WithSigner(s cert.Signer) Option {
+	return func(m *memStore) {
+		m.signer = s
+	}
+}
+
+// WithClock makes the store read the current time from c, for instance
+// when setting creation times, timestamping ledger entries or deciding
+// whether transactions expired. By default the store uses the system
+// clock.
+func WithClock(c clock.Clock) Option {
+	return func(m *memStore) {
+		m.clock = c
+	}
+}
+
+// WithIDGenerator makes the store identify new certificates,
+// transactions and users with the IDs returned by g. By default IDs are
+// random UUIDs.
+func WithIDGenerator(g ids.Generator) Option {
+	return func(m *memStore) {
+		m.userStore.ids = g
+	}
+}
+
+// WithNotifier makes the store deliver the messages sent to users, such
+// as the verification tokens of email changes, with n. By default
+// messages are written to the log with their tokens redacted.
+func WithNotifier(n notify.Notifier) Option {
+	return func(m *memStore) {
+		m.notifier = n
+	}
+}
+
+// WithAdmins makes admins of the users with the given email addresses,
+// once they verify their address with the token sent to it when they
+// sign up or when they request a change to their current address. Admins
+// can then assign roles to other users.
+func WithAdmins(emails ...string) Option {
+	return func(m *memStore) {
+		m.userStore.admins = make(map[string]bool, len(emails))
+		for _, email := range emails {
+			m.userStore.admins[users.NormalizeEmail(email)] = true
+		}
+	}
+}
+
+// now returns the current time in UTC, read from the store clock or from
+// the system clock when none is configured.
+func (m *memStore) now() time.Time {
+	if m.clock == nil {
+		return time.Now().UTC()
+	}
+
+	return m.clock.Now().UTC()
+}
+
+// newID returns a new ID, from the store ID generator or a random UUID
+// when none is configured.
+func (s *userStore) newID() string {
+	if s.ids == nil {
+		return ids.UUID{}.NewID()
+	}
+
+	return s.ids.NewID()
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Popcore/verisart/pkg/organizations"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// CreateOrganization adds a new organization whose first member, the user
+// identified by userID, is granted every permission.
+func (m *memStore) CreateOrganization(ctx context.Context, userID, name string) (*organizations.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !m.userExists(userID) {
+		return nil, newError(ErrValidation, "organizations must be created by an existing user")
+	}
+
+	o := organizations.Organization{
+		ID:        m.newID(),
+		Name:      name,
+		CreatedAt: m.now(),
+		Members: []organizations.Member{
+			{UserID: userID, Permissions: append([]organizations.Permission{}, organizations.AllPermissions...)},
+		},
+	}
+	if err := o.Validate(); err != nil {
+		return nil, newError(ErrValidation, "%s", err.Error())
+	}
+
+	m.mu.Lock()
+	m.Orgs[o.ID] = o
+	m.mu.Unlock()
+
+	return &o, nil
+}
+
+// GetOrganization returns the organization identified by id.
+func (m *memStore) GetOrganization(ctx context.Context, id string) (*organizations.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	o, ok := m.getOrg(id)
+	if !ok {
+		return nil, newError(ErrNotFound, "organization not found")
+	}
+
+	return &o, nil
+}
+
+// ListOrganizations returns the organizations the user identified by
+// userID is a member of, ordered by name.
+func (m *memStore) ListOrganizations(ctx context.Context, userID string) ([]organizations.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	list := []organizations.Organization{}
+	for _, o := range m.Orgs {
+		if _, ok := o.Member(userID); ok {
+			list = append(list, o)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list, nil
+}
+
+// SetMember adds member to the organization identified by orgID, or
+// replaces their permissions, on behalf of the user identified by userID.
+func (m *memStore) SetMember(ctx context.Context, userID, orgID string, member organizations.Member) (*organizations.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := member.Validate(); err != nil {
+		return nil, newError(ErrValidation, "%s", err.Error())
+	}
+
+	if !m.userExists(member.UserID) {
+		return nil, newError(ErrValidation, "members must be existing users")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.Orgs[orgID]
+	if !ok {
+		return nil, newError(ErrNotFound, "organization not found")
+	}
+
+	if !o.Can(userID, organizations.Manage) {
+		return nil, newError(ErrForbidden, "only the members allowed to manage an organization can change its members")
+	}
+
+	// members are never modified in place since organizations returned
+	// by the store share them
+	members := make([]organizations.Member, 0, len(o.Members)+1)
+	added := false
+	for _, current := range o.Members {
+		if current.UserID == member.UserID {
+			current = member
+			added = true
+		}
+		members = append(members, current)
+	}
+	if !added {
+		members = append(members, member)
+	}
+
+	updated := o
+	updated.Members = members
+	if updated.Managers() == 0 {
+		return nil, newError(ErrConflict, "the last member allowed to manage an organization cannot lose the manage permission")
+	}
+
+	m.Orgs[orgID] = updated
+
+	return &updated, nil
+}
+
+// RemoveMember removes the user identified by memberID from the
+// organization identified by orgID on behalf of the user identified by
+// userID.
+func (m *memStore) RemoveMember(ctx context.Context, userID, orgID, memberID string) (*organizations.Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.Orgs[orgID]
+	if !ok {
+		return nil, newError(ErrNotFound, "organization not found")
+	}
+
+	if userID != memberID && !o.Can(userID, organizations.Manage) {
+		return nil, newError(ErrForbidden, "only the members allowed to manage an organization can remove other members")
+	}
+
+	if _, ok := o.Member(memberID); !ok {
+		return nil, newError(ErrNotFound, "member not found")
+	}
+
+	updated := withoutMember(o, memberID)
+	if updated.Managers() == 0 {
+		return nil, newError(ErrConflict, "the last member allowed to manage an organization cannot be removed")
+	}
+
+	m.Orgs[orgID] = updated
+
+	return &updated, nil
+}
+
+// withoutMember returns a copy of o without the member identified by
+// userID.
+func withoutMember(o organizations.Organization, userID string) organizations.Organization {
+	members := make([]organizations.Member, 0, len(o.Members))
+	for _, current := range o.Members {
+		if current.UserID != userID {
+			members = append(members, current)
+		}
+	}
+	o.Members = members
+
+	return o
+}
+
+// getOrg returns the organization identified by id, if any.
+func (m *memStore) getOrg(id string) (organizations.Organization, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.Orgs[id]
+
+	return o, ok
+}
+
+// actsFor returns true if the user identified by userID can act with
+// permission p on behalf of ownerID, the ID of the owner of a certificate
+// or of the recipient of a transaction. Users act for themselves and
+// for the organizations that granted them p.
+func (m *memStore) actsFor(userID, ownerID string, p organizations.Permission) bool {
+	if userID == ownerID {
+		return userID != ""
+	}
+
+	o, ok := m.getOrg(ownerID)
+
+	return ok && o.Can(userID, p)
+}
+
+// ownerExists returns true if ownerID identifies a user or an
+// organization. It must be called with the lock held.
+func (m *memStore) ownerExists(ownerID string) bool {
+	if _, ok := m.Orgs[ownerID]; ok {
+		return true
+	}
+
+	return m.userExists(ownerID)
+}
+
+// isLastManager returns true if the user identified by userID is the
+// only member allowed to manage one of the organizations. It must be
+// called with the lock held.
+func (m *memStore) isLastManager(userID string) bool {
+	for _, o := range m.Orgs {
+		if o.Can(userID, organizations.Manage) && o.Managers() == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dropMemberships removes the user identified by userID from every
+// organization. It must be called with the lock held.
+func (m *memStore) dropMemberships(userID string) {
+	for id, o := range m.Orgs {
+		if _, ok := o.Member(userID); ok {
+			m.Orgs[id] = withoutMember(o, userID)
+		}
+	}
+}
+
+// issuer returns the user identified by userID, who issues a certificate
+// owned by ownerID. Users issue the certificates they own, while the
+// certificates of an organization are issued by the members allowed to
+// edit them.
+func (m *memStore) issuer(userID, ownerID string) (users.User, error) {
+	o, ok := m.getOrg(ownerID)
+	if !ok {
+		owner, ok := m.getUser(ownerID)
+		if !ok {
+			return users.User{}, newError(ErrValidation, "The certificate must contain a valid user ID. The ID supplied did not match any user")
+		}
+		if owner.ID != userID {
+			return users.User{}, newError(ErrForbidden, "users can only issue the certificates they own")
+		}
+		return owner, nil
+	}
+
+	if !o.Can(userID, organizations.Edit) {
+		return users.User{}, newError(ErrForbidden, "only the members allowed to edit the certificates of an organization can issue certificates on its behalf")
+	}
+
+	issuer, ok := m.getUser(userID)
+	if !ok {
+		return users.User{}, newError(ErrValidation, "the certificate issuer must be an existing user")
+	}
+
+	return issuer, nil
+}
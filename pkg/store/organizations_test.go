@@ -0,0 +1,264 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/organizations"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// newTestOrg creates an organization managed by owner and adds the
+// members given with their permissions. It stops the test if the
+// organization cannot be set up.
+func newTestOrg(t *testing.T, s Storer, owner users.User, members map[string][]organizations.Permission) organizations.Organization {
+	o, err := s.CreateOrganization(ctx, owner.ID, "the gallery")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for userID, perms := range members {
+		o, err = s.SetMember(ctx, owner.ID, o.ID, organizations.Member{UserID: userID, Permissions: perms})
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+	}
+
+	return *o
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	s := NewMemStore()
+	owner := newTestUser(t, s, "owner@email.com")
+	staff := newTestUser(t, s, "staff@email.com")
+	stranger := newTestUser(t, s, "stranger@email.com")
+
+	o := newTestOrg(t, s, owner, map[string][]organizations.Permission{
+		staff.ID: {organizations.View},
+	})
+	assert.Equal(t, "the gallery", o.Name)
+	assert.Equal(t, []organizations.Member{
+		{UserID: owner.ID, Permissions: organizations.AllPermissions},
+		{UserID: staff.ID, Permissions: []organizations.Permission{organizations.View}},
+	}, o.Members)
+
+	view := []organizations.Permission{organizations.View}
+	tests := []struct {
+		name   string
+		userID string
+		orgID  string
+		m      organizations.Member
+		kind   error
+	}{
+		{"unknown organization", owner.ID, "i-dont-exist", organizations.Member{UserID: stranger.ID, Permissions: view}, ErrNotFound},
+		{"not a manager", staff.ID, o.ID, organizations.Member{UserID: stranger.ID, Permissions: view}, ErrForbidden},
+		{"not a member", stranger.ID, o.ID, organizations.Member{UserID: stranger.ID, Permissions: view}, ErrForbidden},
+		{"unknown user", owner.ID, o.ID, organizations.Member{UserID: "i-dont-exist", Permissions: view}, ErrValidation},
+		{"unknown permission", owner.ID, o.ID, organizations.Member{UserID: stranger.ID, Permissions: []organizations.Permission{"sell"}}, ErrValidation},
+		{"last manager", owner.ID, o.ID, organizations.Member{UserID: owner.ID, Permissions: view}, ErrConflict},
+	}
+
+	for _, test := range tests {
+		_, err := s.SetMember(ctx, test.userID, test.orgID, test.m)
+		assert.True(t, errors.Is(err, test.kind), test.name)
+	}
+
+	// permissions of existing members are replaced
+	updated, err := s.SetMember(ctx, owner.ID, o.ID, organizations.Member{UserID: staff.ID, Permissions: organizations.AllPermissions})
+	assert.Nil(t, err)
+	assert.Len(t, updated.Members, 2)
+	assert.True(t, updated.Can(staff.ID, organizations.Manage))
+
+	// organizations returned before the change are not modified
+	assert.False(t, o.Can(staff.ID, organizations.Manage))
+
+	list, err := s.ListOrganizations(ctx, staff.ID)
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+
+	list, err = s.ListOrganizations(ctx, stranger.ID)
+	assert.Nil(t, err)
+	assert.Len(t, list, 0)
+
+	// members leave and managers remove other members, as long as
+	// someone can still manage the organization
+	_, err = s.RemoveMember(ctx, stranger.ID, o.ID, staff.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	_, err = s.RemoveMember(ctx, owner.ID, o.ID, stranger.ID)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	updated, err = s.RemoveMember(ctx, owner.ID, o.ID, owner.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []organizations.Member{{UserID: staff.ID, Permissions: organizations.AllPermissions}}, updated.Members)
+
+	_, err = s.RemoveMember(ctx, staff.ID, o.ID, staff.ID)
+	assert.True(t, errors.Is(err, ErrConflict))
+}
+
+func TestOrganizationCertificates(t *testing.T) {
+	s := NewMemStore()
+	artist := assignRole(t, s, newTestUser(t, s, "artist@email.com"), users.Artist)
+	gallery := assignRole(t, s, newTestUser(t, s, "gallery@email.com"), users.Gallery, artist.ID)
+	editor := newTestUser(t, s, "editor@email.com")
+	viewer := newTestUser(t, s, "viewer@email.com")
+
+	o := newTestOrg(t, s, gallery, map[string][]organizations.Permission{
+		editor.ID: {organizations.View, organizations.Edit},
+		viewer.ID: {organizations.View},
+	})
+
+	// certificates of an organization are issued by the members allowed
+	// to edit them
+	_, err := s.CreateCert(ctx, artist.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: o.ID, ArtistID: artist.ID})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	_, err = s.CreateCert(ctx, viewer.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: o.ID, ArtistID: artist.ID})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	c, err := s.CreateCert(ctx, gallery.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: o.ID, ArtistID: artist.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, o.ID, c.OwnerID)
+	assert.Equal(t, &cert.Issuer{Role: "gallery", UserID: gallery.ID}, c.Issuer)
+
+	certs, err := s.GetCerts(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+
+	// members edit the certificates of the organization only if they
+	// were allowed to
+	title := "a-new-title"
+	_, err = s.UpdateCert(ctx, viewer.ID, c.ID, cert.Patch{Title: &title})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	updated, err := s.UpdateCert(ctx, editor.ID, c.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+	assert.Equal(t, title, updated.Title)
+
+	chain, err := s.GetLedger(ctx, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, editor.ID, chain[1].Actor)
+
+	// transfers need the transfer permission
+	_, err = s.CreateTx(ctx, editor.ID, c.ID, cert.Transaction{To: "viewer@email.com"})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	tx, err := s.CreateTx(ctx, gallery.ID, c.ID, cert.Transaction{To: "viewer@email.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, o.ID, tx.From)
+
+	_, err = s.CancelTx(ctx, editor.ID, c.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	_, err = s.CancelTx(ctx, gallery.ID, c.ID)
+	assert.Nil(t, err)
+
+	assert.True(t, errors.Is(s.DeleteCert(ctx, viewer.ID, c.ID), ErrForbidden))
+	assert.Nil(t, s.DeleteCert(ctx, editor.ID, c.ID))
+}
+
+func TestTransferToOrganization(t *testing.T) {
+	s := NewMemStore()
+	collector := newTestUser(t, s, "collector@email.com")
+	manager := newTestUser(t, s, "manager@email.com")
+	viewer := newTestUser(t, s, "viewer@email.com")
+
+	o := newTestOrg(t, s, manager, map[string][]organizations.Permission{
+		viewer.ID: {organizations.View},
+	})
+
+	c, err := s.CreateCert(ctx, collector.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: collector.ID})
+	assert.Nil(t, err)
+
+	_, err = s.CreateTx(ctx, collector.ID, c.ID, cert.Transaction{RecipientID: "i-dont-exist"})
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	tx, err := s.CreateTx(ctx, collector.ID, c.ID, cert.Transaction{RecipientID: o.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, o.ID, tx.RecipientID)
+	assert.Equal(t, "", tx.To)
+	assert.Nil(t, tx.Invitation)
+
+	// members allowed to transfer accept transfers on behalf of the
+	// organization
+	_, err = s.AcceptTx(ctx, viewer.ID, c.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	accepted, err := s.AcceptTx(ctx, manager.ID, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, o.ID, accepted.OwnerID)
+
+	// staff changes do not affect the ownership of the certificate
+	_, err = s.RemoveMember(ctx, manager.ID, o.ID, viewer.ID)
+	assert.Nil(t, err)
+
+	certs, err := s.GetCerts(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+
+	// certificates cannot be sent to the organization owning them
+	_, err = s.CreateTx(ctx, manager.ID, c.ID, cert.Transaction{RecipientID: o.ID})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestDeleteUserLeavesOrganizations(t *testing.T) {
+	s := NewMemStore()
+	manager := newTestUser(t, s, "manager@email.com")
+	staff := newTestUser(t, s, "staff@email.com")
+
+	o := newTestOrg(t, s, manager, map[string][]organizations.Permission{
+		staff.ID: {organizations.View},
+	})
+
+	err := s.DeleteUser(ctx, manager.ID, "")
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, "the last member allowed to manage an organization cannot be deleted", err.Error())
+
+	assert.Nil(t, s.DeleteUser(ctx, staff.ID, ""))
+
+	updated, err := s.GetOrganization(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []organizations.Member{{UserID: manager.ID, Permissions: organizations.AllPermissions}}, updated.Members)
+}
+
+func TestFileStoreOrganizations(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	manager := newTestUser(t, s, "manager@email.com")
+	staff := newTestUser(t, s, "staff@email.com")
+	o := newTestOrg(t, s, manager, map[string][]organizations.Permission{
+		staff.ID: {organizations.View, organizations.Edit},
+	})
+
+	c, err := s.CreateCert(ctx, staff.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: o.ID})
+	assert.Nil(t, err)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	got, err := reloaded.GetOrganization(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, o.Members, got.Members)
+
+	certs, err := reloaded.GetCerts(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, c.ID, certs[0].ID)
+
+	_, err = reloaded.RemoveMember(ctx, manager.ID, o.ID, staff.ID)
+	assert.Nil(t, err)
+
+	reloaded, err = NewFileStore(path)
+	assert.Nil(t, err)
+
+	got, err = reloaded.GetOrganization(ctx, o.ID)
+	assert.Nil(t, err)
+	assert.Len(t, got.Members, 1)
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/notify"
+	"github.com/Popcore/verisart/pkg/users"
+)
+
+// assignRole gives role to u. It stops the test if the role cannot be
+// assigned.
+func assignRole(t *testing.T, s Storer, u users.User, role users.Role, represents ...string) users.User {
+	updated, err := s.AssignRole(ctx, u.ID, users.RoleAssignment{Role: role, Represents: represents})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return *updated
+}
+
+// newTestAdmin adds a user with an admin address to s, whose notifier is
+// n, and confirms the verification token sent to the address. It stops
+// the test if the user does not become an admin.
+func newTestAdmin(t *testing.T, s Storer, n *notify.Memory, email string) users.User {
+	u := newTestUser(t, s, email)
+
+	admin, err := s.ConfirmEmailChange(ctx, u.ID, verificationToken(t, n, email))
+	if !assert.Nil(t, err) || !assert.Equal(t, users.Admin, admin.Role) {
+		t.FailNow()
+	}
+
+	return *admin
+}
+
+func TestNewUsersRoles(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithAdmins("Admin@email.com"), WithNotifier(n))
+
+	// users are collectors, and those signing up with an admin address
+	// become admins only once they prove they own it
+	joe := newTestUser(t, s, "joe@email.com")
+	assert.Equal(t, users.Collector, joe.Role)
+	assert.Len(t, n.Messages(), 0)
+
+	admin := newTestUser(t, s, "admin@email.com")
+	assert.Equal(t, users.Collector, admin.Role)
+
+	token := verificationToken(t, n, "admin@email.com")
+	_, err := s.ConfirmEmailChange(ctx, joe.ID, token)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	updated, err := s.ConfirmEmailChange(ctx, admin.ID, token)
+	assert.Nil(t, err)
+	assert.Equal(t, users.Admin, updated.Role)
+	assert.Equal(t, "admin@email.com", updated.Email)
+
+	// other users cannot ask to verify their current address
+	err = s.RequestEmailChange(ctx, joe.ID, "joe@email.com")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	err = s.RequestEmailChange(ctx, admin.ID, "admin@email.com")
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestAssignRole(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithAdmins("admin@email.com"), WithNotifier(n))
+	admin := newTestAdmin(t, s, n, "admin@email.com")
+	artist := newTestUser(t, s, "artist@email.com")
+	gallery := newTestUser(t, s, "gallery@email.com")
+
+	artist = assignRole(t, s, artist, users.Artist)
+	assert.Equal(t, users.Artist, artist.Role)
+
+	gallery = assignRole(t, s, gallery, users.Gallery, artist.ID)
+	assert.Equal(t, []string{artist.ID}, gallery.Represents)
+
+	tests := []struct {
+		name   string
+		userID string
+		a      users.RoleAssignment
+		kind   error
+	}{
+		{"unknown user", "i-dont-exist", users.RoleAssignment{Role: users.Artist}, ErrNotFound},
+		{"unknown role", artist.ID, users.RoleAssignment{Role: "curator"}, ErrValidation},
+		{"represents for artists", artist.ID, users.RoleAssignment{Role: users.Artist, Represents: []string{gallery.ID}}, ErrValidation},
+		{"represents a gallery", gallery.ID, users.RoleAssignment{Role: users.Gallery, Represents: []string{gallery.ID}}, ErrValidation},
+		{"represents an unknown user", gallery.ID, users.RoleAssignment{Role: users.Gallery, Represents: []string{"i-dont-exist"}}, ErrValidation},
+		{"last admin", admin.ID, users.RoleAssignment{Role: users.Collector}, ErrConflict},
+	}
+
+	for _, test := range tests {
+		_, err := s.AssignRole(ctx, test.userID, test.a)
+		assert.True(t, errors.Is(err, test.kind), test.name)
+	}
+
+	// admins can step down once there is another admin
+	assignRole(t, s, artist, users.Admin)
+	admin = assignRole(t, s, admin, users.Collector)
+	assert.Equal(t, users.Collector, admin.Role)
+
+	// the last admin cannot delete their account either
+	err := s.DeleteUser(ctx, artist.ID, "")
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, "the last admin cannot be deleted", err.Error())
+}
+
+func TestDeletedArtistsAreNoLongerRepresented(t *testing.T) {
+	s := NewMemStore()
+	artist := assignRole(t, s, newTestUser(t, s, "artist@email.com"), users.Artist)
+	other := assignRole(t, s, newTestUser(t, s, "other@email.com"), users.Artist)
+	gallery := assignRole(t, s, newTestUser(t, s, "gallery@email.com"), users.Gallery, artist.ID, other.ID)
+
+	assert.Nil(t, s.DeleteUser(ctx, artist.ID, ""))
+
+	got, err := s.GetUser(ctx, gallery.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{other.ID}, got.Represents)
+
+	// users returned before the deletion are not modified
+	assert.Equal(t, []string{artist.ID, other.ID}, gallery.Represents)
+}
+
+func TestCreateCertRecordsIssuer(t *testing.T) {
+	s := NewMemStore()
+	artist := assignRole(t, s, newTestUser(t, s, "artist@email.com"), users.Artist)
+	gallery := assignRole(t, s, newTestUser(t, s, "gallery@email.com"), users.Gallery, artist.ID)
+
+	c, err := s.CreateCert(ctx, gallery.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: gallery.ID, ArtistID: artist.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, artist.ID, c.ArtistID)
+	assert.Equal(t, &cert.Issuer{Role: "gallery", UserID: gallery.ID}, c.Issuer)
+
+	chain, err := s.GetLedger(ctx, c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, gallery.ID, chain[0].Actor)
+	assert.Equal(t, "gallery", chain[0].ActorRole)
+
+	// artists must be users with the artist role
+	_, err = s.CreateCert(ctx, gallery.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: gallery.ID, ArtistID: gallery.ID})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestAdminsModerateCertificates(t *testing.T) {
+	n := &notify.Memory{}
+	s := NewMemStore(WithAdmins("admin@email.com"), WithNotifier(n))
+	admin := newTestAdmin(t, s, n, "admin@email.com")
+	artist := assignRole(t, s, newTestUser(t, s, "artist@email.com"), users.Artist)
+
+	c, err := s.CreateCert(ctx, artist.ID, cert.Certificate{Title: "the-title", Year: 2018, OwnerID: artist.ID, ArtistID: artist.ID})
+	assert.Nil(t, err)
+
+	title := "a-moderated-title"
+	updated, err := s.UpdateCert(ctx, admin.ID, c.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+	assert.Equal(t, title, updated.Title)
+	assert.Equal(t, artist.ID, updated.OwnerID)
+
+	assert.Nil(t, s.DeleteCert(ctx, admin.ID, c.ID))
+
+	// the ledger records that the admin moderated the certificate
+	chain, err := s.GetLedger(ctx, c.ID)
+	assert.Nil(t, err)
+	assert.Len(t, chain, 3)
+	for _, e := range chain[1:] {
+		assert.Equal(t, admin.ID, e.Actor)
+		assert.Equal(t, "admin", e.ActorRole)
+	}
+	assert.Equal(t, ledger.Deleted, chain[2].Type)
+	assert.Nil(t, ledger.Verify(chain))
+}
+
+func TestFileStoreRoles(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	// users written before roles existed become collectors
+	data := `{
+		"version": 2,
+		"users": {
+			"user1": {"id": "user1", "email": "joe@email.com", "name": "joe blog"},
+			"user2": {"id": "user2", "email": "admin@email.com", "name": "miss smith"}
+		}
+	}`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	joe, err := s.GetUser(ctx, "user1")
+	assert.Nil(t, err)
+	assert.Equal(t, users.Collector, joe.Role)
+
+	// existing users listed as admins are promoted once they verify
+	// their address
+	n := &notify.Memory{}
+	s, err = NewFileStore(path, WithAdmins("admin@email.com"), WithNotifier(n))
+	assert.Nil(t, err)
+
+	admin, err := s.GetUser(ctx, "user2")
+	assert.Nil(t, err)
+	assert.Equal(t, users.Collector, admin.Role)
+
+	assert.Nil(t, s.RequestEmailChange(ctx, "user2", "admin@email.com"))
+	_, err = s.ConfirmEmailChange(ctx, "user2", verificationToken(t, n, "admin@email.com"))
+	assert.Nil(t, err)
+
+	assignRole(t, s, *joe, users.Artist)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	admin, err = reloaded.GetUser(ctx, "user2")
+	assert.Nil(t, err)
+	assert.Equal(t, users.Admin, admin.Role)
+
+	joe, err = reloaded.GetUser(ctx, "user1")
+	assert.Nil(t, err)
+	assert.Equal(t, users.Artist, joe.Role)
+}
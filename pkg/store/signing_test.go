@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+)
+
+// assertSigned checks that c carries a valid signature made with key.
+func assertSigned(t *testing.T, key *signing.Key, c *cert.Certificate) {
+	if !assert.NotNil(t, c.Signature) {
+		return
+	}
+
+	payload, err := c.SignedPayload()
+	assert.Nil(t, err)
+	assert.Nil(t, signing.Verify(key.PublicKey(), payload, *c.Signature))
+}
+
+func TestSignCerts(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s := NewMemStore(WithSigner(key))
+	owner1 := newTestUser(t, s, "owner1@email.com")
+	owner2 := newTestUser(t, s, "owner2@email.com")
+
+	created, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+	assertSigned(t, key, created)
+
+	title := "the-new-title"
+	updated, err := s.UpdateCert(ctx, owner1.ID, created.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+	assertSigned(t, key, updated)
+	assert.NotEqual(t, created.Signature.Value, updated.Signature.Value)
+
+	_, err = s.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+
+	// rejecting a transfer does not change the signed fields
+	rejected, err := s.RejectTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, updated.Signature, rejected.Signature)
+
+	_, err = s.CreateTx(ctx, owner1.ID, created.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+
+	accepted, err := s.AcceptTx(ctx, owner2.ID, created.ID)
+	assert.Nil(t, err)
+	assertSigned(t, key, accepted)
+	assert.NotEqual(t, updated.Signature.Value, accepted.Signature.Value)
+
+	// the signature of the previous owner certificate no longer matches
+	payload, err := accepted.SignedPayload()
+	assert.Nil(t, err)
+	assert.NotNil(t, signing.Verify(key.PublicKey(), payload, *updated.Signature))
+}
+
+func TestUnsignedCerts(t *testing.T) {
+	s := NewMemStore()
+	owner1 := newTestUser(t, s, "owner1@email.com")
+
+	created, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, created.Signature)
+}
@@ -1,101 +1,337 @@
 package store
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/satori/go.uuid"
-
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/merkle"
+	"github.com/Popcore/verisart/pkg/notify"
+	"github.com/Popcore/verisart/pkg/organizations"
+	"github.com/Popcore/verisart/pkg/transparency"
 	"github.com/Popcore/verisart/pkg/users"
 )
 
 // Storer is the interface that defines CRUD operations allowed
-// on certificates, transactions and users.
+// on certificates, transactions, users and organizations.
+//
+// Every operation takes the context of the request it serves first.
+// Operations return the context error, without changing the store, when
+// the context is done before they start. The user an operation acts on
+// behalf of is passed explicitly rather than read from the context.
 type Storer interface {
 	users.UserManager
+	organizations.Manager
 	cert.CertManager
 	cert.Transferer
+	ledger.Provider
+	transparency.Log
 }
 
 // MemStore is the in-memory concrete implementation of the storer interface.
-// Internally it holds three maps: one for storing certificates, one for storing a
-// list of transactions associated to certificates and a map for users.
+// Internally it holds four maps: one for storing certificates, one for storing a
+// list of transactions associated to certificates, a map for users and a map
+// for organizations.
+//
+// The store is safe for concurrent use. mu guards the maps themselves while
+// certLocks serializes the operations that read and then modify a single
+// certificate, so that operations on unrelated certificates do not wait
+// for each other.
 type memStore struct {
 	Certs map[string]cert.Certificate
 	Txs   map[string][]cert.Transaction
-	userStore
+	*userStore
+
+	// Orgs maps organization IDs to organizations. Certificates owned by
+	// an organization have its ID as owner.
+	Orgs map[string]organizations.Organization
+
+	// Ledger maps certificate IDs to the chain of events recording their
+	// history. Chains are never modified in place: appending an event
+	// replaces the chain.
+	Ledger map[string][]ledger.Entry
+
+	// Log lists the ledger entries stored in the leaves of the
+	// transparency log, in the order they were added. tree is the Merkle
+	// tree built over them.
+	Log  []transparency.LeafRef
+	tree merkle.Tree
+
+	mu        sync.RWMutex
+	certLocks keyedMutex
+
+	// Invitations maps the hashes of claim tokens to the transactions
+	// they can claim.
+	Invitations map[string]invitation
+
+	// EmailChanges maps the hashes of verification tokens to the email
+	// changes they confirm.
+	EmailChanges map[string]emailChange
+
+	// clock provides the current time. The system clock is used when it
+	// is nil.
+	clock clock.Clock
+
+	// signer signs certificates. It is nil when certificates are not signed.
+	signer cert.Signer
+
+	// invitationTTL is the time recipients who are not users have to
+	// claim a transaction.
+	invitationTTL time.Duration
+
+	// transferTTL is the time transactions created without an expiry
+	// stay pending. Transactions do not expire when it is 0.
+	transferTTL time.Duration
+
+	// emailChangeTTL is the time users have to confirm the change of
+	// their email address.
+	emailChangeTTL time.Duration
+
+	// notifier delivers the verification tokens of email changes.
+	notifier notify.Notifier
 }
 
-// NewMemStore returns a memStore instance.
-func NewMemStore() Storer {
-	return &memStore{
+// NewMemStore returns a memStore instance configured with opts.
+func NewMemStore(opts ...Option) Storer {
+	m := &memStore{
 		Certs:     make(map[string]cert.Certificate),
 		Txs:       make(map[string][]cert.Transaction),
 		userStore: newUserStore(),
+		Orgs:      make(map[string]organizations.Organization),
+		Ledger:    make(map[string][]ledger.Entry),
+
+		Invitations:   make(map[string]invitation),
+		invitationTTL: DefaultInvitationTTL,
+		transferTTL:   DefaultTransferTTL,
+
+		EmailChanges:   make(map[string]emailChange),
+		emailChangeTTL: DefaultEmailChangeTTL,
+		notifier:       notify.Log{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// sign sets the signature of c, if the store has a signer. It must be
+// called every time the signed fields of a certificate change.
+func (m *memStore) sign(c *cert.Certificate) error {
+	if m.signer == nil {
+		return nil
 	}
+
+	payload, err := c.SignedPayload()
+	if err != nil {
+		return err
+	}
+
+	sig, err := m.signer.Sign(payload)
+	if err != nil {
+		return fmt.Errorf("could not sign certificate: %s", err.Error())
+	}
+	c.Signature = &sig
+
+	return nil
+}
+
+// actor returns the ledger actor of the events caused by the user
+// identified by userID, recording their current role. Events caused by
+// the service itself have an empty userID.
+func (m *memStore) actor(userID string) ledger.Actor {
+	if userID == "" {
+		return ledger.Actor{}
+	}
+
+	u, _ := m.getUser(userID)
+
+	return ledger.Actor{ID: userID, Role: string(u.Role)}
+}
+
+// canModerate returns true if the user identified by userID can update
+// and delete certificates they do not own.
+func (m *memStore) canModerate(userID string) bool {
+	u, ok := m.getUser(userID)
+
+	return ok && u.Can(users.ModerateCertificates)
+}
+
+// getCert returns the certificate identified by id and the list of
+// its transactions.
+func (m *memStore) getCert(id string) (cert.Certificate, []cert.Transaction, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.Certs[id]
+
+	return c, m.Txs[id], ok
+}
+
+// getLedger returns the chain of events of the certificate identified by id.
+func (m *memStore) getLedger(id string) []ledger.Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.Ledger[id]
 }
 
-// Create adds a new certificate to the MemStore.
-func (m *memStore) CreateCert(c cert.Certificate) (*cert.Certificate, error) {
+// Create adds a new certificate to the MemStore on behalf of the user
+// identified by userID.
+func (m *memStore) CreateCert(ctx context.Context, userID string, c cert.Certificate) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// return error if the Certificate already includes and id since id are created by
 	// the applcation
 	if c.ID != "" {
-		return nil, errors.New("The certificate cannot contain an ID before it is created")
+		return nil, newError(ErrValidation, "The certificate cannot contain an ID before it is created")
+	}
+
+	// ensure the owner exists and find who issues the certificate
+	issuer, err := m.issuer(userID, c.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ArtistID != "" {
+		if artist, ok := m.getUser(c.ArtistID); !ok || artist.Role != users.Artist {
+			return nil, newError(ErrValidation, "The certificate artist must be an existing artist")
+		}
 	}
 
-	// ensure user exists
-	if _, ok := m.Users[c.OwnerID]; !ok {
-		return nil, errors.New("The certificate must contain a valid user ID (aka email address). The email supplied did not match any user")
+	c.ID = m.newID()
+	c.CreatedAt = m.now()
+	c.Issuer = &cert.Issuer{
+		Role:   string(issuer.Role),
+		UserID: issuer.ID,
+	}
+
+	if err := m.sign(&c); err != nil {
+		return nil, err
+	}
+
+	chain, err := ledger.Append(nil, c.ID, ledger.Created, m.actor(issuer.ID), c.CreatedAt, c)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the owner may have been deleted since it was checked
+	if !m.ownerExists(c.OwnerID) {
+		return nil, newError(ErrValidation, "The certificate must contain a valid user ID. The ID supplied did not match any user")
 	}
 
-	c.ID = uuid.NewV4().String()
-	c.CreatedAt = time.Now().UTC()
 	m.Certs[c.ID] = c
+	m.appendLedger(c.ID, chain)
 
 	return &c, nil
 }
 
 // Update modifies an existing certificate in the MemStore
-func (m *memStore) UpdateCert(id string, c cert.Certificate) (*cert.Certificate, error) {
+func (m *memStore) UpdateCert(ctx context.Context, userID, id string, p cert.Patch) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := m.certLocks.Lock(id)
+	defer unlock()
 
-	toUpdate, ok := m.Certs[id]
+	toUpdate, _, ok := m.getCert(id)
 	if !ok {
-		return nil, errors.New("Certificate not found")
+		return nil, newError(ErrNotFound, "Certificate not found")
 	}
 
-	// reject changes to ownership or transactions
-	if (c.OwnerID != "" && c.OwnerID != toUpdate.OwnerID) || c.Transfer != toUpdate.Transfer {
-		return nil, errors.New("ownership can only be changed with a transfer")
+	if !m.actsFor(userID, toUpdate.OwnerID, organizations.Edit) && !m.canModerate(userID) {
+		return nil, newError(ErrForbidden, "only the certificate owner can update a certificate")
 	}
 
 	// updatable fields are title, year and notes.
-	// Id and createdAt should not be updated as are generated as internal metadata
-	toUpdate.Title = c.Title
-	toUpdate.Year = c.Year
-	toUpdate.Note = c.Note
+	// Id, createdAt, ownership and transactions cannot be part of a patch
+	toUpdate = p.Apply(toUpdate)
+
+	if err := m.sign(&toUpdate); err != nil {
+		return nil, err
+	}
 
+	chain, err := ledger.Append(m.getLedger(id), id, ledger.Updated, m.actor(userID), m.now(), toUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
 	m.Certs[id] = toUpdate
+	m.appendLedger(id, chain)
+	m.mu.Unlock()
 
 	return &toUpdate, nil
 }
 
 // Delete modifies an existing certificate in the MemStore.
-func (m *memStore) DeleteCert(id string) error {
+func (m *memStore) DeleteCert(ctx context.Context, userID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	if _, ok := m.Certs[id]; !ok {
-		return errors.New("Certificate not found")
+	unlock := m.certLocks.Lock(id)
+	defer unlock()
+
+	toDelete, _, ok := m.getCert(id)
+	if !ok {
+		return newError(ErrNotFound, "Certificate not found")
+	}
+
+	if !m.actsFor(userID, toDelete.OwnerID, organizations.Edit) && !m.canModerate(userID) {
+		return newError(ErrForbidden, "only the certificate owner can delete a certificate")
+	}
+
+	// the ledger of deleted certificates is kept as evidence of their
+	// history
+	chain, err := ledger.Append(m.getLedger(id), id, ledger.Deleted, m.actor(userID), m.now(), toDelete)
+	if err != nil {
+		return err
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	delete(m.Certs, id)
+	m.appendLedger(id, chain)
 
 	return nil
 }
 
-// Delete modifies an existing certificate in the MemStore.
-func (m *memStore) GetCerts(ownerID string) ([]cert.Certificate, error) {
+// GetCert returns the certificate identified by id.
+func (m *memStore) GetCert(ctx context.Context, id string) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c, _, ok := m.getCert(id)
+	if !ok {
+		return nil, newError(ErrNotFound, "certificate not found. Please use a valid ID")
+	}
+
+	return &c, nil
+}
+
+// GetCerts returns the certificates belonging to a user or an organization.
+func (m *memStore) GetCerts(ctx context.Context, ownerID string) ([]cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	certs := []cert.Certificate{}
 
 	for _, v := range m.Certs {
@@ -111,35 +347,143 @@ func (m *memStore) GetCerts(ownerID string) ([]cert.Certificate, error) {
 // to the list of the existing transaction associated to a certificate
 // and updates the corresponding certificate information.
 // It returns an error in case of failure.
-func (m *memStore) CreateTx(certID string, tx cert.Transaction) (*cert.Transaction, error) {
+func (m *memStore) CreateTx(ctx context.Context, userID, certID string, tx cert.Transaction) (*cert.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := m.certLocks.Lock(certID)
+	defer unlock()
 
 	// ensure certificate exists before updating transactions
 	// this will stop the transaction slice from growing indefinitely
 	// if a certificate is deleted
-	selectedCert, ok := m.Certs[certID]
+	selectedCert, txs, ok := m.getCert(certID)
 	if !ok {
-		return nil, errors.New("certificate not found. Please use a valid ID")
+		return nil, newError(ErrNotFound, "certificate not found. Please use a valid ID")
+	}
+
+	if !m.actsFor(userID, selectedCert.OwnerID, organizations.Transfer) {
+		return nil, newError(ErrForbidden, "only the certificate owner can transfer a certificate")
 	}
 
-	// ensure the transaction recipient exists
-	if _, ok := m.Users[tx.To]; !ok {
-		return nil, errors.New("invalid transaction recipient. The email address did not match any known user")
+	// expired transactions no longer block new ones, even if they were
+	// not swept yet
+	if len(txs) > 0 && txExpired(txs[0], m.now()) {
+		var err error
+		selectedCert, txs, err = m.expireTx(selectedCert, txs)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// update certificate transfer status and add transaction to the list
 	// of existing ones and
-	if canCreateTransaction(m.Txs[certID]) {
+	if canCreateTransaction(txs) {
+		tx.ID = m.newID()
+		tx.From = selectedCert.OwnerID
 		tx.Status = cert.Pending
+		tx.CreatedAt = m.now()
+		tx.ResolvedAt = nil
+		tx.Invitation = nil
+		tx.ClaimToken = ""
+
+		if tx.ExpiresAt != nil && !tx.ExpiresAt.After(tx.CreatedAt) {
+			return nil, newError(ErrValidation, "the transaction expiry must be in the future")
+		}
+		if tx.ExpiresAt == nil && m.transferTTL > 0 {
+			expiresAt := tx.CreatedAt.Add(m.transferTTL)
+			tx.ExpiresAt = &expiresAt
+		}
+
+		// transactions are sent to an organization or to an email
+		// address. Recipients who are not users are sent an invitation
+		// they can claim with a single-use token
+		tx.To = users.NormalizeEmail(tx.To)
+		token := ""
+		if tx.To == "" {
+			if _, ok := m.getOrg(tx.RecipientID); !ok {
+				return nil, newError(ErrValidation, "the transaction recipient must be an email address or an existing organization")
+			}
+			if tx.RecipientID == selectedCert.OwnerID {
+				return nil, newError(ErrValidation, "the certificate already belongs to the organization")
+			}
+		} else if recipient, ok := m.userByEmail(tx.To); ok {
+			tx.RecipientID = recipient.ID
+		} else {
+			tx.RecipientID = ""
+			var err error
+			token, err = newToken()
+			if err != nil {
+				return nil, err
+			}
+			tx.Invitation = &cert.Invitation{ExpiresAt: tx.CreatedAt.Add(m.invitationTTL)}
+		}
 
 		selectedCert.Transfer = &tx
 
+		chain, err := ledger.Append(m.getLedger(certID), certID, ledger.TransferCreated, m.actor(userID), tx.CreatedAt, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
 		m.Certs[certID] = selectedCert
-		m.Txs[certID] = append([]cert.Transaction{tx}, m.Txs[certID]...)
+		m.Txs[certID] = append([]cert.Transaction{tx}, txs...)
+		m.appendLedger(certID, chain)
+		if token != "" {
+			m.Invitations[hashToken(token)] = invitation{
+				CertID:    certID,
+				TxID:      tx.ID,
+				Email:     tx.To,
+				ExpiresAt: tx.Invitation.ExpiresAt,
+			}
+		}
+		m.mu.Unlock()
+
+		created := tx
+		created.ClaimToken = token
 
-		return &tx, nil
+		return &created, nil
 	}
 
-	return nil, fmt.Errorf("A pending transaction for certificate %s already exist", certID)
+	return nil, newError(ErrConflict, "A pending transaction for certificate %s already exist", certID)
+}
+
+// GetTxs returns a page of the transactions of a certificate, oldest first.
+func (m *memStore) GetTxs(ctx context.Context, certID string, offset, limit int) ([]cert.Transaction, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	_, txs, ok := m.getCert(certID)
+	if !ok {
+		return nil, 0, newError(ErrNotFound, "certificate not found. Please use a valid ID")
+	}
+
+	// transactions are stored newest first
+	page := []cert.Transaction{}
+	for i := len(txs) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, txs[i])
+	}
+
+	return page, len(txs), nil
+}
+
+// actions maps the statuses a pending transaction can be moved to to the
+// name of the action performing the change.
+var actions = map[cert.TransferStatus]string{
+	cert.Accepted:  "accept",
+	cert.Rejected:  "reject",
+	cert.Cancelled: "cancel",
+}
+
+// events maps the statuses a pending transaction can be moved to to the
+// ledger events recording the change.
+var events = map[cert.TransferStatus]ledger.EventType{
+	cert.Accepted:  ledger.TransferAccepted,
+	cert.Rejected:  ledger.TransferRejected,
+	cert.Cancelled: ledger.TransferCancelled,
 }
 
 // canCreateTransaction returns true if txs is empty or if the most
@@ -155,25 +499,99 @@ func canCreateTransaction(txs []cert.Transaction) bool {
 // AcceptTx sets a transaction status to "accepted" and updates the
 // corresponding certificate information. It returns an error in case
 // of failure.
-func (m *memStore) AcceptTx(certID string) (*cert.Certificate, error) {
+func (m *memStore) AcceptTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.resolveTx(userID, certID, cert.Accepted)
+}
+
+// RejectTx sets a transaction status to "rejected" and updates the
+// corresponding certificate information. It returns an error in case
+// of failure.
+func (m *memStore) RejectTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.resolveTx(userID, certID, cert.Rejected)
+}
+
+// CancelTx sets a transaction status to "cancelled" and updates the
+// corresponding certificate information. It returns an error in case
+// of failure.
+func (m *memStore) CancelTx(ctx context.Context, userID, certID string) (*cert.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.resolveTx(userID, certID, cert.Cancelled)
+}
+
+// resolveTx sets the status of the pending transaction of a certificate.
+// The certificate ownership moves to the transaction recipient only when
+// the transaction is accepted.
+// Transactions can be cancelled by the certificate owner only, while only
+// their recipient can accept or reject them. Members allowed to transfer
+// the certificates of an organization act for it.
+func (m *memStore) resolveTx(userID, certID string, status cert.TransferStatus) (*cert.Certificate, error) {
+	unlock := m.certLocks.Lock(certID)
+	defer unlock()
+
 	// ensure certificate exists
-	selectedCert, ok := m.Certs[certID]
+	selectedCert, txs, ok := m.getCert(certID)
 	if !ok {
-		return nil, errors.New("certificate not found. Please use a valid ID")
+		return nil, newError(ErrNotFound, "certificate not found. Please use a valid ID")
 	}
 
-	lastTx, err := getLastPendingTx(m.Txs[certID])
+	lastTx, err := getLastPendingTx(txs)
 	if err != nil {
 		return nil, err
 	}
 
-	lastTx.Status = cert.Accepted
-	selectedCert.Transfer = lastTx
-	selectedCert.OwnerID = lastTx.To
+	if status == cert.Cancelled && !m.actsFor(userID, selectedCert.OwnerID, organizations.Transfer) {
+		return nil, newError(ErrForbidden, "only the certificate owner can cancel a transaction")
+	}
+
+	if status != cert.Cancelled && !m.actsFor(userID, lastTx.RecipientID, organizations.Transfer) {
+		return nil, newError(ErrForbidden, "only the transaction recipient can %s a transaction", actions[status])
+	}
+
+	// overdue transactions are expired only once the user is known to be
+	// involved in them
+	if txExpired(*lastTx, m.now()) {
+		if _, _, err := m.expireTx(selectedCert, txs); err != nil {
+			return nil, err
+		}
+		// cancelling an expired transaction has nothing left to do
+		if status == cert.Cancelled {
+			c, _, _ := m.getCert(certID)
+			return &c, nil
+		}
+		return nil, newError(ErrConflict, "the transaction has expired")
+	}
+
+	if status != cert.Cancelled && awaitingClaim(*lastTx) {
+		return nil, newError(ErrConflict, "the transaction invitation has not been claimed yet")
+	}
+
+	resolvedAt := m.now()
+	lastTx.Status = status
+	lastTx.ResolvedAt = &resolvedAt
 
 	//"we must also set the new user id now"
-	m.Certs[certID] = selectedCert
-	m.Txs[certID][0] = *lastTx
+	if status == cert.Accepted {
+		selectedCert.OwnerID = lastTx.RecipientID
+
+		if err := m.sign(&selectedCert); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.saveLastTx(&selectedCert, txs, *lastTx, events[status], m.actor(userID), resolvedAt); err != nil {
+		return nil, err
+	}
 
 	return &selectedCert, nil
 }
@@ -182,13 +600,28 @@ func (m *memStore) AcceptTx(certID string) (*cert.Certificate, error) {
 // is not pending
 func getLastPendingTx(txs []cert.Transaction) (*cert.Transaction, error) {
 	if len(txs) == 0 {
-		return nil, errors.New("no transactions found")
+		return nil, newError(ErrConflict, "no transactions found")
 	}
 
 	lastTx := txs[0]
 	if lastTx.Status != cert.Pending {
-		return nil, errors.New("no pending transactions found")
+		return nil, newError(ErrConflict, "no pending transactions found")
 	}
 
 	return &lastTx, nil
 }
+
+// GetLedger returns the chain of events recording the history of a
+// certificate, including certificates that were deleted.
+func (m *memStore) GetLedger(ctx context.Context, certID string) ([]ledger.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	chain := m.getLedger(certID)
+	if len(chain) == 0 {
+		return nil, newError(ErrNotFound, "certificate not found. Please use a valid ID")
+	}
+
+	return chain, nil
+}
@@ -1,51 +1,72 @@
 package store
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/clock"
+	"github.com/Popcore/verisart/pkg/ids"
+	"github.com/Popcore/verisart/pkg/ledger"
 	"github.com/Popcore/verisart/pkg/users"
 )
 
+// ctx is the context of the store operations of the tests.
+var ctx = context.Background()
+
+// testTime is the time of the fake clocks used by the tests.
+var testTime = time.Date(2018, 11, 21, 12, 0, 0, 0, time.UTC)
+
 func TestCreateNewCert(t *testing.T) {
 	mc := memStore{
+		Ledger:    map[string][]ledger.Entry{},
 		Certs:     map[string]cert.Certificate{},
 		userStore: newUserStore(),
+		clock:     clock.NewFake(testTime),
 	}
+	mc.ids = &ids.Sequence{}
 
-	mc.Users["owner@email.com"] = users.User{
+	mc.Users["the-user-id"] = users.User{
 		ID:    "the-user-id",
 		Email: "owner@email.com",
 		Name:  "foo bar",
+		Role:  users.Artist,
 	}
 
 	mockCert := cert.Certificate{
 		Title:   "the-title",
-		OwnerID: "owner@email.com",
+		OwnerID: "the-user-id",
 		Year:    2018,
 		Note:    "some-notes",
 	}
 
-	got, err := mc.CreateCert(mockCert)
+	got, err := mc.CreateCert(ctx, "the-user-id", mockCert)
 	assert.Nil(t, err)
-
-	// sanity check
-	assert.NotNil(t, got.ID)
-	assert.Equal(t, got.Title, "the-title")
-	assert.NotNil(t, got.CreatedAt)
-	assert.Equal(t, got.OwnerID, "owner@email.com")
-	assert.Equal(t, got.Year, 2018)
-	assert.Equal(t, got.Note, "some-notes")
-	assert.Nil(t, got.Transfer)
+	assert.Equal(t, &cert.Certificate{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Title:     "the-title",
+		CreatedAt: testTime,
+		OwnerID:   "the-user-id",
+		Year:      2018,
+		Note:      "some-notes",
+		Issuer:    &cert.Issuer{Role: "artist", UserID: "the-user-id"},
+	}, got)
 
 	// attempting to create the same certificate - or a certificate
 	// with an id - should return an error
-	_, err = mc.CreateCert(*got)
+	_, err = mc.CreateCert(ctx, "the-user-id", *got)
 	assert.NotNil(t, err)
 	assert.Len(t, mc.Certs, 1)
+
+	// users only issue the certificates they own
+	_, err = mc.CreateCert(ctx, "another-user-id", mockCert)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.Len(t, mc.Certs, 1)
 }
 
 func TestUpdateCert(t *testing.T) {
@@ -59,42 +80,46 @@ func TestUpdateCert(t *testing.T) {
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			"the-id": mockCert,
 		},
 	}
 
-	toUpdate := cert.Certificate{
-		Title: "the-new-title",
-		Note:  "some-new-notes",
-	}
+	toUpdate := cert.Patch{}
+	err := json.Unmarshal([]byte(`{"title": "the-new-title", "note": "some-new-notes"}`), &toUpdate)
+	assert.Nil(t, err)
 
-	got, err := mc.UpdateCert("the-id", toUpdate)
+	got, err := mc.UpdateCert(ctx, "the-owner-id", "the-id", toUpdate)
 	assert.Nil(t, err)
 	assert.Equal(t, got.Title, "the-new-title")
 	assert.Equal(t, got.Note, "some-new-notes")
 
+	// fields missing from the patch are unchanged
+	assert.Equal(t, got.Year, 2018)
+	assert.Equal(t, got.OwnerID, "the-owner-id")
+	assert.Equal(t, *got, mc.Certs["the-id"])
+
+	// fields set to null are removed
+	clearNote := cert.Patch{}
+	err = json.Unmarshal([]byte(`{"note": null}`), &clearNote)
+	assert.Nil(t, err)
+
+	got, err = mc.UpdateCert(ctx, "the-owner-id", "the-id", clearNote)
+	assert.Nil(t, err)
+	assert.Equal(t, got.Title, "the-new-title")
+	assert.Equal(t, got.Note, "")
+
 	// attempting to update a non existing certificate should return an error
-	got, err = mc.UpdateCert("i-dont-exists", mockCert)
+	got, err = mc.UpdateCert(ctx, "the-owner-id", "i-dont-exists", toUpdate)
 	assert.Nil(t, got)
-	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
 
-	// attempting to change ownership should return an error
-	got, err = mc.UpdateCert("the-id", cert.Certificate{
-		OwnerID: "new-owner",
-	})
-	assert.NotNil(t, err)
-	assert.Equal(t, "ownership can only be changed with a transfer", err.Error())
-
-	// attempting to update the transaction should return an error
-	got, err = mc.UpdateCert("the-id", cert.Certificate{
-		Transfer: &cert.Transaction{
-			To:     "another-user@email.com",
-			Status: cert.Accepted,
-		},
-	})
-	assert.NotNil(t, err)
-	assert.Equal(t, "ownership can only be changed with a transfer", err.Error())
+	// only the owner can update a certificate
+	got, err = mc.UpdateCert(ctx, "another-user", "the-id", toUpdate)
+	assert.Nil(t, got)
+	assert.True(t, errors.Is(err, ErrForbidden))
 }
 
 func TestDeleteCert(t *testing.T) {
@@ -108,17 +133,24 @@ func TestDeleteCert(t *testing.T) {
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			"the-id": mockCert,
 		},
 	}
 
-	err := mc.DeleteCert(mockCert.ID)
+	// only the owner can delete a certificate
+	err := mc.DeleteCert(ctx, "another-user", mockCert.ID)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.Len(t, mc.Certs, 1)
+
+	err = mc.DeleteCert(ctx, "the-owner-id", mockCert.ID)
 	assert.Nil(t, err)
 	assert.Len(t, mc.Certs, 0)
 
 	// attempting to delete a non existing certificate should return an error
-	err = mc.DeleteCert("i-dont-exists")
+	err = mc.DeleteCert(ctx, "the-owner-id", "i-dont-exists")
 	assert.NotNil(t, err)
 }
 
@@ -151,6 +183,8 @@ func TestGetCert(t *testing.T) {
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			"id1": mockCert1,
 			"id2": mockCert2,
@@ -158,47 +192,67 @@ func TestGetCert(t *testing.T) {
 		},
 	}
 
-	certs, err := mc.GetCerts("owner-id1")
+	certs, err := mc.GetCerts(ctx, "owner-id1")
 	assert.Nil(t, err)
 	assert.Len(t, certs, 2)
+
+	got, err := mc.GetCert(ctx, "id3")
+	assert.Nil(t, err)
+	assert.Equal(t, mockCert3, *got)
+
+	got, err = mc.GetCert(ctx, "i-dont-exist")
+	assert.Nil(t, got)
+	assert.True(t, errors.Is(err, ErrNotFound))
 }
 
 func TestCreateTxOK(t *testing.T) {
-	mockCert := cert.Certificate{
-		ID:      "key1",
-		Title:   "the-title",
-		OwnerID: "owner1@email.com",
-		Year:    2018,
-		Note:    "some-notes",
-	}
-
 	mc := memStore{
-		Certs: map[string]cert.Certificate{
-			"key1": mockCert,
-		},
+		Ledger:    map[string][]ledger.Entry{},
+		Certs:     map[string]cert.Certificate{},
 		Txs:       map[string][]cert.Transaction{},
 		userStore: newUserStore(),
+		clock:     clock.NewFake(testTime),
 	}
+	mc.ids = &ids.Sequence{}
 
-	mc.NewUser("owner1@email.com", "joe blog")
-	mc.NewUser("owner2@email.com", "miss smith")
+	owner1, _ := mc.NewUser(ctx, "owner1@email.com", "joe blog")
+	owner2, _ := mc.NewUser(ctx, "owner2@email.com", "miss smith")
+
+	mc.Certs["key1"] = cert.Certificate{
+		ID:      "key1",
+		Title:   "the-title",
+		OwnerID: owner1.ID,
+		Year:    2018,
+		Note:    "some-notes",
+	}
 
 	tx := cert.Transaction{
 		To: "owner2@email.com",
 	}
 
-	_, err := mc.CreateTx("i-dond-exist", tx)
+	_, err := mc.CreateTx(ctx, owner1.ID, "i-dond-exist", tx)
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), "certificate not found. Please use a valid ID")
+	assert.True(t, errors.Is(err, ErrNotFound))
 
-	got, err := mc.CreateTx("key1", tx)
-	expected := &cert.Transaction{
-		To:     "owner2@email.com",
-		Status: cert.Pending,
-	}
+	// only the owner can transfer a certificate
+	_, err = mc.CreateTx(ctx, owner2.ID, "key1", tx)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.Len(t, mc.Txs["key1"], 0)
 
+	got, err := mc.CreateTx(ctx, owner1.ID, "key1", tx)
 	assert.Nil(t, err)
-	assert.Equal(t, expected, got)
+
+	// the first two IDs of the sequence identify the users
+	assert.Equal(t, &cert.Transaction{
+		ID:          "00000000-0000-0000-0000-000000000003",
+		From:        "00000000-0000-0000-0000-000000000001",
+		To:          "owner2@email.com",
+		Status:      cert.Pending,
+		CreatedAt:   testTime,
+		RecipientID: "00000000-0000-0000-0000-000000000002",
+	}, got)
+
 	assert.Len(t, mc.Txs["key1"], 1)
 	assert.Equal(t, mc.Certs["key1"].Transfer, &mc.Txs["key1"][0])
 }
@@ -207,7 +261,7 @@ func TestCreateTxErrorNoPendingTx(t *testing.T) {
 	mockCert := cert.Certificate{
 		ID:      "key1",
 		Title:   "the-title",
-		OwnerID: "owner1@email.com",
+		OwnerID: "the-owner-id",
 		Year:    2018,
 		Note:    "some-notes",
 		Transfer: &cert.Transaction{
@@ -217,6 +271,7 @@ func TestCreateTxErrorNoPendingTx(t *testing.T) {
 	}
 
 	mc := memStore{
+		Ledger: map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			"key1": mockCert,
 		},
@@ -231,17 +286,18 @@ func TestCreateTxErrorNoPendingTx(t *testing.T) {
 		userStore: newUserStore(),
 	}
 
-	mc.NewUser("owner1@email.com", "joe blog")
-	mc.NewUser("owner2@email.com", "miss smith")
-	mc.NewUser("owner3@email.com", "luke")
+	mc.NewUser(ctx, "owner1@email.com", "joe blog")
+	mc.NewUser(ctx, "owner2@email.com", "miss smith")
+	mc.NewUser(ctx, "owner3@email.com", "luke")
 
 	tx := cert.Transaction{
 		To: "owner3@email.com",
 	}
 
-	_, err := mc.CreateTx("key1", tx)
+	_, err := mc.CreateTx(ctx, "the-owner-id", "key1", tx)
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), "A pending transaction for certificate key1 already exist")
+	assert.True(t, errors.Is(err, ErrConflict))
 
 	// ensure old values are unchanged
 	assert.Equal(t, mc.Certs["key1"].Transfer.Status, cert.Pending)
@@ -259,36 +315,46 @@ func TestAcceptTx(t *testing.T) {
 		Year:    2018,
 		Note:    "some-notes",
 		Transfer: &cert.Transaction{
-			To:     "another-user@email.com",
-			Status: cert.Pending,
+			To:          "another-user@email.com",
+			RecipientID: "another-user-id",
+			Status:      cert.Pending,
 		},
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			certKey: mockCert,
 		},
 		Txs: map[string][]cert.Transaction{
 			certKey: []cert.Transaction{
 				{
-					To:     "another-user@email.com",
-					Status: cert.Pending,
+					To:          "another-user@email.com",
+					RecipientID: "another-user-id",
+					Status:      cert.Pending,
 				},
 			},
 		},
 	}
 
-	_, err := mc.AcceptTx("i-don't-exist")
+	_, err := mc.AcceptTx(ctx, "another-user-id", "i-don't-exist")
 	assert.NotNil(t, err)
 	assert.Equal(t, "certificate not found. Please use a valid ID", err.Error())
 
-	got, err := mc.AcceptTx(certKey)
+	// only the recipient can accept a transaction
+	_, err = mc.AcceptTx(ctx, "the-owner-id", certKey)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.Equal(t, "the-owner-id", mc.Certs[certKey].OwnerID)
+
+	got, err := mc.AcceptTx(ctx, "another-user-id", certKey)
 	assert.Nil(t, err)
 	assert.Equal(t, *got, mc.Certs[certKey])
 	assert.Equal(t, string(cert.Accepted), string(mc.Txs[certKey][0].Status))
 	assert.Equal(t, string(cert.Accepted), string(mc.Certs[certKey].Transfer.Status))
+	assert.NotNil(t, mc.Txs[certKey][0].ResolvedAt)
 
-	assert.Equal(t, "another-user@email.com", mc.Certs[certKey].OwnerID)
+	assert.Equal(t, "another-user-id", mc.Certs[certKey].OwnerID)
 }
 
 func TestAcceptTxErrorEmptyTx(t *testing.T) {
@@ -303,13 +369,15 @@ func TestAcceptTxErrorEmptyTx(t *testing.T) {
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			certKey: mockCert,
 		},
 		Txs: map[string][]cert.Transaction{},
 	}
 
-	_, err := mc.AcceptTx(certKey)
+	_, err := mc.AcceptTx(ctx, "another-user-id", certKey)
 	assert.NotNil(t, err)
 	assert.Equal(t, "no transactions found", err.Error())
 }
@@ -323,26 +391,161 @@ func TestAcceptTxErrorNoPendingTx(t *testing.T) {
 		Year:    2018,
 		Note:    "some-notes",
 		Transfer: &cert.Transaction{
-			To:     "another-user@email.com",
-			Status: cert.Accepted,
+			To:          "another-user@email.com",
+			RecipientID: "another-user-id",
+			Status:      cert.Accepted,
 		},
 	}
 
 	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
 		Certs: map[string]cert.Certificate{
 			certKey: mockCert,
 		},
 		Txs: map[string][]cert.Transaction{
 			certKey: []cert.Transaction{
 				{
-					To:     "another-user@email.com",
-					Status: cert.Accepted,
+					To:          "another-user@email.com",
+					RecipientID: "another-user-id",
+					Status:      cert.Accepted,
 				},
 			},
 		},
 	}
 
-	_, err := mc.AcceptTx(certKey)
+	_, err := mc.AcceptTx(ctx, "another-user-id", certKey)
 	assert.NotNil(t, err)
 	assert.Equal(t, "no pending transactions found", err.Error())
 }
+
+func TestRejectAndCancelTx(t *testing.T) {
+	for _, status := range []cert.TransferStatus{cert.Rejected, cert.Cancelled} {
+		certKey := "key1"
+
+		mc := memStore{
+			Ledger:    map[string][]ledger.Entry{},
+			Certs:     map[string]cert.Certificate{},
+			Txs:       map[string][]cert.Transaction{},
+			userStore: newUserStore(),
+		}
+		recipient, _ := mc.NewUser(ctx, "another-user@email.com", "miss smith")
+
+		tx := cert.Transaction{
+			To:          "another-user@email.com",
+			RecipientID: recipient.ID,
+			Status:      cert.Pending,
+		}
+		mc.Certs[certKey] = cert.Certificate{
+			ID:       certKey,
+			Title:    "the-title",
+			OwnerID:  "the-owner-id",
+			Year:     2018,
+			Transfer: &tx,
+		}
+		mc.Txs[certKey] = []cert.Transaction{tx}
+
+		// transactions are rejected by their recipient and
+		// cancelled by the certificate owner
+		resolve, userID, otherID := mc.RejectTx, recipient.ID, "the-owner-id"
+		if status == cert.Cancelled {
+			resolve, userID, otherID = mc.CancelTx, "the-owner-id", recipient.ID
+		}
+
+		_, err := resolve(ctx, userID, "i-don't-exist")
+		assert.True(t, errors.Is(err, ErrNotFound))
+
+		_, err = resolve(ctx, otherID, certKey)
+		assert.True(t, errors.Is(err, ErrForbidden))
+		assert.Equal(t, cert.Pending, mc.Txs[certKey][0].Status)
+
+		got, err := resolve(ctx, userID, certKey)
+		assert.Nil(t, err)
+		assert.Equal(t, *got, mc.Certs[certKey])
+		assert.Equal(t, status, mc.Txs[certKey][0].Status)
+		assert.Equal(t, status, mc.Certs[certKey].Transfer.Status)
+
+		// ownership is unchanged
+		assert.Equal(t, "the-owner-id", mc.Certs[certKey].OwnerID)
+
+		// the transaction is no longer pending
+		_, err = resolve(ctx, userID, certKey)
+		assert.True(t, errors.Is(err, ErrConflict))
+
+		// and a new transfer can be created
+		_, err = mc.CreateTx(ctx, "the-owner-id", certKey, cert.Transaction{To: "another-user@email.com"})
+		assert.Nil(t, err)
+		assert.Len(t, mc.Txs[certKey], 2)
+	}
+}
+
+func TestGetTxs(t *testing.T) {
+	certKey := "key1"
+	mc := memStore{
+		userStore: newUserStore(),
+		Ledger:    map[string][]ledger.Entry{},
+		Certs: map[string]cert.Certificate{
+			certKey: cert.Certificate{
+				ID:      certKey,
+				OwnerID: "owner3-id",
+			},
+		},
+		// transactions are stored newest first
+		Txs: map[string][]cert.Transaction{
+			certKey: []cert.Transaction{
+				{ID: "tx3", From: "owner2-id", To: "owner3@email.com", RecipientID: "owner3-id", Status: cert.Accepted},
+				{ID: "tx2", From: "owner1-id", To: "owner2@email.com", RecipientID: "owner2-id", Status: cert.Accepted},
+				{ID: "tx1", From: "owner1-id", To: "owner4@email.com", RecipientID: "owner4-id", Status: cert.Rejected},
+			},
+		},
+	}
+
+	_, _, err := mc.GetTxs(ctx, "i-dont-exist", 0, 10)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	tests := []struct {
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{0, 10, []string{"tx1", "tx2", "tx3"}},
+		{0, 2, []string{"tx1", "tx2"}},
+		{1, 1, []string{"tx2"}},
+		{2, 10, []string{"tx3"}},
+		{3, 10, []string{}},
+	}
+
+	for _, test := range tests {
+		txs, total, err := mc.GetTxs(ctx, certKey, test.offset, test.limit)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, total)
+
+		ids := []string{}
+		for _, tx := range txs {
+			ids = append(ids, tx.ID)
+		}
+		assert.Equal(t, test.expected, ids)
+	}
+}
+
+func TestStoreAbortedOperations(t *testing.T) {
+	s := NewMemStore()
+	owner1 := newTestUser(t, s, "owner1@email.com")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.CreateCert(cancelled, owner1.ID, cert.Certificate{Title: "the-title", OwnerID: owner1.ID, Year: 2018})
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	_, err = s.NewUser(cancelled, "owner2@email.com", "miss smith")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// aborted operations leave the store unchanged
+	certs, err := s.GetCerts(ctx, owner1.ID)
+	assert.Nil(t, err)
+	assert.Len(t, certs, 0)
+
+	_, err = s.GetUser(ctx, "owner2@email.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/Popcore/verisart/pkg/ledger"
+	"github.com/Popcore/verisart/pkg/merkle"
+	"github.com/Popcore/verisart/pkg/transparency"
+)
+
+// appendLedger replaces the ledger of a certificate with chain, whose last
+// entry is new, and adds the new entry to the transparency log.
+// It must be called with m.mu held for writing.
+func (m *memStore) appendLedger(certID string, chain []ledger.Entry) {
+	last := chain[len(chain)-1]
+
+	m.Ledger[certID] = chain
+	m.Log = append(m.Log, transparency.LeafRef{CertID: certID, Seq: last.Seq})
+	m.tree.Append(transparency.LeafData(last))
+}
+
+// loadLog rebuilds the transparency log from the ledger entries listed in
+// refs. When refs is nil, as for data saved before the log existed, every
+// ledger entry is added to the log in chronological order.
+func (m *memStore) loadLog(refs []transparency.LeafRef) error {
+	if refs == nil {
+		for certID, chain := range m.Ledger {
+			for _, e := range chain {
+				refs = append(refs, transparency.LeafRef{CertID: certID, Seq: e.Seq})
+			}
+		}
+
+		sort.Slice(refs, func(i, j int) bool {
+			a := m.Ledger[refs[i].CertID][refs[i].Seq]
+			b := m.Ledger[refs[j].CertID][refs[j].Seq]
+			if !a.Timestamp.Equal(b.Timestamp) {
+				return a.Timestamp.Before(b.Timestamp)
+			}
+			if a.CertID != b.CertID {
+				return a.CertID < b.CertID
+			}
+			return a.Seq < b.Seq
+		})
+	}
+
+	m.Log = nil
+	m.tree = merkle.Tree{}
+
+	for i, ref := range refs {
+		chain := m.Ledger[ref.CertID]
+		if ref.Seq < 0 || ref.Seq >= len(chain) {
+			return fmt.Errorf("leaf %d of the transparency log references a missing ledger entry", i)
+		}
+
+		m.Log = append(m.Log, ref)
+		m.tree.Append(transparency.LeafData(chain[ref.Seq]))
+	}
+
+	return nil
+}
+
+// GetTreeHead returns the current tree head of the transparency log,
+// signed if the store has a signer.
+func (m *memStore) GetTreeHead(ctx context.Context) (*transparency.TreeHead, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	size := m.tree.Size()
+	root, err := m.tree.Root(size)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	head := transparency.TreeHead{
+		TreeSize:  size,
+		Timestamp: m.now(),
+		RootHash:  hex.EncodeToString(root),
+	}
+
+	if m.signer != nil {
+		payload, err := head.SignedPayload()
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := m.signer.Sign(payload)
+		if err != nil {
+			return nil, fmt.Errorf("could not sign tree head: %s", err.Error())
+		}
+		head.Signature = &sig
+	}
+
+	return &head, nil
+}
+
+// GetInclusionProof returns the proof that an entry of the ledger of a
+// certificate is part of the transparency log.
+func (m *memStore) GetInclusionProof(ctx context.Context, certID string, seq, treeSize int) (*transparency.InclusionProof, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chain := m.Ledger[certID]
+	if len(chain) == 0 {
+		return nil, newError(ErrNotFound, "certificate not found. Please use a valid ID")
+	}
+
+	if seq < 0 || seq >= len(chain) {
+		return nil, newError(ErrNotFound, "the certificate ledger has no entry %d", seq)
+	}
+
+	index := -1
+	for i, ref := range m.Log {
+		if ref.CertID == certID && ref.Seq == seq {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, newError(ErrNotFound, "the ledger entry is not part of the transparency log")
+	}
+
+	if treeSize == 0 {
+		treeSize = m.tree.Size()
+	}
+
+	if treeSize <= index || treeSize > m.tree.Size() {
+		return nil, newError(ErrValidation, "the tree size must be between %d and %d", index+1, m.tree.Size())
+	}
+
+	path, err := m.tree.InclusionProof(index, treeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := m.tree.Root(treeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := m.tree.LeafHash(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transparency.InclusionProof{
+		LeafIndex: index,
+		TreeSize:  treeSize,
+		RootHash:  hex.EncodeToString(root),
+		Entry:     chain[seq],
+		LeafHash:  hex.EncodeToString(leaf),
+		AuditPath: encodeHashes(path),
+	}, nil
+}
+
+// GetConsistencyProof returns the proof that a version of the
+// transparency log is a prefix of a later one.
+func (m *memStore) GetConsistencyProof(ctx context.Context, first, second int) (*transparency.ConsistencyProof, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if first < 1 || first > second || second > m.tree.Size() {
+		return nil, newError(ErrValidation, "tree sizes must satisfy 1 <= first <= second <= %d", m.tree.Size())
+	}
+
+	proof, err := m.tree.ConsistencyProof(first, second)
+	if err != nil {
+		return nil, err
+	}
+
+	firstRoot, err := m.tree.Root(first)
+	if err != nil {
+		return nil, err
+	}
+
+	secondRoot, err := m.tree.Root(second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transparency.ConsistencyProof{
+		First:          first,
+		Second:         second,
+		FirstRootHash:  hex.EncodeToString(firstRoot),
+		SecondRootHash: hex.EncodeToString(secondRoot),
+		Proof:          encodeHashes(proof),
+	}, nil
+}
+
+// encodeHashes returns the hex encoding of a list of hashes.
+func encodeHashes(hashes [][]byte) []string {
+	encoded := make([]string, len(hashes))
+	for i, h := range hashes {
+		encoded[i] = hex.EncodeToString(h)
+	}
+
+	return encoded
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/merkle"
+	"github.com/Popcore/verisart/pkg/signing"
+	"github.com/Popcore/verisart/pkg/transparency"
+)
+
+// decodeHashes decodes a list of hex encoded hashes.
+func decodeHashes(t *testing.T, encoded []string) [][]byte {
+	hashes := [][]byte{}
+	for _, e := range encoded {
+		h, err := hex.DecodeString(e)
+		assert.Nil(t, err)
+		hashes = append(hashes, h)
+	}
+
+	return hashes
+}
+
+// fillLog creates two certificates and transfers one of them, adding five
+// entries to the transparency log of s. It returns the certificate IDs.
+func fillLog(t *testing.T, s Storer) (string, string) {
+	owner1 := newTestUser(t, s, "owner1@email.com")
+	owner2 := newTestUser(t, s, "owner2@email.com")
+
+	first, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{Title: "the-title", OwnerID: owner1.ID, Year: 2018})
+	assert.Nil(t, err)
+	second, err := s.CreateCert(ctx, owner1.ID, cert.Certificate{Title: "another-title", OwnerID: owner1.ID, Year: 2018})
+	assert.Nil(t, err)
+
+	title := "the-new-title"
+	_, err = s.UpdateCert(ctx, owner1.ID, first.ID, cert.Patch{Title: &title})
+	assert.Nil(t, err)
+	_, err = s.CreateTx(ctx, owner1.ID, first.ID, cert.Transaction{To: "owner2@email.com"})
+	assert.Nil(t, err)
+	_, err = s.AcceptTx(ctx, owner2.ID, first.ID)
+	assert.Nil(t, err)
+
+	return first.ID, second.ID
+}
+
+func TestTransparencyLog(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	s := NewMemStore(WithSigner(key))
+	firstID, secondID := fillLog(t, s)
+
+	head, err := s.GetTreeHead(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, head.TreeSize)
+
+	payload, err := head.SignedPayload()
+	assert.Nil(t, err)
+	if assert.NotNil(t, head.Signature) {
+		assert.Nil(t, signing.Verify(key.PublicKey(), payload, *head.Signature))
+	}
+
+	// the creation of the second certificate is the second leaf
+	proof, err := s.GetInclusionProof(ctx, secondID, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, proof.LeafIndex)
+	assert.Equal(t, head.RootHash, proof.RootHash)
+	assert.Equal(t, hex.EncodeToString(merkle.LeafHash(transparency.LeafData(proof.Entry))), proof.LeafHash)
+
+	root, err := hex.DecodeString(head.RootHash)
+	assert.Nil(t, err)
+	leaf, err := hex.DecodeString(proof.LeafHash)
+	assert.Nil(t, err)
+	assert.Nil(t, merkle.VerifyInclusion(proof.LeafIndex, proof.TreeSize, leaf, decodeHashes(t, proof.AuditPath), root))
+
+	// proofs can be requested against older versions of the log
+	proof, err = s.GetInclusionProof(ctx, firstID, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, proof.LeafIndex)
+	assert.Equal(t, 2, proof.TreeSize)
+
+	_, err = s.GetInclusionProof(ctx, firstID, 4, 0)
+	assert.NotNil(t, err)
+	_, err = s.GetInclusionProof(ctx, firstID, 3, 2)
+	assert.NotNil(t, err)
+	_, err = s.GetInclusionProof(ctx, "i-dont-exist", 0, 0)
+	assert.NotNil(t, err)
+
+	consistency, err := s.GetConsistencyProof(ctx, 3, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, head.RootHash, consistency.SecondRootHash)
+
+	firstRoot, err := hex.DecodeString(consistency.FirstRootHash)
+	assert.Nil(t, err)
+	assert.Nil(t, merkle.VerifyConsistency(3, 5, firstRoot, root, decodeHashes(t, consistency.Proof)))
+
+	_, err = s.GetConsistencyProof(ctx, 3, 6)
+	assert.NotNil(t, err)
+	_, err = s.GetConsistencyProof(ctx, 0, 5)
+	assert.NotNil(t, err)
+}
+
+func TestFileStoreTransparencyLogReload(t *testing.T) {
+	path, cleanup := tempDataFile(t)
+	defer cleanup()
+
+	s, err := NewFileStore(path)
+	assert.Nil(t, err)
+	fillLog(t, s)
+
+	head, err := s.GetTreeHead(ctx)
+	assert.Nil(t, err)
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	reloadedHead, err := reloaded.GetTreeHead(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, head.TreeSize, reloadedHead.TreeSize)
+	assert.Equal(t, head.RootHash, reloadedHead.RootHash)
+
+	// data saved before the log existed is added to a new log
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+
+	snap := map[string]json.RawMessage{}
+	assert.Nil(t, json.Unmarshal(data, &snap))
+	delete(snap, "log")
+	data, err = json.Marshal(snap)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+
+	migrated, err := NewFileStore(path)
+	assert.Nil(t, err)
+
+	migratedHead, err := migrated.GetTreeHead(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, migratedHead.TreeSize)
+}
@@ -1,36 +1,394 @@
 package store
 
 import (
-	"errors"
-
-	"github.com/satori/go.uuid"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
 
+	"github.com/Popcore/verisart/pkg/ids"
 	"github.com/Popcore/verisart/pkg/users"
 )
 
+// tokenBytes is the number of random bytes in API and claim tokens.
+const tokenBytes = 32
+
 type userStore struct {
+	// Users maps user IDs to users.
 	Users map[string]users.User
+
+	// Tokens maps the hashes of API tokens to the ID of the users owning
+	// them. Tokens themselves are never stored.
+	Tokens map[string]string
+
+	// emails is the unique index of the user email addresses, mapping
+	// them to user IDs. It is rebuilt from Users by indexEmails.
+	emails map[string]string
+
+	// ids generates the IDs of users and of the resources of the stores
+	// embedding the user store.
+	ids ids.Generator
+
+	// admins lists the canonical email addresses of the users who are
+	// made admins once they verify their address.
+	admins map[string]bool
+
+	mu sync.RWMutex
+}
+
+func newUserStore() *userStore {
+	return &userStore{
+		Users:  make(map[string]users.User),
+		Tokens: make(map[string]string),
+		emails: make(map[string]string),
+	}
 }
 
-func newUserStore() userStore {
-	return userStore{
-		Users: make(map[string]users.User),
+// indexEmails rebuilds the email index from the users in the store.
+func (s *userStore) indexEmails() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.emails = make(map[string]string, len(s.Users))
+	for id, u := range s.Users {
+		s.emails[u.Email] = id
 	}
 }
 
-// NewUser adds a new user to the Store
-func (s *userStore) NewUser(email string, name string) (*users.User, error) {
-	if _, ok := s.Users[email]; ok {
-		return nil, errors.New("a user with the same email address already exists")
+// NewUser adds a new user to the Store. The email address is stored in
+// canonical form. New users are collectors, even when their address is
+// listed as an admin address since it has not been verified yet.
+func (s *userStore) NewUser(ctx context.Context, email string, name string) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	email = users.NormalizeEmail(email)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.emails[email]; ok {
+		return nil, newError(ErrConflict, "a user with the same email address already exists")
 	}
 
 	newUser := users.User{
-		ID:    uuid.NewV4().String(),
+		ID:    s.newID(),
 		Email: email,
 		Name:  name,
+		Role:  users.Collector,
 	}
 
-	s.Users[email] = newUser
+	s.Users[newUser.ID] = newUser
+	s.emails[email] = newUser.ID
 
 	return &newUser, nil
 }
+
+// IssueToken generates a new random API token for the user identified
+// by userID. Only the hash of the token is kept in the store.
+func (s *userStore) IssueToken(ctx context.Context, userID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Users[userID]; !ok {
+		return "", newError(ErrNotFound, "user not found")
+	}
+
+	s.Tokens[hashToken(token)] = userID
+
+	return token, nil
+}
+
+// Authenticate returns the user owning the API token.
+func (s *userStore) Authenticate(ctx context.Context, token string) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.Tokens[hashToken(token)]
+	if !ok {
+		return nil, newError(ErrNotFound, "invalid API token")
+	}
+
+	u, ok := s.Users[userID]
+	if !ok {
+		return nil, newError(ErrNotFound, "invalid API token")
+	}
+
+	return &u, nil
+}
+
+// GetUser returns the user identified either by ID or by email address.
+func (s *userStore) GetUser(ctx context.Context, idOrEmail string) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.Users[idOrEmail]
+	if !ok {
+		u, ok = s.Users[s.emails[users.NormalizeEmail(idOrEmail)]]
+	}
+	if !ok {
+		return nil, newError(ErrNotFound, "user not found")
+	}
+
+	return &u, nil
+}
+
+// ListUsers returns the users matching f ordered by email address.
+func (s *userStore) ListUsers(ctx context.Context, f users.Filter, offset, limit int) ([]users.User, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	matching := []users.User{}
+	for _, u := range s.Users {
+		if f.Match(u) {
+			matching = append(matching, u)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].Email < matching[j].Email
+	})
+
+	total := len(matching)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return matching[offset:end], total, nil
+}
+
+// UpdateUser applies a patch to the user identified by userID.
+func (s *userStore) UpdateUser(ctx context.Context, userID string, p users.Patch) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.Users[userID]
+	if !ok {
+		return nil, newError(ErrNotFound, "user not found")
+	}
+
+	updated := p.Apply(u)
+	s.Users[userID] = updated
+
+	return &updated, nil
+}
+
+// emailTaken returns true if a user other than the one identified by
+// userID has the email address.
+func (s *userStore) emailTaken(email, userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	owner, ok := s.emails[users.NormalizeEmail(email)]
+
+	return ok && owner != userID
+}
+
+// setEmail changes the email address of the user identified by userID,
+// keeping email addresses unique across users.
+func (s *userStore) setEmail(userID, email string) (users.User, error) {
+	email = users.NormalizeEmail(email)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.Users[userID]
+	if !ok {
+		return users.User{}, newError(ErrNotFound, "user not found")
+	}
+
+	if owner, ok := s.emails[email]; ok && owner != userID {
+		return users.User{}, newError(ErrConflict, "a user with the same email address already exists")
+	}
+
+	delete(s.emails, u.Email)
+	u.Email = email
+	s.Users[userID] = u
+	s.emails[email] = userID
+
+	return u, nil
+}
+
+// AssignRole gives the role described by a to the user identified by
+// userID. Galleries can only represent artists and the last admin cannot
+// be given another role.
+func (s *userStore) AssignRole(ctx context.Context, userID string, a users.RoleAssignment) (*users.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := a.Validate(); err != nil {
+		return nil, newError(ErrValidation, "%s", err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.Users[userID]
+	if !ok {
+		return nil, newError(ErrNotFound, "user not found")
+	}
+
+	for _, artistID := range a.Represents {
+		if s.Users[artistID].Role != users.Artist {
+			return nil, newError(ErrValidation, "galleries can only represent existing artists")
+		}
+	}
+
+	if a.Role != users.Admin && u.Role == users.Admin && s.countRole(users.Admin) == 1 {
+		return nil, newError(ErrConflict, "the last admin cannot be given another role")
+	}
+
+	u.Role = a.Role
+	u.Represents = nil
+	if len(a.Represents) > 0 {
+		u.Represents = append([]string{}, a.Represents...)
+	}
+	s.Users[userID] = u
+
+	return &u, nil
+}
+
+// countRole returns the number of users having role r. It must be called
+// with the lock held.
+func (s *userStore) countRole(r users.Role) int {
+	n := 0
+	for _, u := range s.Users {
+		if u.Role == r {
+			n++
+		}
+	}
+
+	return n
+}
+
+// isLastAdmin returns true if the user identified by userID is the only
+// admin. It must be called with the lock held.
+func (s *userStore) isLastAdmin(userID string) bool {
+	return s.Users[userID].Role == users.Admin && s.countRole(users.Admin) == 1
+}
+
+// isAdminAddress returns true if email was set with WithAdmins.
+func (s *userStore) isAdminAddress(email string) bool {
+	return s.admins[users.NormalizeEmail(email)]
+}
+
+// promoteAdmin makes an admin of the user identified by userID if their
+// email address was set with WithAdmins. It must only be called once the
+// user has proven they own the address.
+func (s *userStore) promoteAdmin(userID string) (users.User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.Users[userID]
+	if !ok || !s.admins[u.Email] || u.Role == users.Admin {
+		return u, false
+	}
+
+	u.Role = users.Admin
+	u.Represents = nil
+	s.Users[userID] = u
+
+	return u, true
+}
+
+// removeUser deletes the user identified by userID and its API tokens.
+// Galleries stop representing deleted artists. It must be called with the
+// lock held.
+func (s *userStore) removeUser(userID string) {
+	delete(s.emails, s.Users[userID].Email)
+	delete(s.Users, userID)
+	for hash, owner := range s.Tokens {
+		if owner == userID {
+			delete(s.Tokens, hash)
+		}
+	}
+
+	for id, u := range s.Users {
+		for i, artistID := range u.Represents {
+			if artistID == userID {
+				u.Represents = append(u.Represents[:i:i], u.Represents[i+1:]...)
+				s.Users[id] = u
+				break
+			}
+		}
+	}
+}
+
+// userExists returns true if a user with the given ID is in the store.
+func (s *userStore) userExists(userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.Users[userID]
+
+	return ok
+}
+
+// getUser returns the user identified by userID, if any.
+func (s *userStore) getUser(userID string) (users.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.Users[userID]
+
+	return u, ok
+}
+
+// userByEmail returns the user with the given email address, if any.
+func (s *userStore) userByEmail(email string) (users.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.Users[s.emails[users.NormalizeEmail(email)]]
+
+	return u, ok
+}
+
+// newToken returns a new random token, hex encoded.
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of an API token.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(h[:])
+}
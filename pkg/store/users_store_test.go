@@ -1,17 +1,32 @@
 package store
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Popcore/verisart/pkg/ids"
 	"github.com/Popcore/verisart/pkg/users"
 )
 
+// newTestUser adds a user with the given email address to s. It stops
+// the test if the user cannot be created.
+func newTestUser(t *testing.T, s users.UserManager, email string) users.User {
+	u, err := s.NewUser(ctx, email, "joe blog")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return *u
+}
+
 func TestNewUserStore(t *testing.T) {
 	got := newUserStore()
-	expected := userStore{
-		Users: make(map[string]users.User),
+	expected := &userStore{
+		Users:  make(map[string]users.User),
+		Tokens: make(map[string]string),
+		emails: make(map[string]string),
 	}
 
 	assert.Equal(t, expected, got)
@@ -19,22 +34,157 @@ func TestNewUserStore(t *testing.T) {
 
 func TestNewUserOK(t *testing.T) {
 	u := newUserStore()
-	user, err := u.NewUser("test@email.com", "test-user")
+	u.ids = &ids.Sequence{}
+	user, err := u.NewUser(ctx, "test@email.com", "test-user")
 
 	assert.Nil(t, err)
 	assert.Len(t, u.Users, 1)
-	assert.Equal(t, "test@email.com", user.Email)
-	assert.Equal(t, "test-user", user.Name)
-	assert.NotNil(t, user.ID)
+	assert.Equal(t, &users.User{
+		ID:    "00000000-0000-0000-0000-000000000001",
+		Email: "test@email.com",
+		Name:  "test-user",
+		Role:  users.Collector,
+	}, user)
 }
 
 func TestNewUserError(t *testing.T) {
 	u := newUserStore()
-	_, err := u.NewUser("test@email.com", "test-user")
+	_, err := u.NewUser(ctx, "test@email.com", "test-user")
 	assert.Nil(t, err)
 
-	_, err = u.NewUser("test@email.com", "test-user")
+	_, err = u.NewUser(ctx, "test@email.com", "test-user")
 	assert.NotNil(t, err)
 	assert.Len(t, u.Users, 1)
 	assert.Equal(t, "a user with the same email address already exists", err.Error())
+	assert.True(t, errors.Is(err, ErrConflict))
+}
+
+func TestIssueTokenAndAuthenticate(t *testing.T) {
+	u := newUserStore()
+	user, err := u.NewUser(ctx, "test@email.com", "test-user")
+	assert.Nil(t, err)
+
+	token, err := u.IssueToken(ctx, user.ID)
+	assert.Nil(t, err)
+	assert.Len(t, token, 2*tokenBytes)
+
+	// only the hash of the token is stored
+	assert.Len(t, u.Tokens, 1)
+	_, ok := u.Tokens[token]
+	assert.False(t, ok)
+
+	got, err := u.Authenticate(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	_, err = u.Authenticate(ctx, "not-a-valid-token")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = u.IssueToken(ctx, "i-dont-exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestGetAndUpdateUser(t *testing.T) {
+	u := newUserStore()
+	user, err := u.NewUser(ctx, "test@email.com", "test-user")
+	assert.Nil(t, err)
+
+	// users can be retrieved both by ID and by email address
+	got, err := u.GetUser(ctx, user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	got, err = u.GetUser(ctx, "test@email.com")
+	assert.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	_, err = u.GetUser(ctx, "i-dont-exist@email.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	name := "new-name"
+	updated, err := u.UpdateUser(ctx, user.ID, users.Patch{Name: &name})
+	assert.Nil(t, err)
+	assert.Equal(t, &users.User{ID: user.ID, Email: "test@email.com", Name: "new-name", Role: users.Collector}, updated)
+
+	// patches without fields leave the user unchanged
+	updated, err = u.UpdateUser(ctx, user.ID, users.Patch{})
+	assert.Nil(t, err)
+	assert.Equal(t, "new-name", updated.Name)
+
+	_, err = u.UpdateUser(ctx, "i-dont-exist", users.Patch{Name: &name})
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestEmailsAreNormalized(t *testing.T) {
+	u := newUserStore()
+	user, err := u.NewUser(ctx, " Joe@Example.com ", "joe blog")
+	assert.Nil(t, err)
+	assert.Equal(t, "joe@example.com", user.Email)
+
+	// addresses differing only by case belong to the same user
+	_, err = u.NewUser(ctx, "joe@example.com", "joe blog")
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	_, err = u.NewUser(ctx, "JOE@EXAMPLE.COM", "joe blog")
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	got, err := u.GetUser(ctx, "JOE@example.COM")
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	list, total, err := u.ListUsers(ctx, users.Filter{EmailPrefix: "Joe@"}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []users.User{*user}, list)
+}
+
+func TestListUsers(t *testing.T) {
+	u := newUserStore()
+	for email, name := range map[string]string{
+		"carol@gallery.com": "Carol Smith",
+		"alice@email.com":   "Alice Smith",
+		"bob@email.com":     "Bob Jones",
+		"anna@gallery.com":  "Anna Jones",
+	} {
+		_, err := u.NewUser(ctx, email, name)
+		assert.Nil(t, err)
+	}
+
+	emails := func(list []users.User) []string {
+		out := []string{}
+		for _, u := range list {
+			out = append(out, u.Email)
+		}
+		return out
+	}
+
+	list, total, err := u.ListUsers(ctx, users.Filter{}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"alice@email.com", "anna@gallery.com", "bob@email.com", "carol@gallery.com"}, emails(list))
+
+	list, total, err = u.ListUsers(ctx, users.Filter{}, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"anna@gallery.com", "bob@email.com"}, emails(list))
+
+	list, total, err = u.ListUsers(ctx, users.Filter{EmailPrefix: "a"}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []string{"alice@email.com", "anna@gallery.com"}, emails(list))
+
+	list, total, err = u.ListUsers(ctx, users.Filter{Name: "smith"}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []string{"alice@email.com", "carol@gallery.com"}, emails(list))
+
+	list, total, err = u.ListUsers(ctx, users.Filter{EmailPrefix: "a", Name: "JONES"}, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []string{"anna@gallery.com"}, emails(list))
+
+	list, total, err = u.ListUsers(ctx, users.Filter{}, 10, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Empty(t, list)
 }
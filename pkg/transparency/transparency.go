@@ -0,0 +1,104 @@
+// Package transparency defines the global append-only log recording every
+// event of every certificate, in the style of Certificate Transparency
+// (RFC 6962). Each leaf of the log holds the hash of a ledger entry.
+package transparency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/ledger"
+)
+
+// LeafRef identifies the ledger entry stored in a leaf of the log.
+type LeafRef struct {
+	CertID string `json:"certificateId"`
+	Seq    int    `json:"seq"`
+}
+
+// LeafData returns the data stored in the leaf recording e: the hash of
+// the entry, which commits to its whole content and to its history.
+func LeafData(e ledger.Entry) []byte {
+	return []byte(e.Hash)
+}
+
+// TreeHead describes the log at a point in time. Once signed it commits
+// the service to the content of the log: any later version of the log
+// must be consistent with it.
+type TreeHead struct {
+	TreeSize  int       `json:"treeSize"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// RootHash is the hex encoded Merkle tree hash of the log.
+	RootHash string `json:"rootHash"`
+
+	// Signature is set when the service signs the tree head.
+	Signature *cert.Signature `json:"signature,omitempty"`
+}
+
+// signedTreeHead lists the tree head fields covered by its signature, in
+// alphabetical order of their JSON names.
+type signedTreeHead struct {
+	RootHash  string `json:"rootHash"`
+	Timestamp string `json:"timestamp"`
+	TreeSize  int    `json:"treeSize"`
+}
+
+// SignedPayload returns the canonical representation of the tree head
+// that is signed by the service: a compact JSON object holding its root
+// hash, timestamp and tree size, with keys sorted alphabetically and the
+// timestamp formatted as RFC 3339 in UTC.
+func (h TreeHead) SignedPayload() ([]byte, error) {
+	return json.Marshal(signedTreeHead{
+		RootHash:  h.RootHash,
+		Timestamp: h.Timestamp.UTC().Format(time.RFC3339Nano),
+		TreeSize:  h.TreeSize,
+	})
+}
+
+// InclusionProof proves that a ledger entry is part of the log.
+type InclusionProof struct {
+	LeafIndex int    `json:"leafIndex"`
+	TreeSize  int    `json:"treeSize"`
+	RootHash  string `json:"rootHash"`
+
+	// Entry is the ledger entry stored in the leaf.
+	Entry    ledger.Entry `json:"entry"`
+	LeafHash string       `json:"leafHash"`
+
+	// AuditPath lists the hex encoded hashes needed to compute the root
+	// hash from the leaf hash.
+	AuditPath []string `json:"auditPath"`
+}
+
+// ConsistencyProof proves that a version of the log is a prefix of a
+// later one, i.e. that no leaf was altered or removed in between.
+type ConsistencyProof struct {
+	First          int    `json:"first"`
+	Second         int    `json:"second"`
+	FirstRootHash  string `json:"firstRootHash"`
+	SecondRootHash string `json:"secondRootHash"`
+
+	// Proof lists the hex encoded hashes needed to compute both root
+	// hashes.
+	Proof []string `json:"proof"`
+}
+
+// Log is the interface implemented by stores keeping a transparency log.
+type Log interface {
+	// GetTreeHead returns the current tree head of the log.
+	GetTreeHead(ctx context.Context) (*TreeHead, error)
+
+	// GetInclusionProof returns the proof that the entry seq of the
+	// ledger of the certificate identified by certID is part of the log
+	// made of its first treeSize leaves. If treeSize is 0 the current
+	// size of the log is used.
+	GetInclusionProof(ctx context.Context, certID string, seq, treeSize int) (*InclusionProof, error)
+
+	// GetConsistencyProof returns the proof that the log made of its
+	// first first leaves is a prefix of the log made of its first second
+	// leaves.
+	GetConsistencyProof(ctx context.Context, first, second int) (*ConsistencyProof, error)
+}
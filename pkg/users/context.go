@@ -0,0 +1,22 @@
+package users
+
+import "context"
+
+// contextKey is the type of the keys used to store values in a context.
+// Being unexported it prevents collisions with keys defined in other
+// packages.
+type contextKey int
+
+const userKey contextKey = 0
+
+// NewContext returns a copy of ctx carrying the user u.
+func NewContext(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, userKey, u)
+}
+
+// FromContext returns the user stored in ctx, if any.
+func FromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(userKey).(*User)
+
+	return u, ok && u != nil
+}
@@ -0,0 +1,122 @@
+package users
+
+import (
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+// Role describes what a user does and decides what they are allowed to
+// do.
+type Role string
+
+const (
+	// Collector users receive and transfer certificates. It is the role
+	// of new users.
+	Collector Role = "collector"
+
+	// Artist users issue certificates for their own works.
+	Artist Role = "artist"
+
+	// Gallery users issue certificates on behalf of the artists they
+	// represent.
+	Gallery Role = "gallery"
+
+	// Admin users moderate certificates, assign roles and manage users.
+	Admin Role = "admin"
+)
+
+// Valid returns true if r is one of the defined roles.
+func (r Role) Valid() bool {
+	_, ok := permissions[r]
+
+	return ok
+}
+
+// Permission is an action only some roles are allowed to take.
+type Permission string
+
+const (
+	// IssueCertificates allows creating certificates.
+	IssueCertificates Permission = "issue_certificates"
+
+	// EditCertificates allows owners to update and delete their
+	// certificates.
+	EditCertificates Permission = "edit_certificates"
+
+	// ModerateCertificates allows updating and deleting any certificate.
+	ModerateCertificates Permission = "moderate_certificates"
+
+	// AssignRoles allows changing the role of users.
+	AssignRoles Permission = "assign_roles"
+
+	// ManageUsers allows listing users and deleting the accounts of
+	// other users.
+	ManageUsers Permission = "manage_users"
+)
+
+// permissions lists the permissions of each role. Every role can receive
+// and transfer certificates.
+var permissions = map[Role][]Permission{
+	Collector: {},
+	Artist:    {IssueCertificates, EditCertificates},
+	Gallery:   {IssueCertificates, EditCertificates},
+	Admin:     {ModerateCertificates, AssignRoles, ManageUsers},
+}
+
+// Can returns true if the role of u grants p.
+func (u User) Can(p Permission) bool {
+	for _, granted := range permissions[u.Role] {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanIssueFor returns true if u can issue certificates for the works of
+// the artist identified by artistID: artists can issue certificates for
+// their own works and galleries for the works of the artists they
+// represent.
+func (u User) CanIssueFor(artistID string) bool {
+	switch u.Role {
+	case Artist:
+		return artistID == u.ID
+	case Gallery:
+		for _, id := range u.Represents {
+			if id == artistID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// RoleAssignment describes the role given to a user.
+type RoleAssignment struct {
+	Role Role `json:"role"`
+
+	// Represents lists the IDs of the artists represented by a gallery.
+	// It can only be set for galleries.
+	Represents []string `json:"represents"`
+}
+
+// Validate checks that the role exists and that only galleries represent
+// artists.
+func (a RoleAssignment) Validate() error {
+	v := validation.Validator{}
+
+	v.Required("role", string(a.Role))
+	if a.Role != "" {
+		v.Check(a.Role.Valid(), "role", "must be 'collector', 'artist', 'gallery' or 'admin'")
+	}
+
+	if a.Role != Gallery {
+		v.Check(len(a.Represents) == 0, "represents", "can only be set for galleries")
+	}
+	for _, id := range a.Represents {
+		v.Check(id != "", "represents", "cannot contain empty IDs")
+	}
+
+	return v.Err()
+}
@@ -0,0 +1,55 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role    Role
+		granted []Permission
+		refused []Permission
+	}{
+		{Collector, nil, []Permission{IssueCertificates, EditCertificates, ModerateCertificates, AssignRoles, ManageUsers}},
+		{Artist, []Permission{IssueCertificates, EditCertificates}, []Permission{ModerateCertificates, AssignRoles, ManageUsers}},
+		{Gallery, []Permission{IssueCertificates, EditCertificates}, []Permission{ModerateCertificates, AssignRoles, ManageUsers}},
+		{Admin, []Permission{ModerateCertificates, AssignRoles, ManageUsers}, []Permission{IssueCertificates, EditCertificates}},
+		{"", nil, []Permission{IssueCertificates, EditCertificates, ModerateCertificates, AssignRoles, ManageUsers}},
+	}
+
+	for _, test := range tests {
+		u := User{Role: test.role}
+		for _, p := range test.granted {
+			assert.True(t, u.Can(p), "%s %s", test.role, p)
+		}
+		for _, p := range test.refused {
+			assert.False(t, u.Can(p), "%s %s", test.role, p)
+		}
+	}
+}
+
+func TestCanIssueFor(t *testing.T) {
+	artist := User{ID: "artist-id", Role: Artist}
+	assert.True(t, artist.CanIssueFor("artist-id"))
+	assert.False(t, artist.CanIssueFor("another-artist-id"))
+
+	gallery := User{ID: "gallery-id", Role: Gallery, Represents: []string{"artist-id"}}
+	assert.True(t, gallery.CanIssueFor("artist-id"))
+	assert.False(t, gallery.CanIssueFor("another-artist-id"))
+	assert.False(t, gallery.CanIssueFor("gallery-id"))
+
+	collector := User{ID: "collector-id", Role: Collector}
+	assert.False(t, collector.CanIssueFor("collector-id"))
+}
+
+func TestRoleAssignmentValidate(t *testing.T) {
+	assert.Nil(t, RoleAssignment{Role: Artist}.Validate())
+	assert.Nil(t, RoleAssignment{Role: Gallery, Represents: []string{"artist-id"}}.Validate())
+
+	assert.EqualError(t, RoleAssignment{}.Validate(), "role: is required")
+	assert.EqualError(t, RoleAssignment{Role: "curator"}.Validate(), "role: must be 'collector', 'artist', 'gallery' or 'admin'")
+	assert.EqualError(t, RoleAssignment{Role: Artist, Represents: []string{"artist-id"}}.Validate(), "represents: can only be set for galleries")
+	assert.EqualError(t, RoleAssignment{Role: Gallery, Represents: []string{""}}.Validate(), "represents: cannot contain empty IDs")
+}
@@ -1,10 +1,19 @@
 package users
 
+import (
+	"context"
+	"strings"
+)
+
 // User is a type that represents a certificate owner or dealer.
 type User struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	Role  Role   `json:"role"`
+
+	// Represents lists the IDs of the artists represented by a gallery.
+	Represents []string `json:"represents,omitempty"`
 }
 
 // UserManager is the interface that defines CRUD operations allowed
@@ -12,6 +21,93 @@ type User struct {
 type UserManager interface {
 
 	// New generates a new user. Email address and name must be provided
-	// while ID should be generated internally by the application.
-	NewUser(email string, name string) (*User, error)
+	// while ID should be generated internally by the application. New
+	// users are collectors.
+	NewUser(ctx context.Context, email string, name string) (*User, error)
+
+	// IssueToken generates a new API token for the user identified by
+	// userID. The token is returned in clear only once and must be sent
+	// as a bearer token to authenticate requests.
+	IssueToken(ctx context.Context, userID string) (string, error)
+
+	// Authenticate returns the user owning the API token.
+	Authenticate(ctx context.Context, token string) (*User, error)
+
+	// GetUser returns the user identified either by ID or by email
+	// address.
+	GetUser(ctx context.Context, idOrEmail string) (*User, error)
+
+	// ListUsers returns the users matching f ordered by email address.
+	// Only limit users starting at offset are returned, together with
+	// the total number of matching users.
+	ListUsers(ctx context.Context, f Filter, offset, limit int) ([]User, int, error)
+
+	// UpdateUser applies a patch to the user identified by userID. It
+	// returns the updated user.
+	UpdateUser(ctx context.Context, userID string, p Patch) (*User, error)
+
+	// RequestEmailChange starts changing the email address of the user
+	// identified by userID to email. A verification token is sent to
+	// the new address, which replaces the current one only once the
+	// token is confirmed with ConfirmEmailChange. Users whose current
+	// address is an admin address can request a change to it to prove
+	// they own it and become admins.
+	RequestEmailChange(ctx context.Context, userID, email string) error
+
+	// ConfirmEmailChange redeems a verification token sent by
+	// RequestEmailChange to the user identified by userID, switching
+	// their email address. It returns the updated user.
+	ConfirmEmailChange(ctx context.Context, userID, token string) (*User, error)
+
+	// AssignRole gives the role described by a to the user identified by
+	// userID. It returns the updated user. Galleries can only represent
+	// artists and the last admin cannot be given another role.
+	AssignRole(ctx context.Context, userID string, a RoleAssignment) (*User, error)
+
+	// DeleteUser removes the user identified by userID together with its
+	// API tokens. Users who own certificates or are the recipient of
+	// pending transfers can be deleted only if reassignTo is set: their
+	// pending transfers are then cancelled or rejected and their
+	// certificates are given to the user identified by reassignTo.
+	DeleteUser(ctx context.Context, userID, reassignTo string) error
+}
+
+// NormalizeEmail returns the canonical form of an email address, which
+// identifies it regardless of the case and surrounding spaces it was
+// typed with. Email addresses are stored and compared in canonical form.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Filter selects the users returned by ListUsers. Empty fields match
+// every user.
+type Filter struct {
+	// EmailPrefix matches the users whose email address starts with it,
+	// ignoring case.
+	EmailPrefix string
+
+	// Name matches the users whose name contains it, ignoring case.
+	Name string
+}
+
+// Match returns true if u is selected by f.
+func (f Filter) Match(u User) bool {
+	return strings.HasPrefix(u.Email, NormalizeEmail(f.EmailPrefix)) &&
+		strings.Contains(strings.ToLower(u.Name), strings.ToLower(f.Name))
+}
+
+// Patch describes the changes to apply to a user. Fields that are nil
+// are left unchanged. Email addresses cannot be patched since they must
+// be verified: they are changed with RequestEmailChange.
+type Patch struct {
+	Name *string `json:"name"`
+}
+
+// Apply returns a copy of u with the changes of p.
+func (p Patch) Apply(u User) User {
+	if p.Name != nil {
+		u.Name = *p.Name
+	}
+
+	return u
 }
@@ -0,0 +1,46 @@
+package users
+
+import (
+	"github.com/Popcore/verisart/pkg/validation"
+)
+
+const (
+	// MaxEmailLength is the maximum length of an email address.
+	MaxEmailLength = 254
+
+	// MaxNameLength is the maximum length of a user name.
+	MaxNameLength = 100
+)
+
+// Validate checks that the user email address and name are valid.
+func (u User) Validate() error {
+	v := validation.Validator{}
+
+	CheckEmail(&v, u.Email)
+
+	v.Required("name", u.Name)
+	v.MaxLength("name", u.Name, MaxNameLength)
+
+	return v.Err()
+}
+
+// Validate checks the fields set by the patch.
+func (p Patch) Validate() error {
+	v := validation.Validator{}
+
+	if p.Name != nil {
+		v.Required("name", *p.Name)
+		v.MaxLength("name", *p.Name, MaxNameLength)
+	}
+
+	return v.Err()
+}
+
+// CheckEmail checks that email is a valid email address.
+func CheckEmail(v *validation.Validator, email string) {
+	v.Required("email", email)
+	if email != "" {
+		v.Email("email", email)
+		v.MaxLength("email", email, MaxEmailLength)
+	}
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why the value of a field is not valid.
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"error"`
+}
+
+// Errors is the list of the field errors found validating a value.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := []string{}
+	for _, fe := range e {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Msg))
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Validator collects the errors found while validating the fields of
+// a value. Its zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Check records an error for field when ok is false.
+func (v *Validator) Check(ok bool, field, msg string) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Field: field, Msg: msg})
+	}
+}
+
+// Required records an error if value is empty.
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLength records an error if value is longer than max characters.
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("must be at most %d characters long", max))
+}
+
+// Range records an error if value is not between min and max, included.
+func (v *Validator) Range(field string, value, min, max int) {
+	v.Check(value >= min && value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+// Email records an error if value is not a valid email address.
+func (v *Validator) Email(field, value string) {
+	v.Check(IsEmail(value), field, "must be a valid email address")
+}
+
+// Err returns the errors collected so far, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
+
+// IsEmail returns true if s is a plain email address, such as
+// joe@email.com. Addresses including a display name are not accepted.
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return false
+	}
+
+	return addr.Address == s && addr.Name == ""
+}
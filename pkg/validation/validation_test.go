@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	v := Validator{}
+	assert.Nil(t, v.Err())
+
+	v.Required("name", " ")
+	v.MaxLength("title", "àèìòù", 4)
+	v.MaxLength("note", "àèìòù", 5)
+	v.Range("year", 0, 1, 2018)
+	v.Email("email", "joe@email.com")
+	v.Email("recipient", "not-an-email")
+
+	err := v.Err()
+	assert.Equal(t, Errors{
+		{Field: "name", Msg: "is required"},
+		{Field: "title", Msg: "must be at most 4 characters long"},
+		{Field: "year", Msg: "must be between 1 and 2018"},
+		{Field: "recipient", Msg: "must be a valid email address"},
+	}, err)
+	assert.Equal(t, "name: is required; title: must be at most 4 characters long; "+
+		"year: must be between 1 and 2018; recipient: must be a valid email address", err.Error())
+}
+
+func TestIsEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"joe@email.com", true},
+		{"joe.blog+art@gallery.co.uk", true},
+		{"", false},
+		{"joe", false},
+		{"joe@", false},
+		{"Joe Blog <joe@email.com>", false},
+		{" joe@email.com", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.valid, IsEmail(test.email), test.email)
+	}
+}
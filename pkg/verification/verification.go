@@ -0,0 +1,139 @@
+// Package verification checks certificate documents presented by third
+// parties against the records held by the service.
+package verification
+
+import (
+	"crypto/ed25519"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+)
+
+// Status is the outcome of the verification of a certificate.
+type Status string
+
+const (
+	// Valid is the status of a genuine certificate matching the record
+	// held by the service.
+	Valid Status = "valid"
+
+	// Outdated is the status of a genuine certificate whose content was
+	// updated after the document was issued.
+	Outdated Status = "outdated"
+
+	// Transferred is the status of a genuine certificate that now
+	// belongs to someone else.
+	Transferred Status = "transferred"
+
+	// Deleted is the status of a certificate that no longer exists.
+	Deleted Status = "deleted"
+
+	// Tampered is the status of a certificate whose signature does not
+	// match its content, or that was not issued by the service.
+	Tampered Status = "tampered"
+)
+
+// Verdict is the result of the verification of a certificate.
+type Verdict struct {
+	Status  Status   `json:"status"`
+	Valid   bool     `json:"valid"`
+	Reasons []string `json:"reasons"`
+
+	// Current is the record held by the service, if any.
+	Current *cert.Certificate `json:"current,omitempty"`
+}
+
+// severity orders statuses from the least to the most serious.
+var severity = map[Status]int{
+	Valid:       0,
+	Outdated:    1,
+	Transferred: 2,
+	Deleted:     3,
+	Tampered:    4,
+}
+
+// report records a finding of the verification. Findings can only make
+// the status worse: the most serious one wins.
+func (v *Verdict) report(status Status, reason string) {
+	if severity[status] > severity[v.Status] {
+		v.Status = status
+	}
+	v.Reasons = append(v.Reasons, reason)
+}
+
+// finish completes the verdict once all the findings are reported.
+func (v *Verdict) finish() Verdict {
+	v.Valid = v.Status == Valid
+	if v.Valid {
+		v.Reasons = []string{"the certificate was issued by the service and matches the current record"}
+	}
+
+	return *v
+}
+
+// Verify checks a certificate document against stored, the record held by
+// the service for the same ID, which is nil if there is no such record.
+// The signatures of both are checked with pub.
+func Verify(doc cert.Certificate, stored *cert.Certificate, pub ed25519.PublicKey) Verdict {
+	v := Verdict{Status: Valid, Reasons: []string{}, Current: stored}
+
+	if reason, ok := checkSignature(doc, pub); !ok {
+		v.report(Tampered, "the certificate document "+reason)
+	}
+
+	if stored == nil {
+		v.report(Deleted, "no certificate matches the ID: it was deleted or never existed")
+		return v.finish()
+	}
+
+	if reason, ok := checkSignature(*stored, pub); !ok {
+		v.report(Tampered, "the stored certificate "+reason)
+	}
+
+	if doc.Title != stored.Title || doc.Year != stored.Year || doc.Note != stored.Note ||
+		!doc.CreatedAt.Equal(stored.CreatedAt) {
+		v.report(Outdated, "the certificate content was updated after the document was issued")
+	}
+
+	if doc.OwnerID != stored.OwnerID {
+		v.report(Transferred, "the certificate was transferred to another owner")
+	}
+
+	return v.finish()
+}
+
+// VerifyStored checks the signature of a certificate held by the service.
+// stored is nil if no certificate matches the requested ID.
+func VerifyStored(stored *cert.Certificate, pub ed25519.PublicKey) Verdict {
+	v := Verdict{Status: Valid, Reasons: []string{}, Current: stored}
+
+	if stored == nil {
+		v.report(Deleted, "no certificate matches the ID: it was deleted or never existed")
+		return v.finish()
+	}
+
+	if reason, ok := checkSignature(*stored, pub); !ok {
+		v.report(Tampered, "the stored certificate "+reason)
+	}
+
+	return v.finish()
+}
+
+// checkSignature verifies the signature of c. When the signature is not
+// valid it returns the reason why.
+func checkSignature(c cert.Certificate, pub ed25519.PublicKey) (string, bool) {
+	if c.Signature == nil {
+		return "is not signed", false
+	}
+
+	payload, err := c.SignedPayload()
+	if err != nil {
+		return "cannot be encoded: " + err.Error(), false
+	}
+
+	if err := signing.Verify(pub, payload, *c.Signature); err != nil {
+		return "has an invalid signature: " + err.Error(), false
+	}
+
+	return "", true
+}
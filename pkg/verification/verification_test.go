@@ -0,0 +1,105 @@
+package verification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cert "github.com/Popcore/verisart/pkg/certificate"
+	"github.com/Popcore/verisart/pkg/signing"
+)
+
+// signed returns a copy of c signed with key.
+func signed(t *testing.T, key *signing.Key, c cert.Certificate) cert.Certificate {
+	payload, err := c.SignedPayload()
+	assert.Nil(t, err)
+
+	sig, err := key.Sign(payload)
+	assert.Nil(t, err)
+	c.Signature = &sig
+
+	return c
+}
+
+func TestVerify(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	other, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	original := signed(t, key, cert.Certificate{
+		ID:        "the-id",
+		Title:     "the-title",
+		CreatedAt: time.Date(2018, 11, 22, 12, 21, 38, 0, time.UTC),
+		OwnerID:   "owner1@email.com",
+		Year:      2018,
+	})
+
+	updated := original
+	updated.Title = "the-new-title"
+	updated = signed(t, key, updated)
+
+	transferred := original
+	transferred.OwnerID = "owner2@email.com"
+	transferred = signed(t, key, transferred)
+
+	tampered := original
+	tampered.Year = 1890
+
+	unsigned := original
+	unsigned.Signature = nil
+
+	tests := []struct {
+		name   string
+		doc    cert.Certificate
+		stored *cert.Certificate
+		status Status
+	}{
+		{"valid", original, &original, Valid},
+		{"outdated", original, &updated, Outdated},
+		{"transferred", original, &transferred, Transferred},
+		{"deleted", original, nil, Deleted},
+		{"tampered", tampered, &original, Tampered},
+		{"unsigned", unsigned, &original, Tampered},
+		{"forged", signed(t, other, original), &original, Tampered},
+		{"tampered record", original, &tampered, Tampered},
+	}
+
+	for _, test := range tests {
+		v := Verify(test.doc, test.stored, key.PublicKey())
+		assert.Equal(t, test.status, v.Status, test.name)
+		assert.Equal(t, test.status == Valid, v.Valid, test.name)
+		assert.NotEmpty(t, v.Reasons, test.name)
+		assert.Equal(t, test.stored, v.Current, test.name)
+	}
+}
+
+func TestVerifyReportsAllReasons(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	doc := signed(t, key, cert.Certificate{ID: "the-id", Title: "the-title", OwnerID: "owner1@email.com", Year: 2018})
+	stored := signed(t, key, cert.Certificate{ID: "the-id", Title: "the-new-title", OwnerID: "owner2@email.com", Year: 2018})
+
+	v := Verify(doc, &stored, key.PublicKey())
+	assert.Equal(t, Transferred, v.Status)
+	assert.Equal(t, []string{
+		"the certificate content was updated after the document was issued",
+		"the certificate was transferred to another owner",
+	}, v.Reasons)
+}
+
+func TestVerifyStored(t *testing.T) {
+	key, err := signing.GenerateKey()
+	assert.Nil(t, err)
+
+	stored := signed(t, key, cert.Certificate{ID: "the-id", Title: "the-title", OwnerID: "owner1@email.com", Year: 2018})
+	assert.Equal(t, Valid, VerifyStored(&stored, key.PublicKey()).Status)
+
+	stored.Title = "the-new-title"
+	assert.Equal(t, Tampered, VerifyStored(&stored, key.PublicKey()).Status)
+
+	assert.Equal(t, Deleted, VerifyStored(nil, key.PublicKey()).Status)
+}